@@ -0,0 +1,120 @@
+// goagent-config prints the effective agent config merged from the default values, the
+// config file and the env vars, along with where the value of every field comes from and
+// the problems found in the config. It exits with status 1 if the config has errors.
+//
+//	HT_CONFIG_FILE=config.yaml goagent-config
+//	goagent-config -file config.yaml -format json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hypertrace/goagent/config"
+)
+
+const redacted = "<redacted>"
+
+// secretFields are the fields whose value isn't printed.
+var secretFields = map[string]bool{
+	"reporting.token": true,
+}
+
+type field struct {
+	Path   string        `json:"path"`
+	EnvVar string        `json:"env_var,omitempty"`
+	Value  string        `json:"value"`
+	Source config.Source `json:"source"`
+}
+
+type issue struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type report struct {
+	Fields   []field `json:"fields"`
+	Errors   []issue `json:"errors"`
+	Warnings []issue `json:"warnings"`
+}
+
+func main() {
+	configFile := flag.String("file", "", "path to the config file, defaults to HT_CONFIG_FILE")
+	format := flag.String("format", "text", "output format, text or json")
+	flag.Parse()
+
+	cfg, fields, err := config.Explain(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	r := report{}
+	for _, f := range fields {
+		if secretFields[f.Path] && len(f.Value) > 0 {
+			f.Value = redacted
+		}
+		r.Fields = append(r.Fields, field(f))
+	}
+
+	result := config.Validate(cfg)
+	r.Errors = issues(result.Errors)
+	r.Warnings = issues(result.Warnings)
+
+	switch *format {
+	case "json":
+		err = printJSON(os.Stdout, r)
+	case "text":
+		err = printText(os.Stdout, r)
+	default:
+		err = fmt.Errorf("unknown format: %s", *format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if len(r.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+func issues(in []config.Issue) []issue {
+	out := make([]issue, 0, len(in))
+	for _, i := range in {
+		out = append(out, issue(i))
+	}
+	return out
+}
+
+func printJSON(w io.Writer, r report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func printText(w io.Writer, r report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tVALUE\tSOURCE\tENV VAR")
+	for _, f := range r.Fields {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Path, f.Value, f.Source, f.EnvVar)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, i := range r.Errors {
+		fmt.Fprintf(w, "\nerror: %s: %s", i.Field, i.Message)
+	}
+	for _, i := range r.Warnings {
+		fmt.Fprintf(w, "\nwarning: %s: %s", i.Field, i.Message)
+	}
+	if len(r.Errors)+len(r.Warnings) > 0 {
+		fmt.Fprintln(w)
+	}
+	return nil
+}
@@ -6,7 +6,11 @@ package config // import "github.com/hypertrace/goagent/config"
 // the config.
 
 import (
+	"fmt"
+
+	"github.com/ghodss/yaml"
 	agentconfig "github.com/hypertrace/agent-config/gen/go/v1"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 func Load() *agentconfig.AgentConfig {
@@ -26,6 +30,40 @@ func LoadEnv(cfg *agentconfig.AgentConfig) {
 	cfg.LoadFromEnv(agentconfig.WithDefaults(&defaultConfig))
 }
 
+// Parse parses a config in "json" or "yaml" format. Same as for a config file, env vars
+// take precedence over the parsed values and the default values apply for missing ones.
+// Unlike LoadFromFile it fails if the content can't be parsed.
+func Parse(content []byte, format string) (*agentconfig.AgentConfig, error) {
+	cfg, err := unmarshal(content, format)
+	if err != nil {
+		return nil, err
+	}
+	LoadEnv(cfg)
+	return cfg, nil
+}
+
+// unmarshal parses a config in "json" or "yaml" format without applying env vars nor
+// default values.
+func unmarshal(content []byte, format string) (*agentconfig.AgentConfig, error) {
+	switch format {
+	case "json":
+	case "yaml", "yml":
+		var err error
+		// protojson is needed to parse the wrapped scalars hence YAML is converted into JSON.
+		if content, err = yaml.YAMLToJSON(content); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML config: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format: %s", format)
+	}
+
+	cfg := &agentconfig.AgentConfig{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	return cfg, nil
+}
+
 func PropagationFormats(formats ...agentconfig.PropagationFormat) []agentconfig.PropagationFormat {
 	return formats
 }
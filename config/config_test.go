@@ -102,3 +102,27 @@ func TestConfigLoadIsNotOverridenByDefaults(t *testing.T) {
 	assert.Equal(t, true, cfg.DataCapture.RpcMetadata.Response.Value)
 	assert.ElementsMatch(t, pf, cfg.GetPropagationFormats())
 }
+
+func TestParse(t *testing.T) {
+	os.Setenv("HT_DATA_CAPTURE_HTTP_HEADERS_RESPONSE", "false")
+	defer os.Unsetenv("HT_DATA_CAPTURE_HTTP_HEADERS_RESPONSE")
+
+	cfg, err := Parse([]byte("service_name: my_service\ndata_capture:\n  body_max_size_bytes: 10\n"), "yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "my_service", cfg.GetServiceName().GetValue())
+	assert.Equal(t, int32(10), cfg.GetDataCapture().GetBodyMaxSizeBytes().GetValue())
+	// env vars take precedence over the parsed values
+	assert.Equal(t, false, cfg.GetDataCapture().GetHttpHeaders().GetResponse().GetValue())
+	// use defaults
+	assert.Equal(t, true, cfg.GetDataCapture().GetHttpBody().GetRequest().GetValue())
+
+	cfg, err = Parse([]byte(`{"serviceName": "my_service"}`), "json")
+	assert.NoError(t, err)
+	assert.Equal(t, "my_service", cfg.GetServiceName().GetValue())
+
+	_, err = Parse([]byte(`{"service_name": `), "json")
+	assert.Error(t, err)
+
+	_, err = Parse([]byte(`service_name = "my_service"`), "toml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,184 @@
+package config // import "github.com/hypertrace/goagent/config"
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	agentconfig "github.com/hypertrace/agent-config/gen/go/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const envPrefix = "HT_"
+
+// ignoredFields are the fields that don't apply to the Go agent.
+var ignoredFields = map[string]bool{
+	"javaagent": true,
+}
+
+// Source tells where the effective value of a config field comes from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	// SourceUnset is used for fields that aren't set anywhere, they hold the zero value.
+	SourceUnset Source = "unset"
+)
+
+// Field is a config field along with its effective value and where it comes from.
+type Field struct {
+	// Path is the path of the field in the config, e.g. "reporting.endpoint".
+	Path string
+	// EnvVar is the env var that overrides the field, e.g. "HT_REPORTING_ENDPOINT",
+	// empty if the field can't be set from env vars.
+	EnvVar string
+	Value  string
+	Source Source
+}
+
+// Explain loads the config from the default values, the config file and the env vars
+// the same way LoadFromFile does and tells where the value of every field comes from.
+// The file in HT_CONFIG_FILE is used if configFile is empty, no file is used if both
+// are empty. Unlike LoadFromFile it fails if the config file can't be read or parsed.
+func Explain(configFile string) (*agentconfig.AgentConfig, []Field, error) {
+	if len(configFile) == 0 {
+		configFile = os.Getenv(envPrefix + "CONFIG_FILE")
+	}
+
+	fileCfg := &agentconfig.AgentConfig{}
+	if len(configFile) > 0 {
+		content, err := os.ReadFile(filepath.Clean(configFile))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read config file %s: %v", configFile, err)
+		}
+
+		if fileCfg, err = unmarshal(content, strings.TrimPrefix(filepath.Ext(configFile), ".")); err != nil {
+			return nil, nil, fmt.Errorf("failed to load config file %s: %v", configFile, err)
+		}
+	}
+
+	cfg := proto.Clone(fileCfg).(*agentconfig.AgentConfig)
+	LoadEnv(cfg)
+
+	var fields []Field
+	explainFields(cfg.ProtoReflect(), fileCfg.ProtoReflect(), defaultConfig.ProtoReflect(), "", envPrefix, &fields)
+	return cfg, fields, nil
+}
+
+// explainFields walks the effective config and appends its leaf fields along with their
+// source, the file and default configs are walked alongside to find out the source.
+func explainFields(cfg, fileCfg, defaults protoreflect.Message, path, envVarPrefix string, fields *[]Field) {
+	fds := cfg.Descriptor().Fields()
+	for i := 0; i < fds.Len(); i++ {
+		fd := fds.Get(i)
+		fieldPath := string(fd.Name())
+		if len(path) > 0 {
+			fieldPath = path + "." + fieldPath
+		}
+		if ignoredFields[fieldPath] {
+			continue
+		}
+		envVar := envVarPrefix + strings.ToUpper(string(fd.Name()))
+
+		if fd.Message() != nil && !fd.IsList() && !fd.IsMap() && !isWrapper(fd.Message()) {
+			// unset messages are returned as empty read only messages hence they can be walked.
+			explainFields(cfg.Get(fd).Message(), fileCfg.Get(fd).Message(), defaults.Get(fd).Message(), fieldPath, envVar+"_", fields)
+			continue
+		}
+
+		field := Field{Path: fieldPath, Value: formatValue(fd, cfg.Get(fd))}
+		// maps can't be set from env vars
+		if !fd.IsMap() {
+			field.EnvVar = envVar
+		}
+
+		switch {
+		case len(field.EnvVar) > 0 && isSetInEnv(fd, field.EnvVar):
+			field.Source = SourceEnv
+		case fileCfg.Has(fd):
+			field.Source = SourceFile
+		case defaults.Has(fd):
+			field.Source = SourceDefault
+		default:
+			field.Source = SourceUnset
+		}
+		*fields = append(*fields, field)
+	}
+}
+
+// isWrapper tells whether the message is a wrapped scalar e.g. google.protobuf.StringValue.
+func isWrapper(md protoreflect.MessageDescriptor) bool {
+	return md.ParentFile().Package() == "google.protobuf" && strings.HasSuffix(string(md.Name()), "Value")
+}
+
+// isSetInEnv tells whether the env var holds a value the env loader takes, e.g. values
+// other than "true" or "false" are ignored for bools.
+func isSetInEnv(fd protoreflect.FieldDescriptor, envVar string) bool {
+	val := os.Getenv(envVar)
+	if len(val) == 0 {
+		return false
+	}
+
+	if fd.IsList() {
+		return true
+	}
+
+	switch scalarKind(fd) {
+	case protoreflect.BoolKind:
+		return val == "true" || val == "false"
+	case protoreflect.Int32Kind, protoreflect.Int64Kind:
+		_, err := strconv.Atoi(val)
+		return err == nil
+	}
+	return true
+}
+
+// scalarKind returns the kind of the field, or the one of the wrapped value for wrappers.
+func scalarKind(fd protoreflect.FieldDescriptor) protoreflect.Kind {
+	if fd.Message() != nil && isWrapper(fd.Message()) {
+		return fd.Message().Fields().ByName("value").Kind()
+	}
+	return fd.Kind()
+}
+
+func formatValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		items := make([]string, 0, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			items = append(items, formatSingular(fd, list.Get(i)))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case fd.IsMap():
+		var items []string
+		v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			items = append(items, k.String()+"="+formatSingular(fd.MapValue(), v))
+			return true
+		})
+		sort.Strings(items)
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+	return formatSingular(fd, v)
+}
+
+func formatSingular(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	if fd.Message() != nil && isWrapper(fd.Message()) {
+		valueFd := fd.Message().Fields().ByName("value")
+		return formatSingular(valueFd, v.Message().Get(valueFd))
+	}
+
+	if fd.Kind() == protoreflect.EnumKind {
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return strconv.Itoa(int(v.Enum()))
+	}
+	return fmt.Sprint(v.Interface())
+}
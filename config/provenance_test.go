@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fieldsByPath(fields []Field) map[string]Field {
+	byPath := map[string]Field{}
+	for _, field := range fields {
+		byPath[field.Path] = field
+	}
+	return byPath
+}
+
+func TestExplain(t *testing.T) {
+	os.Setenv("HT_DATA_CAPTURE_HTTP_HEADERS_RESPONSE", "false")
+	defer os.Unsetenv("HT_DATA_CAPTURE_HTTP_HEADERS_RESPONSE")
+	// invalid values are ignored by the env loader
+	os.Setenv("HT_DATA_CAPTURE_HTTP_BODY_REQUEST", "yes")
+	defer os.Unsetenv("HT_DATA_CAPTURE_HTTP_BODY_REQUEST")
+
+	cfg, fields, err := Explain("./testdata/config_snake.yml")
+	require.NoError(t, err)
+	assert.Equal(t, "snake_service", cfg.GetServiceName().GetValue())
+
+	byPath := fieldsByPath(fields)
+	assert.Equal(t, Field{
+		Path:   "service_name",
+		EnvVar: "HT_SERVICE_NAME",
+		Value:  "snake_service",
+		Source: SourceFile,
+	}, byPath["service_name"])
+	assert.Equal(t, Field{
+		Path:   "data_capture.http_headers.response",
+		EnvVar: "HT_DATA_CAPTURE_HTTP_HEADERS_RESPONSE",
+		Value:  "false",
+		Source: SourceEnv,
+	}, byPath["data_capture.http_headers.response"])
+	assert.Equal(t, SourceDefault, byPath["data_capture.http_body.request"].Source)
+	assert.Equal(t, "true", byPath["data_capture.http_body.request"].Value)
+	assert.Equal(t, Field{
+		Path:   "reporting.trace_reporter_type",
+		EnvVar: "HT_REPORTING_TRACE_REPORTER_TYPE",
+		Value:  "ZIPKIN",
+		Source: SourceDefault,
+	}, byPath["reporting.trace_reporter_type"])
+	assert.Equal(t, "[json, x-www-form-urlencoded]", byPath["data_capture.allowed_content_types"].Value)
+	assert.Equal(t, SourceUnset, byPath["reporting.token"].Source)
+	assert.Equal(t, "", byPath["resource_attributes"].EnvVar)
+}
+
+func TestExplainUsesConfigFileFromEnv(t *testing.T) {
+	os.Setenv("HT_CONFIG_FILE", "./testdata/config.json")
+	defer os.Unsetenv("HT_CONFIG_FILE")
+
+	_, fields, err := Explain("")
+	require.NoError(t, err)
+
+	byPath := fieldsByPath(fields)
+	assert.Equal(t, SourceFile, byPath["reporting.endpoint"].Source)
+	assert.Equal(t, "http://api.traceable.ai:9411/api/v2/spans", byPath["reporting.endpoint"].Value)
+}
+
+func TestExplainFailsOnInvalidFile(t *testing.T) {
+	_, _, err := Explain("./testdata/missing.yml")
+	assert.Error(t, err)
+}
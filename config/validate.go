@@ -0,0 +1,254 @@
+package config // import "github.com/hypertrace/goagent/config"
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	agentconfig "github.com/hypertrace/agent-config/gen/go/v1"
+)
+
+// Issue is a problem found in a config field.
+type Issue struct {
+	// Field is the path of the field in the config, e.g. "reporting.endpoint".
+	Field   string
+	Message string
+}
+
+func (i Issue) Error() string {
+	return fmt.Sprintf("%s: %s", i.Field, i.Message)
+}
+
+// ValidationResult holds the problems found in a config. Errors are settings the agent
+// can't work with, e.g. an endpoint that can't be parsed, while warnings are settings
+// that are valid but most likely not what the user wants, e.g. metrics being enabled
+// when they can't be reported.
+type ValidationResult struct {
+	Errors   []Issue
+	Warnings []Issue
+}
+
+// Err returns the errors joined into a single one, nil if there are none.
+func (r *ValidationResult) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+
+	errs := make([]error, 0, len(r.Errors))
+	for _, issue := range r.Errors {
+		errs = append(errs, issue)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *ValidationResult) addError(field, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, Issue{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *ValidationResult) addWarning(field, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, Issue{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the config the same way the agent uses it on Init so problems show up
+// before the agent starts instead of being logged at runtime.
+func Validate(cfg *agentconfig.AgentConfig) *ValidationResult {
+	r := &ValidationResult{}
+	if cfg == nil {
+		r.addError("", "config is missing")
+		return r
+	}
+
+	if len(cfg.GetServiceName().GetValue()) == 0 {
+		r.addWarning("service_name", "service name is empty")
+	}
+
+	validateReporting(r, cfg.GetReporting())
+	validateMetrics(r, cfg)
+	validateDataCapture(r, cfg.GetDataCapture())
+	return r
+}
+
+func validateReporting(r *ValidationResult, reporting *agentconfig.Reporting) {
+	reporterType := reporting.GetTraceReporterType()
+	if _, ok := agentconfig.TraceReporterType_name[int32(reporterType)]; !ok {
+		r.addError("reporting.trace_reporter_type", "unknown trace reporter type %d", reporterType)
+	}
+
+	switch reporterType {
+	case agentconfig.TraceReporterType_NONE:
+	case agentconfig.TraceReporterType_LOGGING:
+		validateFileEndpoint(r, "reporting.endpoint", reporting.GetEndpoint().GetValue())
+	case agentconfig.TraceReporterType_ZIPKIN:
+		validateURLEndpoint(r, "reporting.endpoint", reporting.GetEndpoint().GetValue())
+	case agentconfig.TraceReporterType_OTLP_HTTP:
+		// the OTLP HTTP exporter takes the host and port, the scheme depends on reporting.secure
+		validateHostPortEndpoint(r, "reporting.endpoint", reporting.GetEndpoint().GetValue(), false)
+	default:
+		validateHostPortEndpoint(r, "reporting.endpoint", reporting.GetEndpoint().GetValue(), true)
+	}
+
+	certFile := reporting.GetCertFile().GetValue()
+	if len(certFile) == 0 {
+		return
+	}
+
+	if !reporting.GetSecure().GetValue() {
+		r.addWarning("reporting.cert_file", "cert file is ignored as reporting.secure is false")
+	}
+
+	certBytes, err := os.ReadFile(filepath.Clean(certFile))
+	if err != nil {
+		r.addError("reporting.cert_file", "failed to read cert file: %v", err)
+		return
+	}
+
+	if !x509.NewCertPool().AppendCertsFromPEM(certBytes) {
+		r.addError("reporting.cert_file", "cert file %s doesn't contain any PEM certificate", certFile)
+	}
+}
+
+func validateMetrics(r *ValidationResult, cfg *agentconfig.AgentConfig) {
+	reporting := cfg.GetReporting()
+	metricReporterType := reporting.GetMetricReporterType()
+	if _, ok := agentconfig.MetricReporterType_name[int32(metricReporterType)]; !ok {
+		r.addError("reporting.metric_reporter_type", "unknown metric reporter type %d", metricReporterType)
+	}
+
+	if !cfg.GetTelemetry().GetMetricsEnabled().GetValue() {
+		return
+	}
+
+	metricEndpoint := reporting.GetMetricEndpoint().GetValue()
+	switch metricReporterType {
+	case agentconfig.MetricReporterType_METRIC_REPORTER_TYPE_NONE:
+		return
+	case agentconfig.MetricReporterType_METRIC_REPORTER_TYPE_PROMETHEUS:
+		// the metric endpoint is the address metrics are served on, a default one is used if not set
+		if len(metricEndpoint) > 0 {
+			validateHostPortEndpoint(r, "reporting.metric_endpoint", metricEndpoint, false)
+		}
+		return
+	case agentconfig.MetricReporterType_METRIC_REPORTER_TYPE_LOGGING:
+		// metrics are written to stdout if the metric endpoint isn't a file URL
+		validateFileEndpoint(r, "reporting.metric_endpoint", metricEndpoint)
+		return
+	}
+
+	if len(metricEndpoint) == 0 {
+		// the traces endpoint is used for metrics only when traces are reported over OTLP
+		switch reporting.GetTraceReporterType() {
+		case agentconfig.TraceReporterType_OTLP, agentconfig.TraceReporterType_OTLP_HTTP, agentconfig.TraceReporterType_UNSPECIFIED:
+		default:
+			r.addWarning(
+				"telemetry.metrics_enabled",
+				"metrics are disabled because reporting.metric_endpoint is not set and the trace reporter type %s can't report metrics",
+				reporting.GetTraceReporterType(),
+			)
+		}
+		return
+	}
+
+	validateHostPortEndpoint(r, "reporting.metric_endpoint", metricEndpoint, true)
+}
+
+func validateDataCapture(r *ValidationResult, dataCapture *agentconfig.DataCapture) {
+	bodyMaxSize := dataCapture.GetBodyMaxSizeBytes().GetValue()
+	bodyMaxProcessingSize := dataCapture.GetBodyMaxProcessingSizeBytes().GetValue()
+	capturesBodies := dataCapture.GetHttpBody().GetRequest().GetValue() ||
+		dataCapture.GetHttpBody().GetResponse().GetValue() ||
+		dataCapture.GetRpcBody().GetRequest().GetValue() ||
+		dataCapture.GetRpcBody().GetResponse().GetValue()
+
+	if bodyMaxSize < 0 {
+		r.addError("data_capture.body_max_size_bytes", "must not be negative, got %d", bodyMaxSize)
+	} else if bodyMaxSize == 0 && capturesBodies {
+		r.addWarning("data_capture.body_max_size_bytes", "body capture is enabled but no body will be recorded as the max size is 0")
+	}
+
+	if bodyMaxProcessingSize < 0 {
+		r.addError("data_capture.body_max_processing_size_bytes", "must not be negative, got %d", bodyMaxProcessingSize)
+	} else if bodyMaxProcessingSize > 0 && bodyMaxProcessingSize < bodyMaxSize {
+		r.addWarning(
+			"data_capture.body_max_processing_size_bytes",
+			"is lower than data_capture.body_max_size_bytes (%d < %d)", bodyMaxProcessingSize, bodyMaxSize,
+		)
+	}
+
+	capturesHTTPBodies := dataCapture.GetHttpBody().GetRequest().GetValue() || dataCapture.GetHttpBody().GetResponse().GetValue()
+	if capturesHTTPBodies && len(dataCapture.GetAllowedContentTypes()) == 0 {
+		r.addWarning("data_capture.allowed_content_types", "HTTP body capture is enabled but no content type is allowed")
+	}
+}
+
+// validateURLEndpoint checks endpoints used by HTTP exporters, e.g. "http://localhost:9411/api/v2/spans".
+func validateURLEndpoint(r *ValidationResult, field, endpoint string) {
+	if len(endpoint) == 0 {
+		r.addError(field, "endpoint is empty")
+		return
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		r.addError(field, "invalid URL: %v", err)
+		return
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		r.addError(field, "URL %q must use the http or https scheme", endpoint)
+		return
+	}
+
+	if len(u.Host) == 0 {
+		r.addError(field, "URL %q has no host", endpoint)
+	}
+}
+
+// validateFileEndpoint checks the endpoint of the logging reporters when it is a file URL,
+// e.g. "file:///var/log/goagent/spans.jsonl". Other endpoints are ignored as they log to stdout.
+func validateFileEndpoint(r *ValidationResult, field, endpoint string) {
+	if !strings.HasPrefix(endpoint, "file://") {
+		return
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		r.addError(field, "invalid file URL: %v", err)
+		return
+	}
+
+	if len(u.Host)+len(u.Path) == 0 {
+		r.addError(field, "file URL %q has no path", endpoint)
+	}
+}
+
+// validateHostPortEndpoint checks endpoints used by OTLP exporters, e.g. "localhost:4317".
+// The gRPC exporters remove the protocol prefix hence it is allowed for them.
+func validateHostPortEndpoint(r *ValidationResult, field, endpoint string, allowScheme bool) {
+	if len(endpoint) == 0 {
+		r.addError(field, "endpoint is empty")
+		return
+	}
+
+	if _, hostPort, ok := strings.Cut(endpoint, "://"); ok {
+		if !allowScheme {
+			r.addError(field, "endpoint %q must be in the host:port form without scheme", endpoint)
+			return
+		}
+		endpoint = hostPort
+	}
+
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		r.addError(field, "endpoint %q must be in the host:port form: %v", endpoint, err)
+		return
+	}
+
+	if len(host) == 0 || len(port) == 0 {
+		r.addError(field, "endpoint %q must have both host and port", endpoint)
+	}
+}
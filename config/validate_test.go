@@ -0,0 +1,159 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	agentconfig "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func issueFields(issues []Issue) []string {
+	fields := []string{}
+	for _, issue := range issues {
+		fields = append(fields, issue.Field)
+	}
+	return fields
+}
+
+func TestValidateDefaultConfig(t *testing.T) {
+	cfg := Load()
+	cfg.ServiceName = String("my_service")
+
+	r := Validate(cfg)
+	assert.Empty(t, r.Errors)
+	assert.NoError(t, r.Err())
+	// zipkin can't report metrics hence they are silently disabled
+	assert.Equal(t, []string{"telemetry.metrics_enabled"}, issueFields(r.Warnings))
+}
+
+func TestValidateEndpoints(t *testing.T) {
+	tCases := map[string]struct {
+		reporterType agentconfig.TraceReporterType
+		endpoint     string
+		valid        bool
+	}{
+		"zipkin URL":               {agentconfig.TraceReporterType_ZIPKIN, "http://localhost:9411/api/v2/spans", true},
+		"zipkin without scheme":    {agentconfig.TraceReporterType_ZIPKIN, "localhost:9411/api/v2/spans", false},
+		"zipkin without host":      {agentconfig.TraceReporterType_ZIPKIN, "http:///api/v2/spans", false},
+		"empty zipkin endpoint":    {agentconfig.TraceReporterType_ZIPKIN, "", false},
+		"otlp host and port":       {agentconfig.TraceReporterType_OTLP, "localhost:4317", true},
+		"otlp with scheme":         {agentconfig.TraceReporterType_OTLP, "http://localhost:4317", true},
+		"otlp without port":        {agentconfig.TraceReporterType_OTLP, "localhost", false},
+		"unspecified uses otlp":    {agentconfig.TraceReporterType_UNSPECIFIED, "localhost", false},
+		"otlp http host and port":  {agentconfig.TraceReporterType_OTLP_HTTP, "localhost:4318", true},
+		"otlp http with scheme":    {agentconfig.TraceReporterType_OTLP_HTTP, "http://localhost:4318", false},
+		"logging ignores endpoint": {agentconfig.TraceReporterType_LOGGING, "", true},
+		"logging to file":          {agentconfig.TraceReporterType_LOGGING, "file:///tmp/spans.jsonl", true},
+		"logging to file no path":  {agentconfig.TraceReporterType_LOGGING, "file://", false},
+		"unknown reporter type":    {agentconfig.TraceReporterType(100), "localhost:4317", false},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			cfg := Load()
+			cfg.Reporting.TraceReporterType = tCase.reporterType
+			cfg.Reporting.Endpoint = String(tCase.endpoint)
+
+			err := Validate(cfg).Err()
+			if tCase.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateCertFile(t *testing.T) {
+	cfg := Load()
+	cfg.Reporting.Secure = Bool(true)
+	cfg.Reporting.CertFile = String(filepath.Join(t.TempDir(), "missing.pem"))
+
+	r := Validate(cfg)
+	assert.Equal(t, []string{"reporting.cert_file"}, issueFields(r.Errors))
+
+	notAPEM := filepath.Join(t.TempDir(), "cert.pem")
+	require.NoError(t, os.WriteFile(notAPEM, []byte("not a cert"), 0600))
+	cfg.Reporting.CertFile = String(notAPEM)
+
+	r = Validate(cfg)
+	assert.Equal(t, []string{"reporting.cert_file"}, issueFields(r.Errors))
+	assert.ErrorContains(t, r.Err(), "doesn't contain any PEM certificate")
+
+	cfg.Reporting.Secure = Bool(false)
+	r = Validate(cfg)
+	assert.Contains(t, issueFields(r.Warnings), "reporting.cert_file")
+}
+
+func TestValidateMetrics(t *testing.T) {
+	cfg := Load()
+	cfg.ServiceName = String("my_service")
+	cfg.Reporting.MetricEndpoint = String("localhost:4317")
+
+	r := Validate(cfg)
+	assert.Empty(t, r.Errors)
+	assert.Empty(t, r.Warnings)
+
+	cfg.Reporting.MetricEndpoint = String("localhost")
+	r = Validate(cfg)
+	assert.Equal(t, []string{"reporting.metric_endpoint"}, issueFields(r.Errors))
+
+	// the traces endpoint is used for metrics
+	cfg.Reporting.MetricEndpoint = String("")
+	cfg.Reporting.TraceReporterType = agentconfig.TraceReporterType_OTLP
+	cfg.Reporting.Endpoint = String("localhost:4317")
+	r = Validate(cfg)
+	assert.Empty(t, r.Errors)
+	assert.Empty(t, r.Warnings)
+
+	// also over OTLP HTTP
+	cfg.Reporting.TraceReporterType = agentconfig.TraceReporterType_OTLP_HTTP
+	r = Validate(cfg)
+	assert.Empty(t, r.Warnings)
+
+	// no endpoint is needed to log the metrics
+	cfg.Reporting.TraceReporterType = agentconfig.TraceReporterType_ZIPKIN
+	cfg.Reporting.Endpoint = String("http://localhost:9411/api/v2/spans")
+	cfg.Reporting.MetricReporterType = agentconfig.MetricReporterType_METRIC_REPORTER_TYPE_LOGGING
+	r = Validate(cfg)
+	assert.Empty(t, r.Errors)
+	assert.Empty(t, r.Warnings)
+
+	// prometheus serves the metrics on a default address
+	cfg = Load()
+	cfg.ServiceName = String("my_service")
+	cfg.Reporting.MetricReporterType = agentconfig.MetricReporterType_METRIC_REPORTER_TYPE_PROMETHEUS
+	r = Validate(cfg)
+	assert.Empty(t, r.Errors)
+	assert.Empty(t, r.Warnings)
+
+	cfg.Reporting.MetricEndpoint = String("http://0.0.0.0:9464")
+	r = Validate(cfg)
+	assert.Equal(t, []string{"reporting.metric_endpoint"}, issueFields(r.Errors))
+}
+
+func TestValidateDataCapture(t *testing.T) {
+	cfg := Load()
+	cfg.ServiceName = String("my_service")
+	cfg.Telemetry.MetricsEnabled = Bool(false)
+	cfg.DataCapture.BodyMaxSizeBytes = Int32(0)
+	cfg.DataCapture.BodyMaxProcessingSizeBytes = Int32(-1)
+	cfg.DataCapture.AllowedContentTypes = nil
+
+	r := Validate(cfg)
+	assert.Equal(t, []string{"data_capture.body_max_processing_size_bytes"}, issueFields(r.Errors))
+	assert.Equal(t, []string{"data_capture.body_max_size_bytes", "data_capture.allowed_content_types"}, issueFields(r.Warnings))
+
+	cfg.DataCapture.BodyMaxSizeBytes = Int32(100)
+	cfg.DataCapture.BodyMaxProcessingSizeBytes = Int32(10)
+	r = Validate(cfg)
+	assert.Empty(t, r.Errors)
+	assert.Contains(t, issueFields(r.Warnings), "data_capture.body_max_processing_size_bytes")
+}
+
+func TestValidateNilConfig(t *testing.T) {
+	assert.Error(t, Validate(nil).Err())
+}
@@ -33,9 +33,11 @@ func main() {
 	// Set up a connection to the server.
 	conn, err := grpc.Dial(
 		address,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock(),
-		grpc.WithUnaryInterceptor(hypergrpc.UnaryClientInterceptor()),
+		append(
+			hypergrpc.DialOptions(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithBlock(),
+		)...,
 	)
 	if err != nil {
 		log.Fatalf("could not connect: %v", err)
@@ -43,9 +43,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer(
-		grpc.UnaryInterceptor(hypergrpc.UnaryServerInterceptor()),
-	)
+	s := grpc.NewServer(hypergrpc.ServerOptions()...)
 
 	pb.RegisterGreeterServer(s, &server{})
 	if err := s.Serve(lis); err != nil {
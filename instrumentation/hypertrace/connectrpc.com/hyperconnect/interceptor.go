@@ -0,0 +1,22 @@
+package hyperconnect // import "github.com/hypertrace/goagent/instrumentation/hypertrace/connectrpc.com/hyperconnect"
+
+import (
+	"connectrpc.com/connect"
+	otelconnect "github.com/hypertrace/goagent/instrumentation/opentelemetry/connectrpc.com/hyperconnect"
+)
+
+// NewInterceptor returns an interceptor recording the request and response message's body and
+// metadata. Handlers are expected to be wrapped by hyperhttp.NewHandler and clients to use
+// hyperhttp.NewTransport so the trace context is propagated.
+//
+//	path, handler := greetv1connect.NewGreetServiceHandler(&server{},
+//		connect.WithInterceptors(hyperconnect.NewInterceptor()))
+//	mux.Handle(path, hyperhttp.NewHandler(handler, path))
+func NewInterceptor(opts ...Option) connect.Interceptor {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return otelconnect.NewInterceptor(o.toSDKOptions())
+}
@@ -0,0 +1,24 @@
+package hyperconnect // import "github.com/hypertrace/goagent/instrumentation/hypertrace/connectrpc.com/hyperconnect"
+
+import (
+	"github.com/hypertrace/goagent/sdk/filter"
+	sdkconnect "github.com/hypertrace/goagent/sdk/instrumentation/connectrpc.com/connect"
+)
+
+type options struct {
+	Filter filter.Filter
+}
+
+func (o *options) toSDKOptions() *sdkconnect.Options {
+	opts := (sdkconnect.Options)(*o)
+	return &opts
+}
+
+type Option func(o *options)
+
+// WithFilter adds a filter to the Connect option.
+func WithFilter(f filter.Filter) Option {
+	return func(o *options) {
+		o.Filter = f
+	}
+}
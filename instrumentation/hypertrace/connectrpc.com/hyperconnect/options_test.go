@@ -0,0 +1,15 @@
+package hyperconnect // import "github.com/hypertrace/goagent/instrumentation/hypertrace/connectrpc.com/hyperconnect"
+
+import (
+	"testing"
+
+	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsToSDK(t *testing.T) {
+	o := &options{
+		Filter: filter.NoopFilter{},
+	}
+	assert.Equal(t, filter.NoopFilter{}, o.toSDKOptions().Filter)
+}
@@ -0,0 +1,40 @@
+package hypersql // import "github.com/hypertrace/goagent/instrumentation/hypertrace/database/hypersql"
+
+import (
+	"time"
+
+	sdkSQL "github.com/hypertrace/goagent/sdk/instrumentation/database/sql"
+)
+
+type options struct {
+	SlowQueryThreshold time.Duration
+	ExplainSlowQueries bool
+	ExplainInterval    time.Duration
+	ExplainTimeout     time.Duration
+}
+
+func (o *options) toSDKOptions() *sdkSQL.Options {
+	opts := (sdkSQL.Options)(*o)
+	return &opts
+}
+
+type Option func(o *options)
+
+// WithSlowQueryThreshold flags queries taking longer than the threshold
+// with `db.slow=true` and a span event.
+func WithSlowQueryThreshold(threshold time.Duration) Option {
+	return func(o *options) {
+		o.SlowQueryThreshold = threshold
+	}
+}
+
+// WithSlowQueryExplain runs EXPLAIN for slow queries on PostgreSQL and MySQL,
+// at most once per interval and bounded by the timeout. Zero values fall back
+// to the defaults.
+func WithSlowQueryExplain(interval, timeout time.Duration) Option {
+	return func(o *options) {
+		o.ExplainSlowQueries = true
+		o.ExplainInterval = interval
+		o.ExplainTimeout = timeout
+	}
+}
@@ -0,0 +1,20 @@
+package hypersql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsToSDK(t *testing.T) {
+	o := &options{}
+	WithSlowQueryThreshold(time.Second)(o)
+	WithSlowQueryExplain(time.Minute, 0)(o)
+
+	sdkOpts := o.toSDKOptions()
+	assert.Equal(t, time.Second, sdkOpts.SlowQueryThreshold)
+	assert.True(t, sdkOpts.ExplainSlowQueries)
+	assert.Equal(t, time.Minute, sdkOpts.ExplainInterval)
+	assert.Zero(t, sdkOpts.ExplainTimeout)
+}
@@ -1,13 +1,29 @@
 package hypersql // import "github.com/hypertrace/goagent/instrumentation/hypertrace/database/hypersql"
 
 import (
+	"database/sql/driver"
+
 	otelsql "github.com/hypertrace/goagent/instrumentation/opentelemetry/database/hypersql"
 )
 
 // Wrap takes a SQL driver and wraps it with Hypertrace instrumentation.
-var Wrap = otelsql.Wrap
+func Wrap(d driver.Driver, opts ...Option) driver.Driver {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return otelsql.WrapWithOptions(d, o.toSDKOptions())
+}
 
 // Register initializes and registers the hypersql wrapped database driver
 // identified by its driverName. On success it
 // returns the generated driverName to use when calling sql.Open.
-var Register = otelsql.Register
+func Register(driverName string, opts ...Option) (string, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return otelsql.RegisterWithOptions(driverName, o.toSDKOptions())
+}
@@ -0,0 +1,26 @@
+package hypergqlgen // import "github.com/hypertrace/goagent/instrumentation/hypertrace/github.com/99designs/hypergqlgen"
+
+import (
+	sdkgqlgen "github.com/hypertrace/goagent/sdk/instrumentation/github.com/99designs/gqlgen"
+)
+
+type options struct {
+	FieldSpans    bool
+	MaxFieldDepth int
+}
+
+func (o *options) toSDKOptions() *sdkgqlgen.Options {
+	opts := (sdkgqlgen.Options)(*o)
+	return &opts
+}
+
+type Option func(o *options)
+
+// WithFieldSpans creates a span per resolver field up to maxDepth, root fields
+// being depth 1. Zero means no limit.
+func WithFieldSpans(maxDepth int) Option {
+	return func(o *options) {
+		o.FieldSpans = true
+		o.MaxFieldDepth = maxDepth
+	}
+}
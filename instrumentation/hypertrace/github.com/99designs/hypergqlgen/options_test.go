@@ -0,0 +1,16 @@
+package hypergqlgen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsToSDK(t *testing.T) {
+	o := &options{}
+	WithFieldSpans(3)(o)
+
+	sdkOpts := o.toSDKOptions()
+	assert.True(t, sdkOpts.FieldSpans)
+	assert.Equal(t, 3, sdkOpts.MaxFieldDepth)
+}
@@ -0,0 +1,20 @@
+package hypergqlgen // import "github.com/hypertrace/goagent/instrumentation/hypertrace/github.com/99designs/hypergqlgen"
+
+import (
+	"github.com/99designs/gqlgen/graphql"
+	otelgqlgen "github.com/hypertrace/goagent/instrumentation/opentelemetry/github.com/99designs/hypergqlgen"
+)
+
+// NewTracer returns a gqlgen extension creating a span per operation and, if enabled,
+// per resolver field. GraphQL errors are recorded as span errors.
+//
+//	srv := handler.NewDefaultServer(generated.NewExecutableSchema(cfg))
+//	srv.Use(hypergqlgen.NewTracer(hypergqlgen.WithFieldSpans(3)))
+func NewTracer(opts ...Option) graphql.HandlerExtension {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return otelgqlgen.NewTracer(o.toSDKOptions())
+}
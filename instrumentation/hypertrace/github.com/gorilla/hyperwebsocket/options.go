@@ -0,0 +1,26 @@
+package hyperwebsocket // import "github.com/hypertrace/goagent/instrumentation/hypertrace/github.com/gorilla/hyperwebsocket"
+
+import (
+	sdkwebsocket "github.com/hypertrace/goagent/sdk/instrumentation/websocket"
+)
+
+type options struct {
+	CaptureMessages  bool
+	MaxMessageEvents int
+}
+
+func (o *options) toSDKOptions() *sdkwebsocket.Options {
+	opts := (sdkwebsocket.Options)(*o)
+	return &opts
+}
+
+type Option func(o *options)
+
+// WithMessageCapture records an event per message in the span of the request,
+// up to maxEvents per connection. Zero falls back to the default.
+func WithMessageCapture(maxEvents int) Option {
+	return func(o *options) {
+		o.CaptureMessages = true
+		o.MaxMessageEvents = maxEvents
+	}
+}
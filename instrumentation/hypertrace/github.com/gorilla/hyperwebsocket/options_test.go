@@ -0,0 +1,16 @@
+package hyperwebsocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsToSDK(t *testing.T) {
+	o := &options{}
+	WithMessageCapture(10)(o)
+
+	sdkOpts := o.toSDKOptions()
+	assert.True(t, sdkOpts.CaptureMessages)
+	assert.Equal(t, 10, sdkOpts.MaxMessageEvents)
+}
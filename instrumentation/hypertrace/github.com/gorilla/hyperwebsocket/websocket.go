@@ -0,0 +1,24 @@
+package hyperwebsocket // import "github.com/hypertrace/goagent/instrumentation/hypertrace/github.com/gorilla/hyperwebsocket"
+
+import (
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	otelwebsocket "github.com/hypertrace/goagent/instrumentation/opentelemetry/github.com/gorilla/hyperwebsocket"
+)
+
+// Conn wraps a *websocket.Conn recording the messages going through ReadMessage,
+// WriteMessage, ReadJSON and WriteJSON.
+type Conn = otelwebsocket.Conn
+
+// Upgrade upgrades the HTTP server connection to the WebSocket protocol using the
+// upgrader. The handshake is recorded in its own span and, if enabled, the messages
+// are recorded as events in the span of the request.
+func Upgrade(upgrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request, responseHeader http.Header, opts ...Option) (*Conn, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return otelwebsocket.Upgrade(upgrader, w, r, responseHeader, o.toSDKOptions())
+}
@@ -0,0 +1,26 @@
+package hypergraphql // import "github.com/hypertrace/goagent/instrumentation/hypertrace/github.com/graph-gophers/hypergraphql"
+
+import (
+	sdkgraphqlgo "github.com/hypertrace/goagent/sdk/instrumentation/github.com/graph-gophers/graphql-go"
+)
+
+type options struct {
+	FieldSpans    bool
+	MaxFieldDepth int
+}
+
+func (o *options) toSDKOptions() *sdkgraphqlgo.Options {
+	opts := (sdkgraphqlgo.Options)(*o)
+	return &opts
+}
+
+type Option func(o *options)
+
+// WithFieldSpans creates a span per resolver field up to maxDepth, root fields
+// being depth 1. Zero means no limit.
+func WithFieldSpans(maxDepth int) Option {
+	return func(o *options) {
+		o.FieldSpans = true
+		o.MaxFieldDepth = maxDepth
+	}
+}
@@ -0,0 +1,20 @@
+package hypergraphql // import "github.com/hypertrace/goagent/instrumentation/hypertrace/github.com/graph-gophers/hypergraphql"
+
+import (
+	"github.com/graph-gophers/graphql-go/trace/tracer"
+	otelgraphql "github.com/hypertrace/goagent/instrumentation/opentelemetry/github.com/graph-gophers/hypergraphql"
+)
+
+// NewTracer returns a graphql-go tracer creating a span per operation and, if enabled,
+// per resolver field. GraphQL errors are recorded as span errors.
+//
+//	schema := graphql.MustParseSchema(schemaString, &resolver{},
+//		graphql.Tracer(hypergraphql.NewTracer(hypergraphql.WithFieldSpans(3))))
+func NewTracer(opts ...Option) tracer.Tracer {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return otelgraphql.NewTracer(o.toSDKOptions())
+}
@@ -0,0 +1,17 @@
+package hypergrpcgateway // import "github.com/hypertrace/goagent/instrumentation/hypertrace/github.com/grpc-ecosystem/hypergrpcgateway"
+
+import (
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	otelgateway "github.com/hypertrace/goagent/instrumentation/opentelemetry/github.com/grpc-ecosystem/hypergrpcgateway"
+)
+
+// WithSpanAnnotator returns a ServeMux option that tags the HTTP span with the gRPC
+// method the request is transcoded to (`rpc.service` and `rpc.method`) and propagates
+// its trace context to the gRPC server so both spans are correlated.
+//
+//	mux := runtime.NewServeMux(hypergrpcgateway.WithSpanAnnotator())
+//	_ = pb.RegisterGreeterHandlerFromEndpoint(ctx, mux, endpoint, dialOpts)
+//	http.ListenAndServe(":8080", hyperhttp.NewHandler(mux, "/"))
+func WithSpanAnnotator() runtime.ServeMuxOption {
+	return otelgateway.WithSpanAnnotator()
+}
@@ -1,20 +1,37 @@
 package hypergrpc // import "github.com/hypertrace/goagent/instrumentation/hypertrace/google.golang.org/hypergrpc"
 
 import (
-	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
-	"github.com/hypertrace/goagent/instrumentation/opentelemetry/grpcunaryinterceptors"
+	otelgrpc "github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc"
 	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
 	"google.golang.org/grpc"
 )
 
+// DialOptions returns the options instrumenting a gRPC client, suitable for use in a
+// grpc.NewClient call. A stats handler creates a span per RPC, unary or streaming, and
+// records the request/response body and metadata, while the interceptors evaluate the filter
+// on that span before the call is sent.
+//
+//	conn, err := grpc.NewClient(address, hypergrpc.DialOptions()...)
+func DialOptions(opts ...Option) []grpc.DialOption {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	statsHandler := otelgrpc.NewClientHandler()
+	return []grpc.DialOption{
+		grpc.WithStatsHandler(statsHandler),
+		grpc.WithChainUnaryInterceptor(otelgrpc.FilterUnaryClientInterceptor(statsHandler, o.toSDKOptions())),
+		grpc.WithChainStreamInterceptor(otelgrpc.FilterStreamClientInterceptor(statsHandler, o.toSDKOptions())),
+	}
+}
+
 // UnaryClientInterceptor returns a grpc.UnaryClientInterceptor suitable
 // for use in a grpc.Dial call.
-// Interceptor format will be replaced with the stats.Handler since instrumentation has moved to the stats.Handler.
-// See: https://github.com/open-telemetry/opentelemetry-go-contrib/blob/v1.36.0/instrumentation/google.golang.org/grpc/otelgrpc/example_test.go
+//
+// Deprecated: use DialOptions, which also instruments streaming RPCs. The interceptor
+// reports the unary RPCs to the same stats handler, hence it must not be used along with
+// DialOptions.
 func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
-	return sdkgrpc.WrapUnaryClientInterceptor(
-		grpcunaryinterceptors.UnaryClientInterceptor(),
-		opentelemetry.SpanFromContext,
-		map[string]string{},
-	)
+	return sdkgrpc.StatsHandlerUnaryClientInterceptor(otelgrpc.NewClientHandler())
 }
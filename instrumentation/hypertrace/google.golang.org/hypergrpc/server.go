@@ -1,26 +1,49 @@
 package hypergrpc // import "github.com/hypertrace/goagent/instrumentation/hypertrace/google.golang.org/hypergrpc"
 
 import (
-	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
-	"github.com/hypertrace/goagent/instrumentation/opentelemetry/grpcunaryinterceptors"
+	"context"
+
+	otelgrpc "github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc"
 	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
 	"google.golang.org/grpc"
 )
 
+// ServerOptions returns the options instrumenting a gRPC server, suitable for use in a
+// grpc.NewServer call. A stats handler creates a span per RPC, unary or streaming, and
+// records the request/response body and metadata, while the interceptors evaluate the filter
+// as only them can block a request.
+//
+//	s := grpc.NewServer(hypergrpc.ServerOptions()...)
+func ServerOptions(opts ...Option) []grpc.ServerOption {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(otelgrpc.FilterUnaryServerInterceptor(o.toSDKOptions())),
+		grpc.ChainStreamInterceptor(otelgrpc.FilterStreamServerInterceptor(o.toSDKOptions())),
+	}
+}
+
 // UnaryServerInterceptor returns a grpc.UnaryServerInterceptor suitable
 // for use in a grpc.NewServer call.
-// Interceptor format will be replaced with the stats.Handler since instrumentation has moved to the stats.Handler.
-// See: https://github.com/open-telemetry/opentelemetry-go-contrib/blob/v1.36.0/instrumentation/google.golang.org/grpc/otelgrpc/example_test.go
+//
+// Deprecated: use ServerOptions, which also instruments streaming RPCs. The interceptor
+// reports the unary RPCs to the same stats handler, hence it must not be used along with
+// ServerOptions.
 func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
 	o := &options{}
 	for _, opt := range opts {
 		opt(o)
 	}
 
-	return sdkgrpc.WrapUnaryServerInterceptor(
-		grpcunaryinterceptors.UnaryServerInterceptor(),
-		opentelemetry.SpanFromContext,
-		o.toSDKOptions(),
-		map[string]string{},
-	)
+	statsInterceptor := sdkgrpc.StatsHandlerUnaryServerInterceptor(otelgrpc.NewServerHandler())
+	filterInterceptor := otelgrpc.FilterUnaryServerInterceptor(o.toSDKOptions())
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return statsInterceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return filterInterceptor(ctx, req, info, handler)
+		})
+	}
 }
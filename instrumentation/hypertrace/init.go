@@ -8,4 +8,45 @@ import (
 // on a termination signal.
 var Init = opentelemetry.Init
 
+// New initializes hypertrace tracing and returns the agent handle.
+var New = opentelemetry.New
+
+// TryInit is like Init but returns an error if tracing can't be set up, or falls back to
+// noop tracing if WithDegradedMode is passed.
+var TryInit = opentelemetry.TryInit
+
 var RegisterService = opentelemetry.RegisterService
+
+type (
+	Agent             = opentelemetry.Agent
+	Option            = opentelemetry.Option
+	ReportingTarget   = opentelemetry.ReportingTarget
+	PrometheusOptions = opentelemetry.PrometheusOptions
+	HealthEvent       = opentelemetry.HealthEvent
+	HealthHook        = opentelemetry.HealthHook
+	HealthStatus      = opentelemetry.HealthStatus
+)
+
+const (
+	HealthOK       = opentelemetry.HealthOK
+	HealthDegraded = opentelemetry.HealthDegraded
+	HealthFailed   = opentelemetry.HealthFailed
+)
+
+var (
+	WithDegradedMode          = opentelemetry.WithDegradedMode
+	WithHealthHook            = opentelemetry.WithHealthHook
+	WithServiceOptions        = opentelemetry.WithServiceOptions
+	WithLogger                = opentelemetry.WithLogger
+	WithSpanProcessorWrapper  = opentelemetry.WithSpanProcessorWrapper
+	WithVersionInfoAttributes = opentelemetry.WithVersionInfoAttributes
+	WithResourceAttributes    = opentelemetry.WithResourceAttributes
+	WithSampler               = opentelemetry.WithSampler
+	WithExporterFactory       = opentelemetry.WithExporterFactory
+	WithPropagator            = opentelemetry.WithPropagator
+	WithMeterProvider         = opentelemetry.WithMeterProvider
+	WithIDGenerator           = opentelemetry.WithIDGenerator
+	WithReportingTarget       = opentelemetry.WithReportingTarget
+	WithRetryQueue            = opentelemetry.WithRetryQueue
+	WithPrometheusReader      = opentelemetry.WithPrometheusReader
+)
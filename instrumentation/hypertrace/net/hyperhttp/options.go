@@ -2,11 +2,18 @@ package hyperhttp // import "github.com/hypertrace/goagent/instrumentation/hyper
 
 import (
 	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
 	"github.com/hypertrace/goagent/sdk/instrumentation/net/http"
 )
 
 type options struct {
-	Filter filter.Filter
+	Filter             filter.Filter
+	StreamingEvents    bool
+	MaxStreamingEvents int
+	GraphQL            bool
+	GraphQLSpanName    bool
+	BodyPolicy         bodyattribute.Policy
+	BodyDecoders       bodyattribute.Decoders
 }
 
 func (o *options) toSDKOptions() *http.Options {
@@ -21,3 +28,57 @@ func WithFilter(f filter.Filter) Option {
 		o.Filter = f
 	}
 }
+
+// WithStreamingEvents records streamed responses as span events, one per
+// Server-Sent Event or one per flushed chunk, up to maxEvents per response.
+// Zero falls back to the default.
+func WithStreamingEvents(maxEvents int) Option {
+	return func(o *options) {
+		o.StreamingEvents = true
+		o.MaxStreamingEvents = maxEvents
+	}
+}
+
+// WithGraphQL detects GraphQL requests and records the operation name, type and
+// normalized document. When renameSpan is true the span is named after the operation,
+// e.g. "query GetUser".
+func WithGraphQL(renameSpan bool) Option {
+	return func(o *options) {
+		o.GraphQL = true
+		o.GraphQLSpanName = renameSpan
+	}
+}
+
+// WithBodyEncoding sets how the bodies of the given media type, e.g. "image/png"
+// or "image/*", are recorded: raw, base64 encoded, hashed or only their size.
+// By default binary bodies are base64 encoded and any other is recorded raw.
+func WithBodyEncoding(mediaType string, encoding bodyattribute.Encoding) Option {
+	return func(o *options) {
+		if o.BodyPolicy == nil {
+			o.BodyPolicy = bodyattribute.Policy{}
+		}
+		o.BodyPolicy[mediaType] = encoding
+	}
+}
+
+// WithBodyDecoder records the bodies of the given media type, e.g. "application/x-protobuf",
+// in the form returned by the decoder. Bodies with a decoder are captured even if their
+// content type isn't allowed by the config.
+func WithBodyDecoder(mediaType string, decoder bodyattribute.Decoder) Option {
+	return func(o *options) {
+		if o.BodyDecoders == nil {
+			o.BodyDecoders = bodyattribute.Decoders{}
+		}
+		o.BodyDecoders[mediaType] = decoder
+	}
+}
+
+// WithDefaultBodyDecoders records urlencoded forms as JSON objects with the values per
+// key and protobuf messages as JSON using the descriptors in protoregistry.GlobalFiles.
+func WithDefaultBodyDecoders() Option {
+	return func(o *options) {
+		for mediaType, decoder := range bodyattribute.DefaultDecoders() {
+			WithBodyDecoder(mediaType, decoder)(o)
+		}
+	}
+}
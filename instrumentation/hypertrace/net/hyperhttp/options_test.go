@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,3 +14,43 @@ func TestOptionsToSDK(t *testing.T) {
 	}
 	assert.Equal(t, filter.NoopFilter{}, o.toSDKOptions().Filter)
 }
+
+func TestStreamingEventsOptionToSDK(t *testing.T) {
+	o := &options{}
+	WithStreamingEvents(10)(o)
+
+	sdkOpts := o.toSDKOptions()
+	assert.True(t, sdkOpts.StreamingEvents)
+	assert.Equal(t, 10, sdkOpts.MaxStreamingEvents)
+}
+
+func TestGraphQLOptionToSDK(t *testing.T) {
+	o := &options{}
+	WithGraphQL(true)(o)
+
+	sdkOpts := o.toSDKOptions()
+	assert.True(t, sdkOpts.GraphQL)
+	assert.True(t, sdkOpts.GraphQLSpanName)
+}
+
+func TestBodyEncodingOptionToSDK(t *testing.T) {
+	o := &options{}
+	WithBodyEncoding("image/*", bodyattribute.EncodingSize)(o)
+	WithBodyEncoding("application/octet-stream", bodyattribute.EncodingHash)(o)
+
+	assert.Equal(t, bodyattribute.Policy{
+		"image/*":                  bodyattribute.EncodingSize,
+		"application/octet-stream": bodyattribute.EncodingHash,
+	}, o.toSDKOptions().BodyPolicy)
+}
+
+func TestBodyDecoderOptionToSDK(t *testing.T) {
+	o := &options{}
+	WithDefaultBodyDecoders()(o)
+	WithBodyDecoder("application/x-www-form-urlencoded", nil)(o)
+
+	decoders := o.toSDKOptions().BodyDecoders
+	assert.True(t, decoders.Supports("application/x-protobuf"))
+	assert.True(t, decoders.Supports("application/grpc-web+proto"))
+	assert.Nil(t, decoders["application/x-www-form-urlencoded"])
+}
@@ -10,8 +10,19 @@ import (
 
 // NewTransport wraps the provided http.RoundTripper with one that
 // starts a span and injects the span context into the outbound request headers.
-func NewTransport(base http.RoundTripper) http.RoundTripper {
+// The filter in the options is evaluated on that span before the request is sent.
+func NewTransport(base http.RoundTripper, opts ...Option) http.RoundTripper {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	return otelhttp.NewTransport(
-		sdkhttp.WrapTransport(base, opentelemetry.SpanFromContext, map[string]string{}),
+		sdkhttp.WrapTransportWithOptions(base, opentelemetry.SpanFromContext, o.toSDKOptions(), map[string]string{}),
 	)
 }
+
+// ContextWithAttemptTracking returns a context that allows telling apart the
+// attempts done for the same request, e.g. by a retry middleware. The returned
+// context has to be used in every attempt.
+var ContextWithAttemptTracking = sdkhttp.ContextWithAttemptTracking
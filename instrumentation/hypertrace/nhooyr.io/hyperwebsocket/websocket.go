@@ -0,0 +1,23 @@
+package hyperwebsocket // import "github.com/hypertrace/goagent/instrumentation/hypertrace/nhooyr.io/hyperwebsocket"
+
+import (
+	"net/http"
+
+	otelwebsocket "github.com/hypertrace/goagent/instrumentation/opentelemetry/nhooyr.io/hyperwebsocket"
+	"nhooyr.io/websocket"
+)
+
+// Conn wraps a *websocket.Conn recording the messages going through Read and Write.
+type Conn = otelwebsocket.Conn
+
+// Accept accepts a WebSocket handshake from a client and upgrades the connection.
+// The handshake is recorded in its own span and, if enabled, the messages are
+// recorded as events in the span of the request.
+func Accept(w http.ResponseWriter, r *http.Request, acceptOptions *websocket.AcceptOptions, opts ...Option) (*Conn, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return otelwebsocket.Accept(w, r, acceptOptions, o.toSDKOptions())
+}
@@ -0,0 +1,317 @@
+package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/opentelemetry"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/go-logr/zapr"
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/errorhandler"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/metrics"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/retryqueue"
+	"github.com/hypertrace/goagent/sdk"
+	sdkconfig "github.com/hypertrace/goagent/sdk/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+)
+
+// errAlreadyInitialized is returned by New when the agent is already running.
+var errAlreadyInitialized = errors.New("hypertrace has already been initialized")
+
+// Agent is a handle to the running agent returned by New.
+type Agent struct {
+	tp               *sdktrace.TracerProvider
+	wrapper          SpanProcessorWrapper
+	versionInfoAttrs []attribute.KeyValue
+	shutdownFn       func(context.Context) error
+	shutdownOnce     sync.Once
+	shutdownErr      error
+}
+
+// New initializes opentelemetry tracing and metrics as configured in cfg and returns the
+// agent handle. Only one agent can run at a time, New fails if it is already initialized
+// until the running one is shut down. If a component can't be set up it returns the error
+// or, with WithDegradedMode, falls back to noop tracing.
+func New(cfg *config.AgentConfig, opts ...Option) (*Agent, error) {
+	o := newOptions(opts)
+	if o.useDefaultLogger {
+		o.logger = newDefaultLogger()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if initialized {
+		return nil, errAlreadyInitialized
+	}
+	sdkconfig.InitConfig(cfg)
+
+	a := &Agent{wrapper: o.wrapper, versionInfoAttrs: o.versionInfoAttrs}
+
+	enabled = cfg.GetEnabled().Value
+	if !enabled {
+		o.report(HealthEvent{Status: HealthOK})
+		a.shutdownFn = initNoop(cfg, o)
+		return a, nil
+	}
+
+	if o.logger != nil {
+		_ = zap.ReplaceGlobals(o.logger.With(zap.String("service", "hypertrace")))
+
+		// initialize opentelemetry's internal logger
+		logr := zapr.NewLogger(o.logger)
+		otel.SetLogger(logr)
+
+		// initialize opentelemetry's internal error handler
+		errorhandler.Init(o.logger)
+	}
+
+	healthy := true
+
+	// Initialize metrics
+	metricsShutdownFn := func() {}
+	metricsAttrs := append(append([]attribute.KeyValue{}, o.versionInfoAttrs...), o.resourceAttrs...)
+	if o.meterProvider != nil {
+		otel.SetMeterProvider(o.meterProvider)
+		metrics.InitializeSystemMetrics()
+	} else if shutdownFn, err := initializeMetrics(cfg, metricsAttrs, o.prometheus, o.serviceOpts...); err != nil {
+		if !o.reportFailure(ComponentMetricsExporter, err) {
+			sdkconfig.ResetConfig()
+			return nil, err
+		}
+		healthy = false
+	} else {
+		metricsShutdownFn = shutdownFn
+	}
+
+	exporterFactory = o.exporterFactory
+	if exporterFactory == nil {
+		exporterFactory = makeExporterFactory(cfg)
+	}
+	if o.systemRootsFallback {
+		factory := exporterFactory
+		exporterFactory = func(opts ...ServiceOption) (sdktrace.SpanExporter, error) {
+			return factory(append(append([]ServiceOption{}, opts...), systemRootsFallback)...)
+		}
+	}
+	configFactory = makeConfigFactory(cfg)
+
+	exporter, err := exporterFactory(o.serviceOpts...)
+	if err == nil {
+		exporter, err = o.wrapWithRetryQueue(exporter)
+	}
+	if err != nil {
+		metricsShutdownFn()
+		return a.initFailed(cfg, o, ComponentTraceExporter, fmt.Errorf("failed to create trace exporter: %w", err))
+	}
+
+	// the targets failing in degraded mode are left out, also for the services registered afterwards.
+	exporters := []sdktrace.SpanExporter{exporter}
+	targets := make([]targetExporterFactory, 0, len(o.targets))
+	for _, target := range o.targets {
+		target := makeTargetExporterFactory(cfg, target)
+		targetExporter, err := target.factory(o.serviceOpts...)
+		if err != nil {
+			if !o.reportFailure(ComponentTraceExporter, err) {
+				metricsShutdownFn()
+				shutdownExporters(exporters)
+				sdkconfig.ResetConfig()
+				return nil, err
+			}
+			log.Printf("spans aren't reported to target %q: %v\n", target.name, err)
+			healthy = false
+			continue
+		}
+		exporters = append(exporters, targetExporter)
+		targets = append(targets, target)
+	}
+
+	resourceAttrs := createResources(getResourceAttrsWithServiceName(cfg.ResourceAttributes, cfg.GetServiceName().GetValue()),
+		o.versionInfoAttrs)
+	resources, err := resource.New(
+		context.Background(),
+		resource.WithAttributes(append(resourceAttrs, o.resourceAttrs...)...),
+	)
+	if err != nil {
+		metricsShutdownFn()
+		shutdownExporters(exporters)
+		return a.initFailed(cfg, o, ComponentResource, fmt.Errorf("failed to create resource: %w", err))
+	}
+
+	sps := newSpanProcessors(shouldUseCustomBatchSpanProcessor(cfg), exporters, o.wrapper)
+
+	// sampling follows the config updates, e.g. no span is sampled if the agent gets disabled.
+	sampler := &configSampler{delegate: o.sampler}
+	unsubscribeSampler := sdkconfig.Subscribe(sampler.update)
+
+	tpOpts := append([]sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(resources),
+	}, withSpanProcessors(sps)...)
+	if o.idGenerator != nil {
+		tpOpts = append(tpOpts, sdktrace.WithIDGenerator(o.idGenerator))
+	}
+	tp := sdktrace.NewTracerProvider(tpOpts...)
+	otel.SetTracerProvider(tp)
+
+	otel.SetTextMapPropagator(o.makePropagator(cfg))
+
+	traceProviders = make(map[string]*sdktrace.TracerProvider)
+	globalSampler = sampler
+	globalIDGenerator = o.idGenerator
+	targetExporterFactories = targets
+	initialized = true
+
+	startSpanFn := startSpan(func() trace.TracerProvider {
+		return tp
+	})
+
+	// Startup span
+	if cfg.GetTelemetry().GetStartupSpanEnabled().GetValue() {
+		_, span, ender := startSpanFn(context.Background(), "startup", &sdk.SpanOptions{})
+		span.SetAttribute("hypertrace.agent.startup", true)
+		ender()
+	}
+
+	if healthy {
+		o.report(HealthEvent{Status: HealthOK})
+	}
+
+	a.tp = tp
+	a.shutdownFn = func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var errs []error
+		for key, tracerProvider := range traceProviders {
+			if err := tracerProvider.Shutdown(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("error while shutting down tracer provider %q: %w", key, err))
+			}
+			delete(traceProviders, key)
+		}
+		traceProviders = map[string]*sdktrace.TracerProvider{}
+		if err := tp.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("error while shutting down default tracer provider: %w", err))
+		}
+
+		metricsShutdownFn()
+		unsubscribeSampler()
+		initialized = false
+		enabled = false
+		globalIDGenerator = nil
+		targetExporterFactories = nil
+		sdkconfig.ResetConfig()
+		return errors.Join(errs...)
+	}
+	return a, nil
+}
+
+// initNoop sets up noop tracing, used when the agent is disabled or as fallback in
+// degraded mode. Callers must hold mu.
+func initNoop(cfg *config.AgentConfig, o *options) func(context.Context) error {
+	initialized = true
+	enabled = false
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	// even if the tracer isn't enabled, propagation is still enabled
+	// to not break the full workflow of the tracing system. Even
+	// if this service will not report spans and the trace might look
+	// broken, spans can still be grouped by trace ID.
+	otel.SetTextMapPropagator(o.makePropagator(cfg))
+	return func(context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		initialized = false
+		sdkconfig.ResetConfig()
+		return nil
+	}
+}
+
+// initFailed reports a failing component and either falls back to noop tracing in degraded
+// mode or returns the error. Callers must hold mu.
+func (a *Agent) initFailed(cfg *config.AgentConfig, o *options, component string, err error) (*Agent, error) {
+	if !o.reportFailure(component, err) {
+		sdkconfig.ResetConfig()
+		return nil, err
+	}
+
+	log.Printf("tracing falls back to noop: %v\n", err)
+	a.shutdownFn = initNoop(cfg, o)
+	return a, nil
+}
+
+// wrapWithRetryQueue wraps the exporter with the retry queue if one is configured, the
+// exporter is shut down if the queue can't be opened.
+func (o *options) wrapWithRetryQueue(exporter sdktrace.SpanExporter) (sdktrace.SpanExporter, error) {
+	if o.retryQueue == nil {
+		return exporter, nil
+	}
+
+	queued, err := retryqueue.New(exporter, *o.retryQueue)
+	if err != nil {
+		_ = exporter.Shutdown(context.Background())
+		return nil, fmt.Errorf("failed to open retry queue: %w", err)
+	}
+	return queued, nil
+}
+
+func (o *options) makePropagator(cfg *config.AgentConfig) propagation.TextMapPropagator {
+	if o.propagator != nil {
+		return o.propagator
+	}
+	return makePropagator(cfg.PropagationFormats)
+}
+
+// TracerProvider returns the tracer provider of the agent, a noop one if the agent is
+// disabled or runs in degraded mode.
+func (a *Agent) TracerProvider() trace.TracerProvider {
+	if a.tp == nil {
+		return noop.NewTracerProvider()
+	}
+	return a.tp
+}
+
+// RegisterService creates a tracer provider for a new service (represented via a unique key)
+// using the span processor wrapper and version info the agent was created with.
+func (a *Agent) RegisterService(key string, resourceAttributes map[string]string, opts ...ServiceOption) (sdk.StartSpan, trace.TracerProvider, error) {
+	return RegisterServiceWithSpanProcessorWrapper(key, resourceAttributes, a.wrapper, a.versionInfoAttrs, opts...)
+}
+
+// ForceFlush exports the spans buffered by the agent and the registered services.
+func (a *Agent) ForceFlush(ctx context.Context) error {
+	if a.tp == nil {
+		return nil
+	}
+
+	mu.Lock()
+	providers := make([]*sdktrace.TracerProvider, 0, len(traceProviders)+1)
+	providers = append(providers, a.tp)
+	for _, tp := range traceProviders {
+		providers = append(providers, tp)
+	}
+	mu.Unlock()
+
+	var errs []error
+	for _, tp := range providers {
+		if err := tp.ForceFlush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown flushes the buffered spans and stops the agent and the registered services,
+// afterwards a new agent can be created. Only the first call has effect.
+func (a *Agent) Shutdown(ctx context.Context) error {
+	a.shutdownOnce.Do(func() {
+		a.shutdownErr = a.shutdownFn(ctx)
+	})
+	return a.shutdownErr
+}
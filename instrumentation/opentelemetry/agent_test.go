@@ -0,0 +1,167 @@
+package opentelemetry
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hypertrace/goagent/config"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/retryqueue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type fixedIDGenerator struct{}
+
+func (fixedIDGenerator) NewIDs(context.Context) (trace.TraceID, trace.SpanID) {
+	return trace.TraceID{1}, trace.SpanID{1}
+}
+
+func (fixedIDGenerator) NewSpanID(context.Context, trace.TraceID) trace.SpanID {
+	return trace.SpanID{2}
+}
+
+func TestNew(t *testing.T) {
+	cfg := config.Load()
+	cfg.ServiceName = config.String("my_service")
+	cfg.Telemetry.StartupSpanEnabled = config.Bool(false)
+
+	recorder := tracetesting.NewRecorder()
+	wrapper := &mockSpanProcessorWrapper{}
+	agent, err := New(cfg,
+		WithLogger(nil),
+		WithExporterFactory(func(...ServiceOption) (sdktrace.SpanExporter, error) {
+			return recorder, nil
+		}),
+		WithSpanProcessorWrapper(wrapper),
+		WithResourceAttributes(attribute.String("deployment.environment", "test")),
+		WithSampler(sdktrace.TraceIDRatioBased(1)),
+		WithIDGenerator(fixedIDGenerator{}),
+		WithPropagator(propagation.Baggage{}),
+		WithMeterProvider(metricnoop.NewMeterProvider()),
+	)
+	require.NoError(t, err)
+	defer agent.Shutdown(context.Background())
+
+	assert.Equal(t, agent.TracerProvider(), otel.GetTracerProvider())
+	assert.Equal(t, propagation.Baggage{}, otel.GetTextMapPropagator())
+
+	_, span := agent.TracerProvider().Tracer("test").Start(context.Background(), "my_span")
+	span.End()
+	require.NoError(t, agent.ForceFlush(context.Background()))
+
+	spans := recorder.Flush()
+	require.Len(t, spans, 1)
+	assert.Equal(t, trace.TraceID{1}, spans[0].SpanContext().TraceID())
+	resourceAttrs := tracetesting.LookupAttributes(spans[0].Resource().Attributes())
+	assert.Equal(t, "test", resourceAttrs.Get("deployment.environment").AsString())
+	assert.Equal(t, "my_service", resourceAttrs.Get("service.name").AsString())
+	assert.Equal(t, 1, wrapper.onEndCount)
+
+	// registered services use the options of the agent
+	startSpan, _, err := agent.RegisterService("custom_service", map[string]string{"service.name": "custom_service"})
+	require.NoError(t, err)
+	_, _, ender := startSpan(context.Background(), "service_span", nil)
+	ender()
+	require.NoError(t, agent.ForceFlush(context.Background()))
+
+	spans = recorder.Flush()
+	require.Len(t, spans, 1)
+	assert.Equal(t, trace.TraceID{1}, spans[0].SpanContext().TraceID())
+	assert.Equal(t, 2, wrapper.onEndCount)
+
+	// only one agent runs at a time
+	_, err = New(cfg, WithLogger(nil))
+	assert.Error(t, err)
+
+	require.NoError(t, agent.Shutdown(context.Background()))
+	// shutdown only has effect once
+	require.NoError(t, agent.Shutdown(context.Background()))
+
+	agent, err = New(cfg, WithLogger(nil), WithExporterFactory(func(...ServiceOption) (sdktrace.SpanExporter, error) {
+		return recorder, nil
+	}))
+	require.NoError(t, err)
+	require.NoError(t, agent.Shutdown(context.Background()))
+}
+
+func TestNewDisabledAgent(t *testing.T) {
+	cfg := config.Load()
+	cfg.Enabled = config.Bool(false)
+
+	agent, err := New(cfg, WithLogger(nil))
+	require.NoError(t, err)
+	defer agent.Shutdown(context.Background())
+
+	assert.Equal(t, noop.NewTracerProvider(), agent.TracerProvider())
+	assert.NoError(t, agent.ForceFlush(context.Background()))
+
+	startSpan, _, err := agent.RegisterService("test_service", nil)
+	require.NoError(t, err)
+	_, s, _ := startSpan(context.Background(), "test_span", nil)
+	assert.True(t, s.IsNoop())
+}
+
+// failingExporter fails every export.
+type failingExporter struct{}
+
+func (failingExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error {
+	return errors.New("endpoint is down")
+}
+
+func (failingExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+func TestNewWithRetryQueue(t *testing.T) {
+	cfg := config.Load()
+	cfg.ServiceName = config.String("my_service")
+	cfg.Telemetry.StartupSpanEnabled = config.Bool(false)
+
+	dir := t.TempDir()
+	agent, err := New(cfg,
+		WithLogger(nil),
+		WithExporterFactory(func(...ServiceOption) (sdktrace.SpanExporter, error) {
+			return failingExporter{}, nil
+		}),
+		WithMeterProvider(metricnoop.NewMeterProvider()),
+		WithRetryQueue(retryqueue.Options{Dir: dir, InitialInterval: time.Hour}),
+	)
+	require.NoError(t, err)
+
+	_, span := agent.TracerProvider().Tracer("test").Start(context.Background(), "my_span")
+	span.End()
+	require.NoError(t, agent.Shutdown(context.Background()))
+
+	// the batch is kept for the next run
+	batches, err := filepath.Glob(filepath.Join(dir, "*.batch"))
+	require.NoError(t, err)
+	assert.Len(t, batches, 1)
+
+	recorder := tracetesting.NewRecorder()
+	agent, err = New(cfg,
+		WithLogger(nil),
+		WithExporterFactory(func(...ServiceOption) (sdktrace.SpanExporter, error) {
+			return recorder, nil
+		}),
+		WithMeterProvider(metricnoop.NewMeterProvider()),
+		WithRetryQueue(retryqueue.Options{Dir: dir, InitialInterval: time.Millisecond}),
+	)
+	require.NoError(t, err)
+	defer agent.Shutdown(context.Background())
+
+	assert.Eventually(t, func() bool {
+		spans := recorder.Flush()
+		return len(spans) == 1 && spans[0].Name() == "my_span"
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,167 @@
+package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/opentelemetry"
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileStamp identifies a version of a file on disk.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(name string) (fileStamp, error) {
+	info, err := os.Stat(filepath.Clean(name))
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// certReloader holds the CA and client certificates loaded from the cert files. The files are
+// checked on every handshake and reloaded when they change on disk, so rotated certificates
+// are used by the next connections without restarting. If a changed file can't be loaded,
+// e.g. the key was written but not the cert yet, the previous certificates are kept until
+// the next handshake.
+type certReloader struct {
+	caFile   string
+	certFile string
+	keyFile  string
+
+	mu         sync.Mutex
+	rootCAs    *x509.CertPool
+	caStamp    fileStamp
+	clientCert *tls.Certificate
+	certStamps [2]fileStamp
+	// the last failures are tracked apart as both are reloaded on every handshake.
+	lastCAFailure   string
+	lastCertFailure string
+}
+
+// newCertReloader loads the cert files, failing if they can't be loaded. Empty file names
+// are ignored.
+func newCertReloader(caFile, certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{caFile: caFile, certFile: certFile, keyFile: keyFile}
+
+	if len(caFile) > 0 {
+		if err := r.reloadRootCAs(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		if err := r.reloadClientCert(); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *certReloader) reloadRootCAs() error {
+	stamp, err := statFile(r.caFile)
+	if err != nil {
+		return fmt.Errorf("failed to read cert file %s: %w", r.caFile, err)
+	}
+	if r.rootCAs != nil && stamp == r.caStamp {
+		return nil
+	}
+
+	certPool, err := loadCertPool(r.caFile)
+	if err != nil {
+		return err
+	}
+	r.rootCAs, r.caStamp = certPool, stamp
+	return nil
+}
+
+func (r *certReloader) reloadClientCert() error {
+	certStamp, err := statFile(r.certFile)
+	if err != nil {
+		return fmt.Errorf("failed to load client certificate %s: %w", r.certFile, err)
+	}
+	keyStamp, err := statFile(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load client certificate %s: %w", r.certFile, err)
+	}
+	stamps := [2]fileStamp{certStamp, keyStamp}
+	if r.clientCert != nil && stamps == r.certStamps {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load client certificate %s: %w", r.certFile, err)
+	}
+	r.clientCert, r.certStamps = &cert, stamps
+	return nil
+}
+
+// logFailure logs the reload failures once until the reload succeeds again, so a missing
+// file doesn't log on every handshake. lastFailure is the last failure of the same reload.
+func logFailure(lastFailure *string, err error) {
+	if err == nil {
+		*lastFailure = ""
+		return
+	}
+	if err.Error() != *lastFailure {
+		*lastFailure = err.Error()
+		log.Printf("failed to reload certificates, using the previous ones: %v\n", err)
+	}
+}
+
+// currentRootCAs returns the CA certificates, reloaded if the cert file changed.
+func (r *certReloader) currentRootCAs() *x509.CertPool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	logFailure(&r.lastCAFailure, r.reloadRootCAs())
+	return r.rootCAs
+}
+
+// getClientCertificate returns the client certificate, reloaded if the cert or key file
+// changed. It is meant for tls.Config.GetClientCertificate.
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	logFailure(&r.lastCertFailure, r.reloadClientCert())
+	return r.clientCert, nil
+}
+
+// verifyConnection returns a function verifying the server certificate against the current
+// CA certificates, meant for tls.Config.VerifyConnection. The default verification can't be
+// used as tls.Config.RootCAs can't change once the config is handed to the exporters.
+// serverName is verified if the handshake has no server name, i.e. for IP addresses.
+func (r *certReloader) verifyConnection(serverName string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("tls: server didn't provide a certificate")
+		}
+
+		name := cs.ServerName
+		if len(name) == 0 {
+			name = serverName
+		}
+
+		opts := x509.VerifyOptions{
+			Roots:         r.currentRootCAs(),
+			DNSName:       name,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+}
@@ -0,0 +1,138 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rotateFile replaces the content of the file, moving its modification time forward as the
+// rotation can happen within the file system time granularity.
+func rotateFile(t *testing.T, path string, content []byte) {
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, content, 0600))
+	modTime := info.ModTime().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func clientCertCN(t *testing.T, r *certReloader) string {
+	cert, err := r.getClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloaderReloadsClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+
+	certPEM, keyPEM := ca.issue(t, "goagent", x509.ExtKeyUsageClientAuth)
+	certFile := writeFile(t, dir, "client.crt", certPEM)
+	keyFile := writeFile(t, dir, "client.key", keyPEM)
+
+	r, err := newCertReloader("", certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "goagent", clientCertCN(t, r))
+
+	rotatedCertPEM, rotatedKeyPEM := ca.issue(t, "goagent-rotated", x509.ExtKeyUsageClientAuth)
+
+	// the cert doesn't match the key until both are rotated
+	rotateFile(t, certFile, rotatedCertPEM)
+	assert.Equal(t, "goagent", clientCertCN(t, r))
+
+	rotateFile(t, keyFile, rotatedKeyPEM)
+	assert.Equal(t, "goagent-rotated", clientCertCN(t, r))
+}
+
+func TestCertReloaderReloadsRootCAs(t *testing.T) {
+	ca := newTestCA(t)
+	caFile := writeFile(t, t.TempDir(), "ca.crt", ca.certPEM)
+
+	r, err := newCertReloader(caFile, "", "")
+	require.NoError(t, err)
+	assert.Nil(t, r.clientCert)
+
+	pool := r.currentRootCAs()
+	assert.Same(t, pool, r.currentRootCAs(), "unchanged file shouldn't be reloaded")
+
+	rotatedCA := newTestCA(t)
+	rotateFile(t, caFile, rotatedCA.certPEM)
+
+	rotatedPool := x509.NewCertPool()
+	rotatedPool.AddCert(rotatedCA.cert)
+	assert.True(t, rotatedPool.Equal(r.currentRootCAs()))
+
+	// a removed file keeps the previous CA certificates
+	require.NoError(t, os.Remove(caFile))
+	assert.True(t, rotatedPool.Equal(r.currentRootCAs()))
+}
+
+func TestCertReloaderLogsEachFailureOnce(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	caFile := writeFile(t, dir, "ca.crt", ca.certPEM)
+	certPEM, keyPEM := ca.issue(t, "goagent", x509.ExtKeyUsageClientAuth)
+	certFile := writeFile(t, dir, "client.crt", certPEM)
+	keyFile := writeFile(t, dir, "client.key", keyPEM)
+
+	r, err := newCertReloader(caFile, certFile, keyFile)
+	require.NoError(t, err)
+
+	// the CA reloads fine while the client cert is broken
+	rotateFile(t, certFile, []byte("broken"))
+	for i := 0; i < 3; i++ {
+		r.currentRootCAs()
+		assert.Equal(t, "goagent", clientCertCN(t, r))
+	}
+	assert.Equal(t, 1, strings.Count(logs.String(), "failed to reload certificates"))
+}
+
+func TestCertReloaderFailsOnInvalidFiles(t *testing.T) {
+	_, err := newCertReloader("testdata/fakeRootCA.crt", "", "")
+	assert.Error(t, err)
+
+	_, err = newCertReloader("", "testdata/rootCA.crt", "testdata/nonExistent.key")
+	assert.Error(t, err)
+
+	_, err = newCertReloader("", "", "")
+	assert.NoError(t, err)
+}
+
+func TestCertReloaderVerifyConnection(t *testing.T) {
+	ca := newTestCA(t)
+	r, err := newCertReloader(writeFile(t, t.TempDir(), "ca.crt", ca.certPEM), "", "")
+	require.NoError(t, err)
+
+	certPEM, keyPEM := ca.issue(t, "collector", x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+
+	untrustedPEM, untrustedKeyPEM := newTestCA(t).issue(t, "collector", x509.ExtKeyUsageServerAuth)
+	untrusted, err := tls.X509KeyPair(untrustedPEM, untrustedKeyPEM)
+	require.NoError(t, err)
+	untrustedLeaf, err := x509.ParseCertificate(untrusted.Certificate[0])
+	require.NoError(t, err)
+
+	// the server name of the handshake takes precedence over the fallback one
+	assert.NoError(t, r.verifyConnection("other")(tls.ConnectionState{ServerName: "collector", PeerCertificates: []*x509.Certificate{leaf}}))
+	assert.NoError(t, r.verifyConnection("127.0.0.1")(tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}))
+	assert.Error(t, r.verifyConnection("other")(tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}))
+	assert.Error(t, r.verifyConnection("collector")(tls.ConnectionState{PeerCertificates: []*x509.Certificate{untrustedLeaf}}))
+	assert.Error(t, r.verifyConnection("collector")(tls.ConnectionState{}))
+}
@@ -0,0 +1,14 @@
+package hyperconnect // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/connectrpc.com/hyperconnect"
+
+import (
+	"connectrpc.com/connect"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
+	sdkconnect "github.com/hypertrace/goagent/sdk/instrumentation/connectrpc.com/connect"
+)
+
+// NewInterceptor returns an interceptor recording the request and response message's body and
+// metadata. Handlers are expected to be wrapped by an instrumented HTTP handler and clients to
+// use an instrumented HTTP transport so the trace context is propagated.
+func NewInterceptor(options *sdkconnect.Options) connect.Interceptor {
+	return sdkconnect.NewInterceptor(opentelemetry.StartSpan, opentelemetry.SpanFromContext, options, map[string]string{})
+}
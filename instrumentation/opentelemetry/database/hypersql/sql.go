@@ -12,9 +12,19 @@ func Wrap(d driver.Driver) driver.Driver {
 	return sdkSQL.Wrap(d, opentelemetry.StartSpan)
 }
 
+// WrapWithOptions is like Wrap but it also accepts instrumentation options.
+func WrapWithOptions(d driver.Driver, options *sdkSQL.Options) driver.Driver {
+	return sdkSQL.WrapWithOptions(d, opentelemetry.StartSpan, options)
+}
+
 // Register initializes and registers the hypersql wrapped database driver
 // identified by its driverName. On success it
 // returns the generated driverName to use when calling hypersql.Open.
 func Register(driverName string) (string, error) {
 	return sdkSQL.Register(driverName, opentelemetry.StartSpan)
 }
+
+// RegisterWithOptions is like Register but it also accepts instrumentation options.
+func RegisterWithOptions(driverName string, options *sdkSQL.Options) (string, error) {
+	return sdkSQL.RegisterWithOptions(driverName, opentelemetry.StartSpan, options)
+}
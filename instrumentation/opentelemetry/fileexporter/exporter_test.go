@@ -0,0 +1,147 @@
+package fileexporter
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestTraceExporterWritesOTLPJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exporter, err := NewTraceExporter(Options{Path: path})
+	require.NoError(t, err)
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := tp.Tracer("test").Start(context.Background(), "first")
+	span.SetAttributes(attribute.String("http.method", "GET"))
+	span.End()
+	_, span = tp.Tracer("test").Start(context.Background(), "second")
+	span.End()
+	require.NoError(t, tp.Shutdown(context.Background()))
+
+	lines := readLines(t, path)
+	require.Len(t, lines, 2)
+
+	req := &coltracepb.ExportTraceServiceRequest{}
+	require.NoError(t, protojson.Unmarshal([]byte(lines[0]), req))
+	span0 := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	assert.Equal(t, "first", span0.Name)
+	assert.Equal(t, "http.method", span0.Attributes[0].Key)
+	assert.Equal(t, "GET", span0.Attributes[0].Value.GetStringValue())
+}
+
+func TestTraceExporterWritesHexIDsAndEnumNumbers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exporter, err := NewTraceExporter(Options{Path: path})
+	require.NoError(t, err)
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	_, child := tp.Tracer("test").Start(ctx, "child", trace.WithSpanKind(trace.SpanKindServer))
+	child.End()
+	parent.End()
+	require.NoError(t, tp.Shutdown(context.Background()))
+
+	lines := readLines(t, path)
+	require.Len(t, lines, 2)
+
+	var req struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []map[string]interface{}
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &req))
+	span := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	assert.Equal(t, child.SpanContext().TraceID().String(), span["traceId"])
+	assert.Equal(t, child.SpanContext().SpanID().String(), span["spanId"])
+	assert.Equal(t, parent.SpanContext().SpanID().String(), span["parentSpanId"])
+	assert.Equal(t, float64(trace.SpanKindServer), span["kind"])
+}
+
+func TestMetricExporterWritesOTLPJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	exporter, err := NewMetricExporter(Options{Path: path})
+	require.NoError(t, err)
+
+	now := time.Now()
+	attrs := attribute.NewSet(attribute.String("host", "a"))
+	rm := &metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(attribute.String("service.name", "test")),
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope: instrumentation.Scope{Name: "test", Version: "1.0"},
+			Metrics: []metricdata.Metrics{
+				{
+					Name: "requests",
+					Unit: "1",
+					Data: metricdata.Sum[int64]{
+						DataPoints:  []metricdata.DataPoint[int64]{{Attributes: attrs, StartTime: now, Time: now, Value: 3}},
+						Temporality: metricdata.CumulativeTemporality,
+						IsMonotonic: true,
+					},
+				},
+				{
+					Name: "latency",
+					Unit: "ms",
+					Data: metricdata.Histogram[float64]{
+						DataPoints: []metricdata.HistogramDataPoint[float64]{{
+							Attributes:   attrs,
+							Time:         now,
+							Count:        2,
+							Sum:          7.5,
+							Bounds:       []float64{5},
+							BucketCounts: []uint64{1, 1},
+							Min:          metricdata.NewExtrema(2.5),
+							Max:          metricdata.NewExtrema(5.0),
+						}},
+						Temporality: metricdata.DeltaTemporality,
+					},
+				},
+			},
+		}},
+	}
+
+	require.NoError(t, exporter.Export(context.Background(), rm))
+	require.NoError(t, exporter.ForceFlush(context.Background()))
+	require.NoError(t, exporter.Shutdown(context.Background()))
+
+	lines := readLines(t, path)
+	require.Len(t, lines, 1)
+
+	req := &colmetricpb.ExportMetricsServiceRequest{}
+	require.NoError(t, protojson.Unmarshal([]byte(lines[0]), req))
+	require.Len(t, req.ResourceMetrics, 1)
+	assert.Equal(t, "service.name", req.ResourceMetrics[0].Resource.Attributes[0].Key)
+
+	sm := req.ResourceMetrics[0].ScopeMetrics[0]
+	assert.Equal(t, "test", sm.Scope.Name)
+	require.Len(t, sm.Metrics, 2)
+
+	sum := sm.Metrics[0].GetSum()
+	require.NotNil(t, sum)
+	assert.True(t, sum.IsMonotonic)
+	assert.Equal(t, int64(3), sum.DataPoints[0].GetAsInt())
+	assert.Equal(t, "host", sum.DataPoints[0].Attributes[0].Key)
+
+	histogram := sm.Metrics[1].GetHistogram()
+	require.NotNil(t, histogram)
+	assert.Equal(t, uint64(2), histogram.DataPoints[0].Count)
+	assert.Equal(t, 7.5, histogram.DataPoints[0].GetSum())
+	assert.Equal(t, 2.5, histogram.DataPoints[0].GetMin())
+	assert.Equal(t, []uint64{1, 1}, histogram.DataPoints[0].BucketCounts)
+}
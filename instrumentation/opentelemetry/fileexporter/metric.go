@@ -0,0 +1,298 @@
+package fileexporter // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/fileexporter"
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// NewMetricExporter returns a metric exporter writing every collection as an OTLP/JSON
+// line in the file. Exemplars aren't written.
+func NewMetricExporter(opts Options) (metric.Exporter, error) {
+	w, err := newRotatingWriter(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &metricExporter{w: w}, nil
+}
+
+type metricExporter struct {
+	w *rotatingWriter
+}
+
+var _ metric.Exporter = (*metricExporter)(nil)
+
+func (e *metricExporter) Temporality(k metric.InstrumentKind) metricdata.Temporality {
+	return metric.DefaultTemporalitySelector(k)
+}
+
+func (e *metricExporter) Aggregation(k metric.InstrumentKind) metric.Aggregation {
+	return metric.DefaultAggregationSelector(k)
+}
+
+func (e *metricExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	req := &colmetricpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricpb.ResourceMetrics{resourceMetrics(rm)},
+	}
+
+	line, err := marshalOTLPJSON(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %v", err)
+	}
+	return e.w.WriteLine(line)
+}
+
+func (e *metricExporter) ForceFlush(context.Context) error {
+	return e.w.Sync()
+}
+
+func (e *metricExporter) Shutdown(context.Context) error {
+	return e.w.Close()
+}
+
+// The functions below turn the metrics into their OTLP form. The OTLP exporters do the
+// same but their transformation is internal.
+
+func resourceMetrics(rm *metricdata.ResourceMetrics) *metricpb.ResourceMetrics {
+	out := &metricpb.ResourceMetrics{
+		Resource:  protoResource(rm.Resource),
+		SchemaUrl: rm.Resource.SchemaURL(),
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		psm := &metricpb.ScopeMetrics{
+			Scope: &commonpb.InstrumentationScope{
+				Name:    sm.Scope.Name,
+				Version: sm.Scope.Version,
+			},
+			SchemaUrl: sm.Scope.SchemaURL,
+		}
+		for _, m := range sm.Metrics {
+			if pm := protoMetric(m); pm != nil {
+				psm.Metrics = append(psm.Metrics, pm)
+			}
+		}
+		out.ScopeMetrics = append(out.ScopeMetrics, psm)
+	}
+	return out
+}
+
+func protoResource(r *resource.Resource) *resourcepb.Resource {
+	if r == nil {
+		return nil
+	}
+	return &resourcepb.Resource{Attributes: keyValues(r.Attributes())}
+}
+
+// protoMetric returns nil for unknown aggregations.
+func protoMetric(m metricdata.Metrics) *metricpb.Metric {
+	out := &metricpb.Metric{
+		Name:        m.Name,
+		Description: m.Description,
+		Unit:        m.Unit,
+	}
+
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[int64]:
+		out.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: numberDataPoints(data.DataPoints)}}
+	case metricdata.Gauge[float64]:
+		out.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: numberDataPoints(data.DataPoints)}}
+	case metricdata.Sum[int64]:
+		out.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			DataPoints:             numberDataPoints(data.DataPoints),
+			AggregationTemporality: temporality(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+		}}
+	case metricdata.Sum[float64]:
+		out.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			DataPoints:             numberDataPoints(data.DataPoints),
+			AggregationTemporality: temporality(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+		}}
+	case metricdata.Histogram[int64]:
+		out.Data = &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+			DataPoints:             histogramDataPoints(data.DataPoints),
+			AggregationTemporality: temporality(data.Temporality),
+		}}
+	case metricdata.Histogram[float64]:
+		out.Data = &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+			DataPoints:             histogramDataPoints(data.DataPoints),
+			AggregationTemporality: temporality(data.Temporality),
+		}}
+	case metricdata.ExponentialHistogram[int64]:
+		out.Data = &metricpb.Metric_ExponentialHistogram{ExponentialHistogram: &metricpb.ExponentialHistogram{
+			DataPoints:             exponentialHistogramDataPoints(data.DataPoints),
+			AggregationTemporality: temporality(data.Temporality),
+		}}
+	case metricdata.ExponentialHistogram[float64]:
+		out.Data = &metricpb.Metric_ExponentialHistogram{ExponentialHistogram: &metricpb.ExponentialHistogram{
+			DataPoints:             exponentialHistogramDataPoints(data.DataPoints),
+			AggregationTemporality: temporality(data.Temporality),
+		}}
+	case metricdata.Summary:
+		out.Data = &metricpb.Metric_Summary{Summary: &metricpb.Summary{DataPoints: summaryDataPoints(data.DataPoints)}}
+	default:
+		return nil
+	}
+	return out
+}
+
+func numberDataPoints[N int64 | float64](dps []metricdata.DataPoint[N]) []*metricpb.NumberDataPoint {
+	out := make([]*metricpb.NumberDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		pdp := &metricpb.NumberDataPoint{
+			Attributes:        keyValues(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(dp.StartTime),
+			TimeUnixNano:      unixNano(dp.Time),
+		}
+		switch v := any(dp.Value).(type) {
+		case int64:
+			pdp.Value = &metricpb.NumberDataPoint_AsInt{AsInt: v}
+		case float64:
+			pdp.Value = &metricpb.NumberDataPoint_AsDouble{AsDouble: v}
+		}
+		out = append(out, pdp)
+	}
+	return out
+}
+
+func histogramDataPoints[N int64 | float64](dps []metricdata.HistogramDataPoint[N]) []*metricpb.HistogramDataPoint {
+	out := make([]*metricpb.HistogramDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		sum := float64(dp.Sum)
+		out = append(out, &metricpb.HistogramDataPoint{
+			Attributes:        keyValues(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(dp.StartTime),
+			TimeUnixNano:      unixNano(dp.Time),
+			Count:             dp.Count,
+			Sum:               &sum,
+			BucketCounts:      dp.BucketCounts,
+			ExplicitBounds:    dp.Bounds,
+			Min:               extrema(dp.Min),
+			Max:               extrema(dp.Max),
+		})
+	}
+	return out
+}
+
+func exponentialHistogramDataPoints[N int64 | float64](dps []metricdata.ExponentialHistogramDataPoint[N]) []*metricpb.ExponentialHistogramDataPoint {
+	out := make([]*metricpb.ExponentialHistogramDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		sum := float64(dp.Sum)
+		out = append(out, &metricpb.ExponentialHistogramDataPoint{
+			Attributes:        keyValues(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(dp.StartTime),
+			TimeUnixNano:      unixNano(dp.Time),
+			Count:             dp.Count,
+			Sum:               &sum,
+			Scale:             dp.Scale,
+			ZeroCount:         dp.ZeroCount,
+			Positive: &metricpb.ExponentialHistogramDataPoint_Buckets{
+				Offset:       dp.PositiveBucket.Offset,
+				BucketCounts: dp.PositiveBucket.Counts,
+			},
+			Negative: &metricpb.ExponentialHistogramDataPoint_Buckets{
+				Offset:       dp.NegativeBucket.Offset,
+				BucketCounts: dp.NegativeBucket.Counts,
+			},
+			Min:           extrema(dp.Min),
+			Max:           extrema(dp.Max),
+			ZeroThreshold: dp.ZeroThreshold,
+		})
+	}
+	return out
+}
+
+func summaryDataPoints(dps []metricdata.SummaryDataPoint) []*metricpb.SummaryDataPoint {
+	out := make([]*metricpb.SummaryDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		pdp := &metricpb.SummaryDataPoint{
+			Attributes:        keyValues(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(dp.StartTime),
+			TimeUnixNano:      unixNano(dp.Time),
+			Count:             dp.Count,
+			Sum:               dp.Sum,
+		}
+		for _, qv := range dp.QuantileValues {
+			pdp.QuantileValues = append(pdp.QuantileValues, &metricpb.SummaryDataPoint_ValueAtQuantile{
+				Quantile: qv.Quantile,
+				Value:    qv.Value,
+			})
+		}
+		out = append(out, pdp)
+	}
+	return out
+}
+
+func extrema[N int64 | float64](e metricdata.Extrema[N]) *float64 {
+	v, ok := e.Value()
+	if !ok {
+		return nil
+	}
+	f := float64(v)
+	return &f
+}
+
+func temporality(t metricdata.Temporality) metricpb.AggregationTemporality {
+	switch t {
+	case metricdata.DeltaTemporality:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	case metricdata.CumulativeTemporality:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	default:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED
+	}
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+func keyValues(attrs []attribute.KeyValue) []*commonpb.KeyValue {
+	out := make([]*commonpb.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		out = append(out, &commonpb.KeyValue{Key: string(kv.Key), Value: anyValue(kv.Value)})
+	}
+	return out
+}
+
+func anyValue(v attribute.Value) *commonpb.AnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.AsBool()}}
+	case attribute.INT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.AsInt64()}}
+	case attribute.FLOAT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}}
+	case attribute.BOOLSLICE:
+		return arrayValue(v.AsBoolSlice(), attribute.BoolValue)
+	case attribute.INT64SLICE:
+		return arrayValue(v.AsInt64Slice(), attribute.Int64Value)
+	case attribute.FLOAT64SLICE:
+		return arrayValue(v.AsFloat64Slice(), attribute.Float64Value)
+	case attribute.STRINGSLICE:
+		return arrayValue(v.AsStringSlice(), attribute.StringValue)
+	default:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Emit()}}
+	}
+}
+
+func arrayValue[T any](items []T, toValue func(T) attribute.Value) *commonpb.AnyValue {
+	values := make([]*commonpb.AnyValue, 0, len(items))
+	for _, item := range items {
+		values = append(values, anyValue(toValue(item)))
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+}
@@ -0,0 +1,83 @@
+// Package fileexporter provides span and metric exporters writing OTLP-JSON lines into
+// rotated files, e.g. for air-gapped deployments where files are shipped later on. Every
+// line is an OTLP export request, i.e. ExportTraceServiceRequest for spans and
+// ExportMetricsServiceRequest for metrics, encoded with protojson.
+package fileexporter // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/fileexporter"
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures the file the exporter writes into and its rotation.
+type Options struct {
+	// Path is the path of the file being written, e.g. /var/log/goagent/spans.jsonl.
+	Path string
+	// MaxSizeBytes rotates the file once it would grow beyond this size, no size based
+	// rotation if zero.
+	MaxSizeBytes int64
+	// RotationInterval rotates the file once it has been open for this long, no time based
+	// rotation if zero.
+	RotationInterval time.Duration
+	// MaxBackups is the number of rotated files to keep, all of them if zero.
+	MaxBackups int
+	// MaxAge removes the rotated files older than this, none if zero.
+	MaxAge time.Duration
+	// Compress gzips the rotated files.
+	Compress bool
+}
+
+// IsFileURL tells whether the endpoint is a file URL, e.g. file:///var/log/goagent/spans.jsonl.
+func IsFileURL(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "file://")
+}
+
+// ParseURL parses the options from a file URL, the rotation settings are passed as query
+// parameters, e.g.
+//
+//	file:///var/log/goagent/spans.jsonl?max_size_mb=100&rotation_interval=1h&max_backups=10&max_age=72h&compress=true
+func ParseURL(endpoint string) (Options, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return Options{}, fmt.Errorf("invalid file URL %q: %v", endpoint, err)
+	}
+
+	if u.Scheme != "file" {
+		return Options{}, fmt.Errorf("invalid file URL %q: scheme must be file", endpoint)
+	}
+
+	// file://relative/path is parsed with "relative" as host
+	opts := Options{Path: u.Host + u.Path}
+	if len(opts.Path) == 0 {
+		return Options{}, fmt.Errorf("invalid file URL %q: path is empty", endpoint)
+	}
+
+	for key, values := range u.Query() {
+		value := values[0]
+		switch key {
+		case "max_size_mb":
+			var sizeMB int64
+			sizeMB, err = strconv.ParseInt(value, 10, 64)
+			opts.MaxSizeBytes = sizeMB * 1024 * 1024
+		case "rotation_interval":
+			opts.RotationInterval, err = time.ParseDuration(value)
+		case "max_backups":
+			opts.MaxBackups, err = strconv.Atoi(value)
+		case "max_age":
+			opts.MaxAge, err = time.ParseDuration(value)
+		case "compress":
+			opts.Compress, err = strconv.ParseBool(value)
+		default:
+			err = fmt.Errorf("unknown parameter")
+		}
+
+		if err != nil {
+			return Options{}, fmt.Errorf("invalid file URL %q: parameter %s: %v", endpoint, key, err)
+		}
+	}
+
+	return opts, nil
+}
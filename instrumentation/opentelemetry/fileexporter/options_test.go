@@ -0,0 +1,51 @@
+package fileexporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseURL(t *testing.T) {
+	opts, err := ParseURL("file:///var/log/spans.jsonl?max_size_mb=100&rotation_interval=1h&max_backups=10&max_age=72h&compress=true")
+	require.NoError(t, err)
+	assert.Equal(t, Options{
+		Path:             "/var/log/spans.jsonl",
+		MaxSizeBytes:     100 * 1024 * 1024,
+		RotationInterval: time.Hour,
+		MaxBackups:       10,
+		MaxAge:           72 * time.Hour,
+		Compress:         true,
+	}, opts)
+}
+
+func TestParseURLRelativePath(t *testing.T) {
+	opts, err := ParseURL("file://logs/spans.jsonl")
+	require.NoError(t, err)
+	assert.Equal(t, Options{Path: "logs/spans.jsonl"}, opts)
+}
+
+func TestParseURLErrors(t *testing.T) {
+	tCases := map[string]string{
+		"not a file URL":    "http://localhost/spans.jsonl",
+		"empty path":        "file://",
+		"invalid size":      "file:///spans.jsonl?max_size_mb=big",
+		"invalid interval":  "file:///spans.jsonl?rotation_interval=1",
+		"unknown parameter": "file:///spans.jsonl?max_files=3",
+	}
+
+	for name, endpoint := range tCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseURL(endpoint)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestIsFileURL(t *testing.T) {
+	assert.True(t, IsFileURL("file:///var/log/spans.jsonl"))
+	assert.False(t, IsFileURL("http://localhost:9411/api/v2/spans"))
+	assert.False(t, IsFileURL("localhost:4317"))
+}
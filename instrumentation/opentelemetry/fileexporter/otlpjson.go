@@ -0,0 +1,77 @@
+package fileexporter // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/fileexporter"
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// idFields are the bytes fields OTLP/JSON encodes as hex instead of base64.
+var idFields = map[string]bool{
+	"traceId":      true,
+	"spanId":       true,
+	"parentSpanId": true,
+}
+
+// marshalOTLPJSON encodes the message as OTLP/JSON, which differs from the protobuf JSON
+// mapping in that trace and span IDs are hex encoded and enums are written as integers, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+func marshalOTLPJSON(m proto.Message) ([]byte, error) {
+	b, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// numbers are kept as they are, e.g. the int64 values written as strings.
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if err := hexEncodeIDs(v); err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// hexEncodeIDs replaces the base64 IDs by their hex form. Attributes can't clash with the
+// ID fields as they are written as key and value pairs.
+func hexEncodeIDs(v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && idFields[key] {
+				id, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return fmt.Errorf("failed to decode %s: %v", key, err)
+				}
+				v[key] = hex.EncodeToString(id)
+				continue
+			}
+			if err := hexEncodeIDs(value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := hexEncodeIDs(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
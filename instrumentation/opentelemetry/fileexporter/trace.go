@@ -0,0 +1,44 @@
+package fileexporter // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/fileexporter"
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// NewTraceExporter returns a span exporter writing every batch of spans as an OTLP/JSON
+// line in the file.
+func NewTraceExporter(opts Options) (sdktrace.SpanExporter, error) {
+	w, err := newRotatingWriter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// the OTLP exporter turns the spans into their OTLP form and hands them to the client.
+	return otlptrace.New(context.Background(), &traceClient{w: w})
+}
+
+type traceClient struct {
+	w *rotatingWriter
+}
+
+var _ otlptrace.Client = (*traceClient)(nil)
+
+func (c *traceClient) Start(context.Context) error {
+	return nil
+}
+
+func (c *traceClient) Stop(context.Context) error {
+	return c.w.Close()
+}
+
+func (c *traceClient) UploadTraces(_ context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	line, err := marshalOTLPJSON(&coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+	if err != nil {
+		return err
+	}
+	return c.w.WriteLine(line)
+}
@@ -0,0 +1,271 @@
+package fileexporter // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/fileexporter"
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102T150405.000000000"
+
+// rotatingWriter writes lines into a file that gets rotated once it reaches the max size
+// or the rotation interval. Rotated files are renamed after the rotation time, e.g.
+// spans-20240102T150405.000000000.jsonl, and optionally gzipped in the background.
+type rotatingWriter struct {
+	opts Options
+	now  func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+
+	// compressMu serializes the compression of the rotated files and the removal of the
+	// old ones, compressing tracks the ones in progress so Close can wait for them.
+	compressMu  sync.Mutex
+	compressing sync.WaitGroup
+}
+
+func newRotatingWriter(opts Options) (*rotatingWriter, error) {
+	if len(opts.Path) == 0 {
+		return nil, fmt.Errorf("file path is empty")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %v", opts.Path, err)
+	}
+
+	w := &rotatingWriter{opts: opts, now: time.Now}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// open opens the current file, appending to it if it already exists.
+func (w *rotatingWriter) open() error {
+	f, err := os.OpenFile(w.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", w.opts.Path, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat %s: %v", w.opts.Path, err)
+	}
+
+	w.file = f
+	w.size = info.Size()
+	w.openedAt = w.now()
+	return nil
+}
+
+// WriteLine writes the line followed by a new line, rotating the file beforehand if needed.
+func (w *rotatingWriter) WriteLine(line []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+
+	// the file is missing if it couldn't be reopened on the last rotation.
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	if w.shouldRotate(int64(len(line) + 1)) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(append(line, '\n'))
+	w.size += int64(n)
+	return err
+}
+
+func (w *rotatingWriter) shouldRotate(lineSize int64) bool {
+	if w.size == 0 {
+		return false
+	}
+
+	if w.opts.MaxSizeBytes > 0 && w.size+lineSize > w.opts.MaxSizeBytes {
+		return true
+	}
+
+	return w.opts.RotationInterval > 0 && w.now().Sub(w.openedAt) >= w.opts.RotationInterval
+}
+
+// rotate renames the current file and opens a new one. The current path is reopened even if
+// the rotation fails so the next writes don't fail too, only the rotation error is returned.
+func (w *rotatingWriter) rotate() error {
+	closeErr := w.file.Close()
+	w.file = nil
+
+	backup := w.backupName(w.now())
+	var rotateErr error
+	if closeErr != nil {
+		rotateErr = fmt.Errorf("failed to close %s: %v", w.opts.Path, closeErr)
+	} else if err := os.Rename(w.opts.Path, backup); err != nil {
+		rotateErr = fmt.Errorf("failed to rotate %s: %v", w.opts.Path, err)
+	}
+
+	if err := w.open(); err != nil {
+		if rotateErr != nil {
+			return rotateErr
+		}
+		return err
+	}
+
+	if rotateErr != nil {
+		return rotateErr
+	}
+
+	if !w.opts.Compress {
+		w.removeOldBackups()
+		return nil
+	}
+
+	// compressing can take a while hence it doesn't hold the writes.
+	w.compressing.Add(1)
+	go func() {
+		defer w.compressing.Done()
+
+		w.compressMu.Lock()
+		defer w.compressMu.Unlock()
+
+		if err := compress(backup); err != nil {
+			log.Printf("failed to compress the rotated file: %v\n", err)
+		}
+		w.removeOldBackups()
+	}()
+	return nil
+}
+
+// backupName returns the name of the rotated file, e.g. /var/log/spans-20240102T150405.000000000.jsonl.
+func (w *rotatingWriter) backupName(t time.Time) string {
+	prefix, ext := w.backupPrefixAndExt()
+	return prefix + t.UTC().Format(backupTimeFormat) + ext
+}
+
+func (w *rotatingWriter) backupPrefixAndExt() (string, string) {
+	ext := filepath.Ext(w.opts.Path)
+	return strings.TrimSuffix(w.opts.Path, ext) + "-", ext
+}
+
+type backup struct {
+	path string
+	time time.Time
+}
+
+// removeOldBackups removes the rotated files beyond MaxBackups or older than MaxAge.
+func (w *rotatingWriter) removeOldBackups() {
+	if w.opts.MaxBackups <= 0 && w.opts.MaxAge <= 0 {
+		return
+	}
+
+	backups := w.backups()
+	// newest first
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.After(backups[j].time)
+	})
+
+	now := w.now()
+	for i, b := range backups {
+		tooMany := w.opts.MaxBackups > 0 && i >= w.opts.MaxBackups
+		tooOld := w.opts.MaxAge > 0 && now.Sub(b.time) > w.opts.MaxAge
+		if tooMany || tooOld {
+			_ = os.Remove(b.path)
+		}
+	}
+}
+
+// backups lists the rotated files along with their rotation time.
+func (w *rotatingWriter) backups() []backup {
+	prefix, ext := w.backupPrefixAndExt()
+	matches, err := filepath.Glob(prefix + "*")
+	if err != nil {
+		return nil
+	}
+
+	var backups []backup
+	for _, match := range matches {
+		ts := strings.TrimPrefix(match, prefix)
+		ts = strings.TrimSuffix(strings.TrimSuffix(ts, ".gz"), ext)
+		t, err := time.Parse(backupTimeFormat, ts)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: match, time: t})
+	}
+	return backups
+}
+
+// compress gzips the file and removes the original one.
+func compress(path string) error {
+	src, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("failed to open %s for compression: %v", path, err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to create %s.gz: %v", path, err)
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		_ = dst.Close()
+		return fmt.Errorf("failed to compress %s: %v", path, err)
+	}
+	if err := gz.Close(); err != nil {
+		_ = dst.Close()
+		return fmt.Errorf("failed to compress %s: %v", path, err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to compress %s: %v", path, err)
+	}
+
+	return os.Remove(path)
+}
+
+// Sync flushes the current file to disk.
+func (w *rotatingWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Close closes the current file and waits for the rotated files to be compressed, further
+// writes fail.
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.compressing.Wait()
+
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,171 @@
+package fileexporter
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock returns a time that only moves when advanced.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestWriter(t *testing.T, opts Options) (*rotatingWriter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)}
+	w, err := newRotatingWriter(opts)
+	require.NoError(t, err)
+	w.now = clock.now
+	w.openedAt = clock.now()
+	t.Cleanup(func() { _ = w.Close() })
+	return w, clock
+}
+
+func readLines(t *testing.T, path string) []string {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func TestWriterRotatesOnSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	w, clock := newTestWriter(t, Options{Path: path, MaxSizeBytes: 12})
+
+	require.NoError(t, w.WriteLine([]byte("line1")))
+	require.NoError(t, w.WriteLine([]byte("line2")))
+	clock.advance(time.Second)
+	// would grow the file beyond 12 bytes
+	require.NoError(t, w.WriteLine([]byte("line3")))
+
+	assert.Equal(t, []string{"line3"}, readLines(t, path))
+
+	backups := w.backups()
+	require.Len(t, backups, 1)
+	assert.Equal(t, filepath.Join(filepath.Dir(path), "spans-20240102T150406.000000000.jsonl"), backups[0].path)
+	assert.Equal(t, []string{"line1", "line2"}, readLines(t, backups[0].path))
+}
+
+func TestWriterRotatesOnInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	w, clock := newTestWriter(t, Options{Path: path, RotationInterval: time.Minute})
+
+	require.NoError(t, w.WriteLine([]byte("line1")))
+	clock.advance(30 * time.Second)
+	require.NoError(t, w.WriteLine([]byte("line2")))
+	assert.Empty(t, w.backups())
+
+	clock.advance(30 * time.Second)
+	require.NoError(t, w.WriteLine([]byte("line3")))
+
+	assert.Equal(t, []string{"line3"}, readLines(t, path))
+	require.Len(t, w.backups(), 1)
+}
+
+func TestWriterRemovesOldBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	w, clock := newTestWriter(t, Options{Path: path, MaxSizeBytes: 1, MaxBackups: 2})
+
+	for i := 0; i < 5; i++ {
+		clock.advance(time.Second)
+		require.NoError(t, w.WriteLine([]byte("line")))
+	}
+
+	backups := w.backups()
+	require.Len(t, backups, 2)
+	// the newest ones are kept
+	for _, b := range backups {
+		assert.True(t, b.time.After(time.Date(2024, 1, 2, 15, 4, 7, 0, time.UTC)), b.path)
+	}
+}
+
+func TestWriterRemovesExpiredBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	w, clock := newTestWriter(t, Options{Path: path, MaxSizeBytes: 1, MaxAge: time.Hour})
+
+	require.NoError(t, w.WriteLine([]byte("line1")))
+	clock.advance(time.Minute)
+	require.NoError(t, w.WriteLine([]byte("line2")))
+	require.Len(t, w.backups(), 1)
+
+	clock.advance(2 * time.Hour)
+	require.NoError(t, w.WriteLine([]byte("line3")))
+
+	backups := w.backups()
+	require.Len(t, backups, 1)
+	assert.Equal(t, []string{"line2"}, readLines(t, backups[0].path))
+}
+
+func TestWriterCompressesBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	w, clock := newTestWriter(t, Options{Path: path, MaxSizeBytes: 1, Compress: true})
+
+	require.NoError(t, w.WriteLine([]byte("line1")))
+	clock.advance(time.Second)
+	require.NoError(t, w.WriteLine([]byte("line2")))
+	w.compressing.Wait()
+
+	backups := w.backups()
+	require.Len(t, backups, 1)
+	assert.True(t, strings.HasSuffix(backups[0].path, ".jsonl.gz"))
+
+	f, err := os.Open(backups[0].path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	content, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, "line1\n", string(content))
+}
+
+func TestWriterReopensOnFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	w, clock := newTestWriter(t, Options{Path: path, MaxSizeBytes: 1})
+
+	require.NoError(t, w.WriteLine([]byte("line1")))
+
+	// the file can't be renamed into a non empty directory
+	clock.advance(time.Second)
+	blocker := w.backupName(clock.now())
+	require.NoError(t, os.MkdirAll(filepath.Join(blocker, "nested"), 0750))
+	assert.ErrorContains(t, w.WriteLine([]byte("line2")), "failed to rotate")
+
+	// the writes go on with the next rotation
+	clock.advance(time.Second)
+	require.NoError(t, w.WriteLine([]byte("line3")))
+	assert.Equal(t, []string{"line3"}, readLines(t, path))
+	assert.Equal(t, []string{"line1"}, readLines(t, w.backupName(clock.now())))
+}
+
+func TestWriterAppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "spans.jsonl")
+
+	w, err := newRotatingWriter(Options{Path: path})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteLine([]byte("line1")))
+	require.NoError(t, w.Close())
+
+	w, err = newRotatingWriter(Options{Path: path})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteLine([]byte("line2")))
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, []string{"line1", "line2"}, readLines(t, path))
+	assert.ErrorIs(t, w.WriteLine([]byte("line3")), os.ErrClosed)
+}
@@ -0,0 +1,13 @@
+package hypergqlgen // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/github.com/99designs/hypergqlgen"
+
+import (
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
+	sdkgqlgen "github.com/hypertrace/goagent/sdk/instrumentation/github.com/99designs/gqlgen"
+)
+
+// NewTracer returns a gqlgen extension creating a span per operation and, if enabled,
+// per resolver field.
+func NewTracer(options *sdkgqlgen.Options) graphql.HandlerExtension {
+	return sdkgqlgen.NewTracer(opentelemetry.StartSpan, options)
+}
@@ -0,0 +1,77 @@
+package hyperwebsocket // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/github.com/gorilla/hyperwebsocket"
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
+	sdkwebsocket "github.com/hypertrace/goagent/sdk/instrumentation/websocket"
+)
+
+// Conn wraps a *websocket.Conn recording the messages going through ReadMessage,
+// WriteMessage, ReadJSON and WriteJSON. Messages going through NextReader and
+// NextWriter aren't recorded.
+type Conn struct {
+	*websocket.Conn
+	recorder *sdkwebsocket.MessageRecorder
+}
+
+// Upgrade upgrades the HTTP server connection to the WebSocket protocol using the
+// upgrader. The handshake is recorded in its own span and the messages are recorded
+// as events in the span of the request.
+func Upgrade(upgrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request, responseHeader http.Header, options *sdkwebsocket.Options) (*Conn, error) {
+	_, span, end := sdkwebsocket.StartHandshake(r, opentelemetry.StartSpan)
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
+	if err == nil && conn.Subprotocol() != "" {
+		span.SetAttribute("websocket.subprotocol", conn.Subprotocol())
+	}
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{
+		Conn:     conn,
+		recorder: sdkwebsocket.NewMessageRecorder(opentelemetry.SpanFromContext(r.Context()), options),
+	}, nil
+}
+
+// ReadMessage is a helper method for getting a reader using NextReader and
+// reading from that reader to a buffer.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	messageType, p, err := c.Conn.ReadMessage()
+	if err == nil {
+		c.recorder.Record(sdkwebsocket.DirectionReceived, messageType, p)
+	}
+	return messageType, p, err
+}
+
+// WriteMessage is a helper method for getting a writer using NextWriter,
+// writing the message and closing the writer.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	err := c.Conn.WriteMessage(messageType, data)
+	if err == nil {
+		c.recorder.Record(sdkwebsocket.DirectionSent, messageType, data)
+	}
+	return err
+}
+
+// ReadJSON reads the next JSON-encoded message from the connection and stores
+// it in the value pointed to by v.
+func (c *Conn) ReadJSON(v interface{}) error {
+	_, p, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(p, v)
+}
+
+// WriteJSON writes the JSON encoding of v as a message.
+func (c *Conn) WriteJSON(v interface{}) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, p)
+}
@@ -0,0 +1,77 @@
+package hyperwebsocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	sdkconfig "github.com/hypertrace/goagent/sdk/config"
+	sdkwebsocket "github.com/hypertrace/goagent/sdk/instrumentation/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestMessagesAreRecorded(t *testing.T) {
+	cfg := config.AgentConfig{
+		DataCapture: &config.DataCapture{
+			HttpBody: &config.Message{
+				Request:  config.Bool(true),
+				Response: config.Bool(true),
+			},
+			BodyMaxSizeBytes: config.Int32(1000),
+		},
+	}
+	sdkconfig.InitConfig(&cfg)
+	defer sdkconfig.ResetConfig()
+
+	_, flusher := tracetesting.InitTracer()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(&websocket.Upgrader{}, w, r, nil, &sdkwebsocket.Options{CaptureMessages: true})
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var msg map[string]string
+		require.NoError(t, conn.ReadJSON(&msg))
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("hello "+msg["name"])))
+	})
+
+	srv := httptest.NewServer(otelhttp.NewHandler(h, "ws"))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteJSON(map[string]string{"name": "Jacinto"}))
+	_, p, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "hello Jacinto", string(p))
+
+	// the request span ends once the handler returns
+	var spans []sdktrace.ReadOnlySpan
+	require.Eventually(t, func() bool {
+		spans = append(spans, flusher()...)
+		return len(spans) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	handshake, request := spans[0], spans[1]
+	assert.Equal(t, "websocket.handshake", handshake.Name())
+	assert.Equal(t, request.SpanContext().SpanID(), handshake.Parent().SpanID())
+
+	events := request.Events()
+	require.Equal(t, 2, len(events))
+	received := tracetesting.LookupAttributes(events[0].Attributes)
+	assert.Equal(t, "received", received.Get("websocket.direction").AsString())
+	assert.Equal(t, "{\"name\":\"Jacinto\"}\n", received.Get("websocket.message.payload").AsString())
+	sent := tracetesting.LookupAttributes(events[1].Attributes)
+	assert.Equal(t, "sent", sent.Get("websocket.direction").AsString())
+	assert.Equal(t, int64(13), sent.Get("websocket.message.size").AsInt64())
+}
@@ -0,0 +1,13 @@
+package hypergraphql // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/github.com/graph-gophers/hypergraphql"
+
+import (
+	"github.com/graph-gophers/graphql-go/trace/tracer"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
+	sdkgraphqlgo "github.com/hypertrace/goagent/sdk/instrumentation/github.com/graph-gophers/graphql-go"
+)
+
+// NewTracer returns a graphql-go tracer creating a span per operation and, if enabled,
+// per resolver field.
+func NewTracer(options *sdkgraphqlgo.Options) tracer.Tracer {
+	return sdkgraphqlgo.NewTracer(opentelemetry.StartSpan, options)
+}
@@ -0,0 +1,44 @@
+package hypergrpcgateway // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/github.com/grpc-ecosystem/hypergrpcgateway"
+
+import (
+	"context"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
+	sdkruntime "github.com/hypertrace/goagent/sdk/instrumentation/github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc/metadata"
+)
+
+// WithSpanAnnotator returns a ServeMux option that tags the HTTP span with the gRPC
+// method the request is transcoded to and propagates its trace context to the gRPC server.
+func WithSpanAnnotator() runtime.ServeMuxOption {
+	return sdkruntime.WithSpanAnnotator(opentelemetry.SpanFromContext, propagate)
+}
+
+func propagate(ctx context.Context, md metadata.MD) {
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+}
+
+// metadataCarrier adapts metadata.MD to the TextMapCarrier interface.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,23 @@
+package hypergrpcgateway
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestTraceContextIsPropagated(t *testing.T) {
+	tracer, _ := tracetesting.InitTracer()
+
+	ctx, span := tracer.Start(context.Background(), "POST /v1/hello")
+	defer span.End()
+
+	md := metadata.MD{}
+	propagate(ctx, md)
+
+	// tracetesting uses the single header B3 propagator
+	assert.Equal(t, []string{span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-1"}, md.Get("b3"))
+}
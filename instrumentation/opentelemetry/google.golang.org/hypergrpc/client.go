@@ -11,3 +11,9 @@ import (
 func WrapUnaryClientInterceptor(delegate grpc.UnaryClientInterceptor) grpc.UnaryClientInterceptor {
 	return sdkgrpc.WrapUnaryClientInterceptor(delegate, opentelemetry.SpanFromContext, map[string]string{})
 }
+
+// WrapUnaryClientInterceptorWithOptions is like WrapUnaryClientInterceptor but it also accepts
+// instrumentation options.
+func WrapUnaryClientInterceptorWithOptions(delegate grpc.UnaryClientInterceptor, options *sdkgrpc.Options) grpc.UnaryClientInterceptor {
+	return sdkgrpc.WrapUnaryClientInterceptorWithOptions(delegate, opentelemetry.SpanFromContext, options, map[string]string{})
+}
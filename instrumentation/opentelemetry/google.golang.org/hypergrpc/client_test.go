@@ -5,9 +5,12 @@ import (
 	"testing"
 
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc/internal/helloworld"
-	"github.com/hypertrace/goagent/instrumentation/opentelemetry/grpcunaryinterceptors"
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	otelcodes "go.opentelemetry.io/otel/codes"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -36,11 +39,7 @@ func TestClientHelloWorldSuccess(t *testing.T) {
 		"bufnet",
 		grpc.WithContextDialer(dialer),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithUnaryInterceptor(
-			WrapUnaryClientInterceptor(
-				grpcunaryinterceptors.UnaryClientInterceptor(),
-			),
-		),
+		grpc.WithStatsHandler(NewClientHandler()),
 	)
 	if err != nil {
 		t.Fatalf("failed to dial bufnet: %v", err)
@@ -110,11 +109,7 @@ func TestClientRegisterPersonFails(t *testing.T) {
 		"bufnet",
 		grpc.WithContextDialer(dialer),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithUnaryInterceptor(
-			WrapUnaryClientInterceptor(
-				grpcunaryinterceptors.UnaryClientInterceptor(),
-			),
-		),
+		grpc.WithStatsHandler(NewClientHandler()),
 	)
 	if err != nil {
 		t.Fatalf("failed to dial bufnet: %v", err)
@@ -138,6 +133,60 @@ func TestClientRegisterPersonFails(t *testing.T) {
 	assert.Equal(t, "invalid argument", span.Status().Description)
 }
 
+type blockingFilter struct{}
+
+func (blockingFilter) Evaluate(sdk.Span) result.FilterResult {
+	return result.FilterResult{Block: true, ResponseStatusCode: 403}
+}
+
+func TestClientFilterBlocksCall(t *testing.T) {
+	_, flusher := tracetesting.InitTracer()
+
+	s := grpc.NewServer()
+	defer s.Stop()
+
+	helloworld.RegisterGreeterServer(s, &server{
+		reply: &helloworld.HelloReply{Message: "Hi Pupo"},
+	})
+
+	dialer := createDialer(s)
+
+	statsHandler := NewClientHandler()
+	ctx := context.Background()
+	conn, err := grpc.DialContext(
+		ctx,
+		"bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(statsHandler),
+		grpc.WithUnaryInterceptor(FilterUnaryClientInterceptor(statsHandler, &sdkgrpc.Options{
+			Filter: blockingFilter{},
+		})),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufnet: %v", err)
+	}
+	defer conn.Close()
+
+	client := helloworld.NewGreeterClient(conn)
+
+	_, err = client.SayHello(ctx, &helloworld.HelloRequest{
+		Name: "Pupo",
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	spans := flusher()
+	assert.Equal(t, 1, len(spans))
+
+	span := spans[0]
+	assert.Equal(t, "helloworld.Greeter/SayHello", span.Name())
+	assert.Equal(t, otelcodes.Error, span.Status().Code)
+
+	attrs := tracetesting.LookupAttributes(span.Attributes())
+	assert.Equal(t, "{\"name\":\"Pupo\"}", attrs.Get("rpc.request.body").AsString())
+	assert.False(t, attrs.Has("rpc.response.body"))
+}
+
 func BenchmarkClientRequestResponseBodyMarshaling(b *testing.B) {
 	tracetesting.InitTracer()
 
@@ -156,11 +205,7 @@ func BenchmarkClientRequestResponseBodyMarshaling(b *testing.B) {
 		"bufnet",
 		grpc.WithContextDialer(dialer),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithUnaryInterceptor(
-			WrapUnaryClientInterceptor(
-				grpcunaryinterceptors.UnaryClientInterceptor(),
-			),
-		),
+		grpc.WithStatsHandler(NewClientHandler()),
 	)
 	if err != nil {
 		b.Fatalf("failed to dial bufnet: %v", err)
@@ -199,7 +244,7 @@ func BenchmarkClientRequestDefaultInterceptor(b *testing.B) {
 		"bufnet",
 		grpc.WithContextDialer(dialer),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithUnaryInterceptor(grpcunaryinterceptors.UnaryClientInterceptor()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
 	)
 	if err != nil {
 		b.Fatalf("failed to dial bufnet: %v", err)
@@ -0,0 +1,49 @@
+package hypergrpc // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc"
+
+import (
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
+	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+// NewServerHandler returns a stats.Handler creating a span per RPC, unary or streaming, through
+// the OpenTelemetry one and recording the request/response body and metadata.
+func NewServerHandler(opts ...otelgrpc.Option) stats.Handler {
+	return sdkgrpc.WrapStatsHandler(otelgrpc.NewServerHandler(opts...), opentelemetry.SpanFromContext)
+}
+
+// NewClientHandler returns a stats.Handler creating a span per RPC, unary or streaming, through
+// the OpenTelemetry one and recording the request/response body and metadata.
+func NewClientHandler(opts ...otelgrpc.Option) stats.Handler {
+	return sdkgrpc.WrapStatsHandler(otelgrpc.NewClientHandler(opts...), opentelemetry.SpanFromContext)
+}
+
+// FilterUnaryServerInterceptor returns an interceptor evaluating the filter in the options
+// on the span created by the server handler.
+func FilterUnaryServerInterceptor(options *sdkgrpc.Options) grpc.UnaryServerInterceptor {
+	return sdkgrpc.FilterUnaryServerInterceptor(opentelemetry.SpanFromContext, options)
+}
+
+// FilterStreamServerInterceptor returns an interceptor evaluating the filter in the options
+// on the span created by the server handler.
+func FilterStreamServerInterceptor(options *sdkgrpc.Options) grpc.StreamServerInterceptor {
+	return sdkgrpc.FilterStreamServerInterceptor(opentelemetry.SpanFromContext, options)
+}
+
+// FilterUnaryClientInterceptor returns an interceptor evaluating the filter in the options
+// on the span of the outgoing RPC. The statsHandler must be the one returned by NewClientHandler
+// and set on the same client through grpc.WithStatsHandler, any other handler starts a second
+// span per RPC.
+func FilterUnaryClientInterceptor(statsHandler stats.Handler, options *sdkgrpc.Options) grpc.UnaryClientInterceptor {
+	return sdkgrpc.FilterUnaryClientInterceptor(statsHandler, opentelemetry.SpanFromContext, options)
+}
+
+// FilterStreamClientInterceptor returns an interceptor evaluating the filter in the options
+// on the span of the outgoing RPC. The statsHandler must be the one returned by NewClientHandler
+// and set on the same client through grpc.WithStatsHandler, any other handler starts a second
+// span per RPC.
+func FilterStreamClientInterceptor(statsHandler stats.Handler, options *sdkgrpc.Options) grpc.StreamClientInterceptor {
+	return sdkgrpc.FilterStreamClientInterceptor(statsHandler, opentelemetry.SpanFromContext, options)
+}
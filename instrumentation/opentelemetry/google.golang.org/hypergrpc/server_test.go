@@ -9,10 +9,10 @@ import (
 	"testing"
 
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc/internal/helloworld"
-	"github.com/hypertrace/goagent/instrumentation/opentelemetry/grpcunaryinterceptors"
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
 	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	otelcodes "go.opentelemetry.io/otel/codes"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -82,9 +82,8 @@ func TestServerRegisterPersonSuccess(t *testing.T) {
 	_, flusher := tracetesting.InitTracer()
 
 	s := grpc.NewServer(
-		grpc.UnaryInterceptor(
-			WrapUnaryServerInterceptor(grpcunaryinterceptors.UnaryServerInterceptor(), &sdkgrpc.Options{}),
-		),
+		grpc.StatsHandler(NewServerHandler()),
+		grpc.UnaryInterceptor(FilterUnaryServerInterceptor(&sdkgrpc.Options{})),
 	)
 	defer s.Stop()
 
@@ -149,9 +148,8 @@ func TestServerRegisterPersonFails(t *testing.T) {
 	_, flusher := tracetesting.InitTracer()
 
 	s := grpc.NewServer(
-		grpc.UnaryInterceptor(
-			WrapUnaryServerInterceptor(grpcunaryinterceptors.UnaryServerInterceptor(), &sdkgrpc.Options{}),
-		),
+		grpc.StatsHandler(NewServerHandler()),
+		grpc.UnaryInterceptor(FilterUnaryServerInterceptor(&sdkgrpc.Options{})),
 	)
 	defer s.Stop()
 
@@ -195,9 +193,8 @@ func BenchmarkServerRequestResponseBodyMarshaling(b *testing.B) {
 	tracetesting.InitTracer()
 
 	s := grpc.NewServer(
-		grpc.UnaryInterceptor(
-			WrapUnaryServerInterceptor(grpcunaryinterceptors.UnaryServerInterceptor(), &sdkgrpc.Options{}),
-		),
+		grpc.StatsHandler(NewServerHandler()),
+		grpc.UnaryInterceptor(FilterUnaryServerInterceptor(&sdkgrpc.Options{})),
 	)
 	defer s.Stop()
 
@@ -237,7 +234,7 @@ func BenchmarkServerRequestDefaultInterceptor(b *testing.B) {
 	tracetesting.InitTracer()
 
 	s := grpc.NewServer(
-		grpc.UnaryInterceptor(grpcunaryinterceptors.UnaryServerInterceptor()),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
 	)
 	defer s.Stop()
 
@@ -0,0 +1,83 @@
+package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/opentelemetry"
+
+import (
+	"context"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// HealthStatus is the state of the agent after a init attempt.
+type HealthStatus int
+
+const (
+	// HealthOK means every component was set up.
+	HealthOK HealthStatus = iota
+	// HealthDegraded means a component failed and the agent runs without it, e.g.
+	// tracing falls back to noop when the exporter can't be created.
+	HealthDegraded
+	// HealthFailed means a component failed and the init returned an error.
+	HealthFailed
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthOK:
+		return "ok"
+	case HealthDegraded:
+		return "degraded"
+	case HealthFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Components reported in the health events.
+const (
+	ComponentTraceExporter   = "trace_exporter"
+	ComponentMetricsExporter = "metrics_exporter"
+	ComponentResource        = "resource"
+)
+
+// HealthEvent is reported to the health hook once per failing component, or once with
+// HealthOK if the init succeeds.
+type HealthEvent struct {
+	Status HealthStatus
+	// Component is the failing component, e.g. ComponentTraceExporter, empty for HealthOK.
+	Component string
+	Err       error
+}
+
+// HealthHook is called with the outcome of the init, e.g. to expose it in a readiness
+// probe or to report it to an error tracker.
+type HealthHook func(HealthEvent)
+
+func (o *options) report(e HealthEvent) {
+	if o.healthHook != nil {
+		o.healthHook(e)
+	}
+}
+
+// reportFailure reports a failing component and returns whether the init should go on in
+// degraded mode.
+func (o *options) reportFailure(component string, err error) bool {
+	status := HealthFailed
+	if o.degraded {
+		status = HealthDegraded
+	}
+	o.report(HealthEvent{Status: status, Component: component, Err: err})
+	return o.degraded
+}
+
+// noopSpanProcessor is returned by TryInitAsAdditional in degraded mode.
+type noopSpanProcessor struct{}
+
+var _ sdktrace.SpanProcessor = noopSpanProcessor{}
+
+func (noopSpanProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (noopSpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (noopSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (noopSpanProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,92 @@
+package opentelemetry
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// brokenZipkinConfig returns a config whose trace exporter can't be created.
+func brokenZipkinConfig() *v1.AgentConfig {
+	cfg := config.Load()
+	cfg.Reporting.TraceReporterType = config.TraceReporterType_ZIPKIN
+	cfg.Reporting.Endpoint = config.String("localhost:9411")
+	return cfg
+}
+
+func TestTryInitReturnsError(t *testing.T) {
+	var events []HealthEvent
+	shutdown, err := TryInit(brokenZipkinConfig(), WithHealthHook(func(e HealthEvent) {
+		events = append(events, e)
+	}))
+	require.Error(t, err)
+	assert.Nil(t, shutdown)
+	require.Len(t, events, 1)
+	assert.Equal(t, HealthFailed, events[0].Status)
+	assert.Equal(t, ComponentTraceExporter, events[0].Component)
+	assert.ErrorIs(t, err, events[0].Err)
+
+	// the failed init can be retried
+	shutdown, err = TryInit(config.Load())
+	require.NoError(t, err)
+	shutdown()
+}
+
+func TestTryInitFallsBackToNoopInDegradedMode(t *testing.T) {
+	var events []HealthEvent
+	shutdown, err := TryInit(brokenZipkinConfig(), WithDegradedMode(), WithHealthHook(func(e HealthEvent) {
+		events = append(events, e)
+	}))
+	require.NoError(t, err)
+	defer shutdown()
+
+	require.Len(t, events, 1)
+	assert.Equal(t, HealthDegraded, events[0].Status)
+	assert.Equal(t, ComponentTraceExporter, events[0].Component)
+	assert.Error(t, events[0].Err)
+
+	assert.Equal(t, noop.NewTracerProvider(), otel.GetTracerProvider())
+	// propagation keeps working
+	assert.NotEmpty(t, otel.GetTextMapPropagator().Fields())
+
+	startSpan, _, err := RegisterService("test_service", nil)
+	require.NoError(t, err)
+	_, s, _ := startSpan(context.Background(), "test_span", nil)
+	assert.True(t, s.IsNoop())
+}
+
+func TestTryInitReportsHealthy(t *testing.T) {
+	cfg := config.Load()
+	cfg.Reporting.TraceReporterType = config.TraceReporterType_LOGGING
+
+	var events []HealthEvent
+	shutdown, err := TryInit(cfg, WithHealthHook(func(e HealthEvent) {
+		events = append(events, e)
+	}))
+	require.NoError(t, err)
+	defer shutdown()
+
+	assert.Equal(t, []HealthEvent{{Status: HealthOK}}, events)
+}
+
+func TestTryInitAsAdditional(t *testing.T) {
+	_, _, err := TryInitAsAdditional(brokenZipkinConfig())
+	require.Error(t, err)
+
+	var events []HealthEvent
+	sp, shutdown, err := TryInitAsAdditional(brokenZipkinConfig(), WithDegradedMode(), WithHealthHook(func(e HealthEvent) {
+		events = append(events, e)
+	}))
+	require.NoError(t, err)
+	defer shutdown()
+
+	assert.Equal(t, noopSpanProcessor{}, sp)
+	require.Len(t, events, 1)
+	assert.Equal(t, HealthDegraded, events[0].Status)
+}
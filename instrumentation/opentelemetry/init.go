@@ -2,31 +2,25 @@ package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/o
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
+	"errors"
 	"fmt"
 	"log"
 	"maps"
-	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/go-logr/zapr"
 	config "github.com/hypertrace/agent-config/gen/go/v1"
-	modbsp "github.com/hypertrace/goagent/instrumentation/opentelemetry/batchspanprocessor"
-	"github.com/hypertrace/goagent/instrumentation/opentelemetry/errorhandler"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/fileexporter"
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry/identifier"
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/metrics"
 	"github.com/hypertrace/goagent/sdk"
-	sdkconfig "github.com/hypertrace/goagent/sdk/config"
 	"github.com/hypertrace/goagent/version"
 	"go.opentelemetry.io/contrib/propagators/b3"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	otlpgrpc "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	otlphttp "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
@@ -42,21 +36,21 @@ import (
 	"go.opentelemetry.io/otel/trace/noop"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/resolver"
 )
 
 var (
-	batchTimeout          = time.Duration(200) * time.Millisecond
-	traceProviders        map[string]*sdktrace.TracerProvider
-	globalSampler         sdktrace.Sampler
-	initialized           = false
-	enabled               = false
-	mu                    sync.Mutex
-	exporterFactory       func(opts ...ServiceOption) (sdktrace.SpanExporter, error)
-	configFactory         func() *config.AgentConfig
-	versionInfoAttributes = []attribute.KeyValue{
+	batchTimeout      = time.Duration(200) * time.Millisecond
+	traceProviders    map[string]*sdktrace.TracerProvider
+	globalSampler     sdktrace.Sampler
+	globalIDGenerator sdktrace.IDGenerator
+	// targetExporterFactories create the exporters of the reporting targets passed to New.
+	targetExporterFactories []targetExporterFactory
+	initialized             = false
+	enabled                 = false
+	mu                      sync.Mutex
+	exporterFactory         func(opts ...ServiceOption) (sdktrace.SpanExporter, error)
+	configFactory           func() *config.AgentConfig
+	versionInfoAttributes   = []attribute.KeyValue{
 		semconv.TelemetrySDKNameKey.String("hypertrace"),
 		semconv.TelemetrySDKVersionKey.String(version.Version),
 	}
@@ -65,8 +59,15 @@ var (
 type ServiceOption func(*ServiceOptions)
 
 type ServiceOptions struct {
-	headers  map[string]string
-	grpcConn *grpc.ClientConn
+	headers        map[string]string
+	grpcConn       *grpc.ClientConn
+	clientCertFile string
+	clientKeyFile  string
+	serverName     string
+	compression    Compression
+	timeout        time.Duration
+	// systemRootsFallback uses the system roots if reporting.cert_file can't be loaded.
+	systemRootsFallback bool
 }
 
 func WithHeaders(headers map[string]string) ServiceOption {
@@ -87,33 +88,15 @@ func WithGrpcConn(conn *grpc.ClientConn) ServiceOption {
 }
 
 // Can be used for external clients to reference the underlying connection for otlp grpc exporter
-func CreateGrpcConn(cfg *config.AgentConfig) (*grpc.ClientConn, error) {
+func CreateGrpcConn(cfg *config.AgentConfig, opts ...ServiceOption) (*grpc.ClientConn, error) {
 	endpoint := removeProtocolPrefixForOTLP(cfg.GetReporting().GetEndpoint().GetValue())
 
-	dialOpts := []grpc.DialOption{}
-
-	if !cfg.GetReporting().GetSecure().GetValue() {
-		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	} else {
-		certFile := cfg.GetReporting().GetCertFile().GetValue()
-		if len(certFile) > 0 {
-			tlsCredentials, err := credentials.NewClientTLSFromFile(certFile, "")
-			if err != nil {
-				return nil, fmt.Errorf("error creating TLS credentials from cert path %s: %v", certFile, err)
-			}
-			dialOpts = append(dialOpts, grpc.WithTransportCredentials(tlsCredentials))
-		} else {
-			// Default to system certs
-			dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
-		}
-	}
-
-	if cfg.Reporting.GetEnableGrpcLoadbalancing().GetValue() {
-		resolver.SetDefaultScheme("dns")
-		dialOpts = append(dialOpts, grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [ { "round_robin": {} } ]}`))
+	t, err := newTransport(cfg.GetReporting(), endpoint, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating TLS credentials: %v", err)
 	}
 
-	conn, err := grpc.NewClient(endpoint, dialOpts...)
+	conn, err := grpc.NewClient(endpoint, t.grpcDialOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gRPC connection to %s: %v", endpoint, err)
 	}
@@ -150,14 +133,22 @@ func removeProtocolPrefixForOTLP(endpoint string) string {
 }
 
 func makeMetricsExporterFactory(cfg *config.AgentConfig) func(opts ...ServiceOption) (metric.Exporter, error) {
-	// We are only supporting logging and otlp metric exporters for now. We will add support for prometheus
-	// metrics later
+	// Prometheus isn't handled here as it is a reader pulling the metrics rather than an
+	// exporter, see makeMetricsReader.
 	switch cfg.Reporting.MetricReporterType {
 	case config.MetricReporterType_METRIC_REPORTER_TYPE_LOGGING:
 		// stdout exporter
 		// currently only ServiceOption is WithHeaders so noop-ing ServiceOption for stdout for now
 		return func(_ ...ServiceOption) (metric.Exporter, error) {
-			// TODO: Define if endpoint could be a filepath to write into a file.
+			// a file URL as endpoint writes the metrics into a file instead of stdout.
+			endpoint := cfg.GetReporting().GetMetricEndpoint().GetValue()
+			if fileexporter.IsFileURL(endpoint) {
+				fileOpts, err := fileexporter.ParseURL(endpoint)
+				if err != nil {
+					return nil, err
+				}
+				return fileexporter.NewMetricExporter(fileOpts)
+			}
 			return stdoutmetric.New()
 		}
 	default:
@@ -167,36 +158,16 @@ func makeMetricsExporterFactory(cfg *config.AgentConfig) func(opts ...ServiceOpt
 				endpoint = cfg.GetReporting().GetEndpoint().GetValue()
 			}
 
-			serviceOpts := &ServiceOptions{
-				headers: make(map[string]string),
-			}
-			for _, opt := range opts {
-				opt(serviceOpts)
-			}
-
-			metricOpts := []otlpmetricgrpc.Option{
-				otlpmetricgrpc.WithEndpoint(removeProtocolPrefixForOTLP(endpoint)),
-				otlpmetricgrpc.WithHeaders(serviceOpts.headers),
-			}
-
-			if !cfg.GetReporting().GetSecure().GetValue() {
-				metricOpts = append(metricOpts, otlpmetricgrpc.WithInsecure())
-			}
-
-			certFile := cfg.GetReporting().GetCertFile().GetValue()
-			if len(certFile) > 0 {
-				if tlsCredentials, err := credentials.NewClientTLSFromFile(certFile, ""); err == nil {
-					metricOpts = append(metricOpts, otlpmetricgrpc.WithTLSCredentials(tlsCredentials))
-				} else {
-					log.Printf("error while creating tls credentials from cert path %s: %v", certFile, err)
-				}
+			t, err := newTransport(cfg.GetReporting(), endpoint, opts...)
+			if err != nil {
+				return nil, err
 			}
 
-			if cfg.Reporting.GetEnableGrpcLoadbalancing().GetValue() {
-				resolver.SetDefaultScheme("dns")
-				metricOpts = append(metricOpts, otlpmetricgrpc.WithServiceConfig(`{"loadBalancingConfig": [ { "round_robin": {} } ]}`))
+			// metrics are sent over the same protocol as the spans.
+			if cfg.GetReporting().GetTraceReporterType() == config.TraceReporterType_OTLP_HTTP {
+				return otlpmetrichttp.New(context.Background(), t.otlpMetricHTTPOptions()...)
 			}
-			return otlpmetricgrpc.New(context.Background(), metricOpts...)
+			return otlpmetricgrpc.New(context.Background(), t.otlpMetricGRPCOptions()...)
 		}
 	}
 }
@@ -204,103 +175,47 @@ func makeMetricsExporterFactory(cfg *config.AgentConfig) func(opts ...ServiceOpt
 func makeExporterFactory(cfg *config.AgentConfig) func(serviceOpts ...ServiceOption) (sdktrace.SpanExporter, error) {
 	switch cfg.Reporting.TraceReporterType {
 	case config.TraceReporterType_ZIPKIN:
-		client := &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: createTLSConfig(cfg.GetReporting()),
-			},
-		}
-
 		return func(opts ...ServiceOption) (sdktrace.SpanExporter, error) {
-			serviceOpts := &ServiceOptions{
-				headers: make(map[string]string),
-			}
-			for _, opt := range opts {
-				opt(serviceOpts)
+			endpoint := cfg.GetReporting().GetEndpoint().GetValue()
+			t, err := newTransport(cfg.GetReporting(), endpoint, opts...)
+			if err != nil {
+				return nil, err
 			}
-			return zipkin.New(
-				cfg.GetReporting().GetEndpoint().GetValue(),
-				zipkin.WithClient(client),
-				zipkin.WithHeaders(serviceOpts.headers),
-			)
+			return zipkin.New(endpoint, t.zipkinOptions()...)
 		}
 
 	case config.TraceReporterType_LOGGING:
 		return func(opts ...ServiceOption) (sdktrace.SpanExporter, error) {
-			// TODO: Define if endpoint could be a filepath to write into a file.
+			// a file URL as endpoint writes the spans into a file instead of stdout.
+			endpoint := cfg.GetReporting().GetEndpoint().GetValue()
+			if fileexporter.IsFileURL(endpoint) {
+				fileOpts, err := fileexporter.ParseURL(endpoint)
+				if err != nil {
+					return nil, err
+				}
+				return fileexporter.NewTraceExporter(fileOpts)
+			}
 			return stdouttrace.New(stdouttrace.WithPrettyPrint())
 		}
 
 	case config.TraceReporterType_OTLP_HTTP:
-		standardOpts := []otlphttp.Option{
-			otlphttp.WithEndpoint(cfg.GetReporting().GetEndpoint().GetValue()),
-		}
-
-		if !cfg.GetReporting().GetSecure().GetValue() {
-			standardOpts = append(standardOpts, otlphttp.WithInsecure())
-		}
-
-		certFile := cfg.GetReporting().GetCertFile().GetValue()
-		if len(certFile) > 0 {
-			standardOpts = append(standardOpts, otlphttp.WithTLSClientConfig(createTLSConfig(cfg.GetReporting())))
-		}
-
 		return func(opts ...ServiceOption) (sdktrace.SpanExporter, error) {
-			serviceOpts := &ServiceOptions{
-				headers: make(map[string]string),
-			}
-			for _, opt := range opts {
-				opt(serviceOpts)
+			t, err := newTransport(cfg.GetReporting(), cfg.GetReporting().GetEndpoint().GetValue(), opts...)
+			if err != nil {
+				return nil, err
 			}
-
-			finalOpts := append([]otlphttp.Option{}, standardOpts...)
-			finalOpts = append(finalOpts, otlphttp.WithHeaders(serviceOpts.headers))
-
-			return otlphttp.New(context.Background(), finalOpts...)
+			return otlphttp.New(context.Background(), t.otlpTraceHTTPOptions()...)
 		}
 
 	default: // OTLP GRPC
-		standardOpts := []otlpgrpc.Option{
-			otlpgrpc.WithEndpoint(removeProtocolPrefixForOTLP(cfg.GetReporting().GetEndpoint().GetValue())),
-		}
-
-		if !cfg.GetReporting().GetSecure().GetValue() {
-			standardOpts = append(standardOpts, otlpgrpc.WithInsecure())
-		}
-
-		certFile := cfg.GetReporting().GetCertFile().GetValue()
-		if len(certFile) > 0 {
-			if tlsCredentials, err := credentials.NewClientTLSFromFile(certFile, ""); err == nil {
-				standardOpts = append(standardOpts, otlpgrpc.WithTLSCredentials(tlsCredentials))
-			} else {
-				log.Printf("error while creating tls credentials from cert path %s: %v", certFile, err)
-			}
-		}
-
-		if cfg.Reporting.GetEnableGrpcLoadbalancing().GetValue() {
-			resolver.SetDefaultScheme("dns")
-			standardOpts = append(standardOpts, otlpgrpc.WithServiceConfig(`{"loadBalancingConfig": [ { "round_robin": {} } ]}`))
-		}
-
 		return func(opts ...ServiceOption) (sdktrace.SpanExporter, error) {
-			// Process options
-			serviceOpts := &ServiceOptions{
-				headers: make(map[string]string),
-			}
-			for _, opt := range opts {
-				opt(serviceOpts)
-			}
-
-			finalOpts := append([]otlpgrpc.Option{}, standardOpts...)
-			finalOpts = append(finalOpts, otlpgrpc.WithHeaders(serviceOpts.headers))
-
-			// Important: gRPC connection takes precedence over other connection based options
-			if serviceOpts.grpcConn != nil {
-				finalOpts = append(finalOpts, otlpgrpc.WithGRPCConn(serviceOpts.grpcConn))
+			t, err := newTransport(cfg.GetReporting(), cfg.GetReporting().GetEndpoint().GetValue(), opts...)
+			if err != nil {
+				return nil, err
 			}
-
 			return otlptrace.New(
 				context.Background(),
-				otlpgrpc.NewClient(finalOpts...),
+				otlpgrpc.NewClient(t.otlpTraceGRPCOptions()...),
 			)
 		}
 	}
@@ -312,53 +227,32 @@ func makeConfigFactory(cfg *config.AgentConfig) func() *config.AgentConfig {
 	}
 }
 
-func createTLSConfig(reportingCfg *config.Reporting) *tls.Config {
-	tlsConfig := &tls.Config{
-		MinVersion: tls.VersionTLS12,
-	}
-	tlsConfig.InsecureSkipVerify = !reportingCfg.GetSecure().GetValue()
-	certFile := reportingCfg.GetCertFile().GetValue()
-	if len(certFile) > 0 {
-		tlsConfig.RootCAs = createCaCertPoolFromFile(certFile)
-	}
-
-	return tlsConfig
-}
-
-// createCaCertPoolFromFile creates a CA Cert Pool from a file path containing
-// a raw CA certificate to verify a server certificate. The file path is the
-// reporting.cert_file config value.
-func createCaCertPoolFromFile(certFile string) *x509.CertPool {
-	certBytes, err := os.ReadFile(filepath.Clean(certFile))
-	if err != nil {
-		log.Printf("error while reading cert path: %v", err)
-		return nil
-	}
-	cp := x509.NewCertPool()
-	if ok := cp.AppendCertsFromPEM(certBytes); !ok {
-		log.Printf("error while configuring tls: failed to append certificate to the cert pool")
-		return nil
-	}
-
-	return cp
-}
-
 // Init initializes opentelemetry tracing and returns a shutdown function to flush data immediately
-// on a termination signal.
+// on a termination signal. It exits if tracing can't be set up, use TryInit to handle the error.
 func Init(cfg *config.AgentConfig, opts ...ServiceOption) func() {
 	return InitWithSpanProcessorWrapper(cfg, nil, versionInfoAttributes, opts...)
 }
 
+// TryInit is like Init but returns an error if tracing can't be set up, or falls back to
+// noop tracing if WithDegradedMode is passed.
+func TryInit(cfg *config.AgentConfig, opts ...Option) (func(), error) {
+	return TryInitWithSpanProcessorWrapperAndZap(cfg, nil, versionInfoAttributes, newDefaultLogger(), opts...)
+}
+
 // InitWithSpanProcessorWrapper initializes opentelemetry tracing with a wrapper over span processor
 // and returns a shutdown function to flush data immediately on a termination signal.
 func InitWithSpanProcessorWrapper(cfg *config.AgentConfig, wrapper SpanProcessorWrapper,
 	versionInfoAttrs []attribute.KeyValue, opts ...ServiceOption) func() {
+	return InitWithSpanProcessorWrapperAndZap(cfg, wrapper, versionInfoAttrs, newDefaultLogger(), opts...)
+}
+
+func newDefaultLogger() *zap.Logger {
 	logger, err := zap.NewProduction()
 	if err != nil {
-		logger = nil
 		log.Printf("error while creating default zap logger %v", err)
+		return nil
 	}
-	return InitWithSpanProcessorWrapperAndZap(cfg, wrapper, versionInfoAttrs, logger, opts...)
+	return logger
 }
 
 // InitWithSpanProcessorWrapperAndZap initializes opentelemetry tracing with a wrapper over span processor
@@ -366,113 +260,38 @@ func InitWithSpanProcessorWrapper(cfg *config.AgentConfig, wrapper SpanProcessor
 // Also sets opentelemetry internal errorhandler to the provider zap errorhandler
 func InitWithSpanProcessorWrapperAndZap(cfg *config.AgentConfig, wrapper SpanProcessorWrapper,
 	versionInfoAttrs []attribute.KeyValue, logger *zap.Logger, opts ...ServiceOption) func() {
-	mu.Lock()
-	defer mu.Unlock()
-	if initialized {
-		return func() {}
-	}
-	sdkconfig.InitConfig(cfg)
-
-	enabled = cfg.GetEnabled().Value
-	if !enabled {
-		initialized = true
-		otel.SetTracerProvider(noop.NewTracerProvider())
-		// even if the tracer isn't enabled, propagation is still enabled
-		// to not break the full workflow of the tracing system. Even
-		// if this service will not report spans and the trace might look
-		// broken, spans can still be grouped by trace ID.
-		otel.SetTextMapPropagator(makePropagator(cfg.PropagationFormats))
-		return func() {
-			initialized = false
-			sdkconfig.ResetConfig()
-		}
-	}
-
-	if logger != nil {
-		_ = zap.ReplaceGlobals(logger.With(zap.String("service", "hypertrace")))
-
-		// initialize opentelemetry's internal logger
-		logr := zapr.NewLogger(logger)
-		otel.SetLogger(logr)
-
-		// initialize opentelemetry's internal error handler
-		errorhandler.Init(logger)
-	}
-
-	// Initialize metrics
-	metricsShutdownFn := initializeMetrics(cfg, versionInfoAttrs, opts...)
-	exporterFactory = makeExporterFactory(cfg)
-	configFactory = makeConfigFactory(cfg)
-
-	exporter, err := exporterFactory(opts...)
-
+	shutdown, err := TryInitWithSpanProcessorWrapperAndZap(cfg, wrapper, versionInfoAttrs, logger,
+		WithServiceOptions(opts...), withSystemRootsFallback())
 	if err != nil {
 		log.Fatal(err)
 	}
+	return shutdown
+}
 
-	sp := modbsp.CreateBatchSpanProcessor(
-		shouldUseCustomBatchSpanProcessor(cfg),
-		exporter,
-		sdktrace.WithBatchTimeout(batchTimeout))
-	if wrapper != nil {
-		sp = &spanProcessorWithWrapper{wrapper, sp}
+// TryInitWithSpanProcessorWrapperAndZap is like InitWithSpanProcessorWrapperAndZap but returns an
+// error if tracing can't be set up, or falls back to noop tracing if WithDegradedMode is passed.
+// Calls are ignored if tracing is already initialized.
+func TryInitWithSpanProcessorWrapperAndZap(cfg *config.AgentConfig, wrapper SpanProcessorWrapper,
+	versionInfoAttrs []attribute.KeyValue, logger *zap.Logger, opts ...Option) (func(), error) {
+	opts = append([]Option{
+		WithSpanProcessorWrapper(wrapper),
+		WithVersionInfoAttributes(versionInfoAttrs...),
+		WithLogger(logger),
+	}, opts...)
+
+	agent, err := New(cfg, opts...)
+	if errors.Is(err, errAlreadyInitialized) {
+		return func() {}, nil
 	}
-
-	resources, err := resource.New(
-		context.Background(),
-		resource.WithAttributes(createResources(getResourceAttrsWithServiceName(cfg.ResourceAttributes, cfg.GetServiceName().GetValue()),
-			versionInfoAttrs)...),
-	)
 	if err != nil {
-		log.Fatal(err)
-	}
-	sampler := sdktrace.AlwaysSample()
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sampler),
-		sdktrace.WithSpanProcessor(sp),
-		sdktrace.WithResource(resources),
-	)
-	otel.SetTracerProvider(tp)
-
-	otel.SetTextMapPropagator(makePropagator(cfg.PropagationFormats))
-
-	traceProviders = make(map[string]*sdktrace.TracerProvider)
-	globalSampler = sampler
-	initialized = true
-
-	startSpanFn := startSpan(func() trace.TracerProvider {
-		return tp
-	})
-
-	// Startup span
-	if cfg.GetTelemetry().GetStartupSpanEnabled().GetValue() {
-		_, span, ender := startSpanFn(context.Background(), "startup", &sdk.SpanOptions{})
-		span.SetAttribute("hypertrace.agent.startup", true)
-		ender()
+		return nil, err
 	}
 
 	return func() {
-		mu.Lock()
-		defer mu.Unlock()
-		for key, tracerProvider := range traceProviders {
-			err := tracerProvider.Shutdown(context.Background())
-			if err != nil {
-				log.Printf("error while shutting down tracer provider: %v\n", err)
-			}
-			delete(traceProviders, key)
+		if err := agent.Shutdown(context.Background()); err != nil {
+			log.Printf("error while shutting down: %v\n", err)
 		}
-		traceProviders = map[string]*sdktrace.TracerProvider{}
-		err := tp.Shutdown(context.Background())
-		if err != nil {
-			log.Printf("error while shutting down default tracer provider: %v\n", err)
-		}
-
-		metricsShutdownFn()
-		initialized = false
-		enabled = false
-		sdkconfig.ResetConfig()
-	}
+	}, nil
 }
 
 func createResources(resources map[string]string,
@@ -515,29 +334,34 @@ func RegisterServiceWithSpanProcessorWrapper(key string, resourceAttributes map[
 
 	exporter, err := exporterFactory(opts...)
 	if err != nil {
-		log.Fatal(err)
+		return nil, noop.NewTracerProvider(), fmt.Errorf("failed to create trace exporter: %w", err)
 	}
 
-	sp := modbsp.CreateBatchSpanProcessor(
-		shouldUseCustomBatchSpanProcessor(configFactory()),
-		exporter,
-		sdktrace.WithBatchTimeout(batchTimeout))
-	if wrapper != nil {
-		sp = &spanProcessorWithWrapper{wrapper, sp}
+	targetExporters, err := createTargetExporters(targetExporterFactories, opts...)
+	if err != nil {
+		_ = exporter.Shutdown(context.Background())
+		return nil, noop.NewTracerProvider(), err
 	}
+	exporters := append([]sdktrace.SpanExporter{exporter}, targetExporters...)
 
 	resources, err := resource.New(
 		context.Background(),
 		resource.WithAttributes(createResources(resourceAttributes, versionInfoAttrs)...),
 	)
 	if err != nil {
-		log.Fatal(err)
+		shutdownExporters(exporters)
+		return nil, noop.NewTracerProvider(), fmt.Errorf("failed to create resource: %w", err)
 	}
-	tp := sdktrace.NewTracerProvider(
+
+	sps := newSpanProcessors(shouldUseCustomBatchSpanProcessor(configFactory()), exporters, wrapper)
+	tpOpts := append([]sdktrace.TracerProviderOption{
 		sdktrace.WithSampler(globalSampler),
-		sdktrace.WithSpanProcessor(sp),
 		sdktrace.WithResource(resources),
-	)
+	}, withSpanProcessors(sps)...)
+	if globalIDGenerator != nil {
+		tpOpts = append(tpOpts, sdktrace.WithIDGenerator(globalIDGenerator))
+	}
+	tp := sdktrace.NewTracerProvider(tpOpts...)
 
 	traceProviders[key] = tp
 	return startSpan(func() trace.TracerProvider {
@@ -545,25 +369,34 @@ func RegisterServiceWithSpanProcessorWrapper(key string, resourceAttributes map[
 	}), tp, nil
 }
 
-func initializeMetrics(cfg *config.AgentConfig, versionInfoAttrs []attribute.KeyValue, opts ...ServiceOption) func() {
-	if shouldDisableMetrics(cfg) {
-		return func() {}
+func initializeMetrics(cfg *config.AgentConfig, versionInfoAttrs []attribute.KeyValue, prom *PrometheusOptions, opts ...ServiceOption) (func(), error) {
+	if prom == nil && cfg.GetReporting().GetMetricReporterType() == config.MetricReporterType_METRIC_REPORTER_TYPE_PROMETHEUS {
+		promOpts := prometheusOptionsFromConfig(cfg)
+		prom = &promOpts
 	}
 
-	metricsExporterFactory := makeMetricsExporterFactory(cfg)
-	metricsExporter, err := metricsExporterFactory(opts...)
-	if err != nil {
-		log.Fatal(err)
+	metricsDisabled := shouldDisableMetrics(cfg)
+	if prom != nil {
+		// Prometheus scrapes the metrics hence there is no endpoint to check.
+		metricsDisabled = !cfg.GetTelemetry().GetMetricsEnabled().GetValue()
+	}
+	if metricsDisabled {
+		return func() {}, nil
 	}
-	periodicReader := metric.NewPeriodicReader(metricsExporter)
 
 	resourceKvps := createResources(getResourceAttrsWithServiceName(cfg.ResourceAttributes, cfg.GetServiceName().GetValue()), versionInfoAttrs)
 	resourceKvps = append(resourceKvps, identifier.ServiceInstanceKeyValue)
 	metricResources, err := resource.New(context.Background(), resource.WithAttributes(resourceKvps...))
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to create metrics resource: %w", err)
 	}
-	meterProvider := metric.NewMeterProvider(metric.WithReader(periodicReader), metric.WithResource(metricResources))
+
+	reader, readerShutdownFn, err := makeMetricsReader(cfg, prom, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	meterProvider := metric.NewMeterProvider(metric.WithReader(reader), metric.WithResource(metricResources))
 	otel.SetMeterProvider(meterProvider)
 
 	metrics.InitializeSystemMetrics()
@@ -572,23 +405,60 @@ func initializeMetrics(cfg *config.AgentConfig, versionInfoAttrs []attribute.Key
 		if err != nil {
 			log.Printf("an error while calling metrics provider shutdown: %v", err)
 		}
-		err := periodicReader.Shutdown(context.Background())
+		err := readerShutdownFn(context.Background())
 		if err != nil {
 			log.Printf("an error while calling metrics reader shutdown: %v", err)
 		}
+	}, nil
+}
+
+// makeMetricsReader creates the reader pushing the metrics to the exporter from the config,
+// or the one exposing them to Prometheus if prom is set.
+func makeMetricsReader(cfg *config.AgentConfig, prom *PrometheusOptions, opts ...ServiceOption) (metric.Reader, func(context.Context) error, error) {
+	if prom != nil {
+		// the reader is shut down along with the meter provider, only the server is left.
+		reader, stopServer, err := newPrometheusReader(*prom)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create metrics exporter: %w", err)
+		}
+		return reader, stopServer, nil
+	}
+
+	metricsExporterFactory := makeMetricsExporterFactory(cfg)
+	metricsExporter, err := metricsExporterFactory(opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create metrics exporter: %w", err)
 	}
+	periodicReader := metric.NewPeriodicReader(metricsExporter)
+	return periodicReader, periodicReader.Shutdown, nil
 }
 
 func shouldDisableMetrics(cfg *config.AgentConfig) bool {
-	// Disable metrics if the tracing exporter is not OTLP(grpc) and the metrics endpoint is not explicitly set.
-	// This is because we use the traces OTLP endpoint for metrics if the metrics endpoint is not set.
-	// By default the traces endpoint is zipkin which does not have support for metrics.
-	if cfg.GetReporting() != nil && cfg.GetReporting().GetTraceReporterType() != config.TraceReporterType_OTLP &&
-		len(cfg.GetReporting().GetMetricEndpoint().GetValue()) == 0 {
+	if cfg.GetTelemetry() == nil || !cfg.GetTelemetry().GetMetricsEnabled().GetValue() {
+		return true
+	}
+
+	reporting := cfg.GetReporting()
+	switch reporting.GetMetricReporterType() {
+	case config.MetricReporterType_METRIC_REPORTER_TYPE_NONE:
 		return true
+	case config.MetricReporterType_METRIC_REPORTER_TYPE_LOGGING, config.MetricReporterType_METRIC_REPORTER_TYPE_PROMETHEUS:
+		// metrics are written to stdout or a file, or scraped, hence no endpoint is needed.
+		return false
 	}
 
-	return cfg.GetTelemetry() == nil || !cfg.GetTelemetry().GetMetricsEnabled().GetValue()
+	// Disable metrics if the metrics endpoint is not set and the traces endpoint can't be used
+	// instead, i.e. the tracing exporter is not OTLP. By default the traces endpoint is zipkin
+	// which does not have support for metrics.
+	if len(reporting.GetMetricEndpoint().GetValue()) > 0 {
+		return false
+	}
+	switch reporting.GetTraceReporterType() {
+	case config.TraceReporterType_OTLP, config.TraceReporterType_OTLP_HTTP, config.TraceReporterType_UNSPECIFIED:
+		return false
+	default:
+		return true
+	}
 }
 
 func shouldUseCustomBatchSpanProcessor(cfg *config.AgentConfig) bool {
@@ -2,6 +2,7 @@ package opentelemetry
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"strings"
 
@@ -16,20 +17,36 @@ import (
 // InitAsAdditional initializes opentelemetry tracing and returns a span processor and a shutdown
 // function to flush data immediately on a termination signal.
 // This is ideal for when we use goagent along with other opentelemetry setups.
+// It exits if the span processor can't be set up, use TryInitAsAdditional to handle the error.
 func InitAsAdditional(cfg *config.AgentConfig) (trace.SpanProcessor, func()) {
+	sp, shutdown, err := TryInitAsAdditional(cfg, withSystemRootsFallback())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return sp, shutdown
+}
+
+// TryInitAsAdditional is like InitAsAdditional but returns an error if the span processor can't
+// be set up, or a noop span processor if WithDegradedMode is passed.
+func TryInitAsAdditional(cfg *config.AgentConfig, opts ...Option) (trace.SpanProcessor, func(), error) {
+	o := newOptions(opts)
+
 	mu.Lock()
 	defer mu.Unlock()
 	if initialized {
-		return nil, func() {}
+		return nil, func() {}, nil
 	}
 	sdkconfig.InitConfig(cfg)
 
 	exporterFactory = makeExporterFactory(cfg)
 	configFactory = makeConfigFactory(cfg)
 
-	exporter, err := exporterFactory()
+	exporter, err := exporterFactory(o.serviceOpts...)
+	if err == nil {
+		exporter, err = o.wrapWithRetryQueue(exporter)
+	}
 	if err != nil {
-		log.Fatal(err)
+		return initAsAdditionalFailed(o, ComponentTraceExporter, fmt.Errorf("failed to create trace exporter: %w", err))
 	}
 
 	if cfg.GetServiceName().GetValue() != "" {
@@ -38,12 +55,14 @@ func InitAsAdditional(cfg *config.AgentConfig) (trace.SpanProcessor, func()) {
 			resource.WithAttributes(createResources(getResourceAttrsWithServiceName(cfg.ResourceAttributes, cfg.GetServiceName().GetValue()), versionInfoAttributes)...),
 		)
 		if err != nil {
-			log.Fatal(err)
+			_ = exporter.Shutdown(context.Background())
+			return initAsAdditionalFailed(o, ComponentResource, fmt.Errorf("failed to create resource: %w", err))
 		}
 
 		exporter = addResourceToSpans(exporter, resource)
 	}
 
+	o.report(HealthEvent{Status: HealthOK})
 	return modbsp.CreateBatchSpanProcessor(
 			shouldUseCustomBatchSpanProcessor(cfg),
 			exporter,
@@ -54,7 +73,21 @@ func InitAsAdditional(cfg *config.AgentConfig) (trace.SpanProcessor, func()) {
 				log.Printf("error while shutting down exporter: %v\n", err)
 			}
 			sdkconfig.ResetConfig()
-		}
+		}, nil
+}
+
+// initAsAdditionalFailed reports a failing component and either returns a noop span processor
+// in degraded mode or the error.
+func initAsAdditionalFailed(o *options, component string, err error) (trace.SpanProcessor, func(), error) {
+	if !o.reportFailure(component, err) {
+		sdkconfig.ResetConfig()
+		return nil, nil, err
+	}
+
+	log.Printf("span processor falls back to noop: %v\n", err)
+	return noopSpanProcessor{}, func() {
+		sdkconfig.ResetConfig()
+	}, nil
 }
 
 type shieldResourceSpan struct {
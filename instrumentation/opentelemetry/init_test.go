@@ -7,11 +7,14 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	v1 "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/config"
+	sdkconfig "github.com/hypertrace/goagent/sdk/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel"
@@ -145,6 +148,38 @@ func TestShutdownFlushesAllSpans(t *testing.T) {
 	assert.True(t, requestIsReceived)
 }
 
+func TestSamplingFollowsConfigUpdates(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	cfg := config.Load()
+	cfg.ServiceName = config.String("my_example_svc")
+	cfg.Reporting.Endpoint = config.String(srv.URL)
+	cfg.Reporting.TraceReporterType = config.TraceReporterType_ZIPKIN
+	cfg.Enabled = config.Bool(true)
+
+	shutdown := Init(cfg)
+	defer shutdown()
+
+	_, span, spanEnder := StartSpan(context.Background(), "my_span", nil)
+	assert.False(t, span.IsNoop())
+	spanEnder()
+
+	cfg.Enabled = config.Bool(false)
+	sdkconfig.UpdateConfig(cfg)
+	_, span, spanEnder = StartSpan(context.Background(), "my_span", nil)
+	assert.True(t, span.IsNoop())
+	spanEnder()
+
+	cfg.Enabled = config.Bool(true)
+	sdkconfig.UpdateConfig(cfg)
+	_, span, spanEnder = StartSpan(context.Background(), "my_span", nil)
+	assert.False(t, span.IsNoop())
+	spanEnder()
+}
+
 func TestMultipleTraceProviders(t *testing.T) {
 	count := 0
 	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
@@ -299,49 +334,67 @@ func TestRemoveProtocolPrefixForOTLP(t *testing.T) {
 	)
 }
 
-func TestCreateTLSConfigNoCertFileAndInsecure(t *testing.T) {
+func TestNewTLSConfigNoCertFileAndInsecure(t *testing.T) {
 	// Just using default values
 	cfg := config.Load()
-	tlsConfig := createTLSConfig(cfg.GetReporting())
+	tlsConfig, err := newTLSConfig(cfg.GetReporting(), "localhost:4317", &ServiceOptions{})
+	require.NoError(t, err)
 
 	assert.True(t, tlsConfig.InsecureSkipVerify)
-	assert.Nil(t, tlsConfig.RootCAs)
+	assert.Nil(t, tlsConfig.VerifyConnection)
 }
 
-func TestCreateTLSConfigNoCertFileButSecure(t *testing.T) {
+func TestNewTLSConfigNoCertFileButSecure(t *testing.T) {
 	cfg := config.Load()
 	cfg.Reporting.Secure = config.Bool(true)
-	tlsConfig := createTLSConfig(cfg.GetReporting())
+	tlsConfig, err := newTLSConfig(cfg.GetReporting(), "localhost:4317", &ServiceOptions{})
+	require.NoError(t, err)
 
 	assert.False(t, tlsConfig.InsecureSkipVerify)
-	assert.Nil(t, tlsConfig.RootCAs)
+	assert.Nil(t, tlsConfig.VerifyConnection)
 }
 
-func TestCreateTLSConfigCertFilePresentButInsecure(t *testing.T) {
+func TestNewTLSConfigCertFilePresentButInsecure(t *testing.T) {
 	cfg := config.Load()
 	cfg.Reporting.CertFile = config.String("testdata/rootCA.crt")
-	tlsConfig := createTLSConfig(cfg.GetReporting())
+	tlsConfig, err := newTLSConfig(cfg.GetReporting(), "localhost:4317", &ServiceOptions{})
+	require.NoError(t, err)
 
 	assert.True(t, tlsConfig.InsecureSkipVerify)
-	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Nil(t, tlsConfig.VerifyConnection)
 }
 
-func TestCreateTLSConfigCertFilePresentAndSecure(t *testing.T) {
+func TestNewTLSConfigCertFilePresentAndSecure(t *testing.T) {
 	cfg := config.Load()
 	cfg.Reporting.Secure = config.Bool(true)
 	cfg.Reporting.CertFile = config.String("testdata/rootCA.crt")
-	tlsConfig := createTLSConfig(cfg.GetReporting())
+	tlsConfig, err := newTLSConfig(cfg.GetReporting(), "localhost:4317", &ServiceOptions{})
+	require.NoError(t, err)
 
-	assert.False(t, tlsConfig.InsecureSkipVerify)
-	assert.NotNil(t, tlsConfig.RootCAs)
+	// verified against the reloaded CA certificates instead of the default verification
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+	assert.NotNil(t, tlsConfig.VerifyConnection)
 }
 
-func TestCreateCaCertPoolFromFileThatDoesNotExist(t *testing.T) {
-	assert.Nil(t, createCaCertPoolFromFile("testdata/nonExistentCA.crt"))
+func TestNewTLSConfigFailsOnInvalidCertFile(t *testing.T) {
+	cfg := config.Load()
+	cfg.Reporting.Secure = config.Bool(true)
+	cfg.Reporting.CertFile = config.String("testdata/nonExistentCA.crt")
+	_, err := newTLSConfig(cfg.GetReporting(), "localhost:4317", &ServiceOptions{})
+	assert.Error(t, err)
+
+	_, err = newTLSConfig(config.Load().GetReporting(), "localhost:4317", &ServiceOptions{clientCertFile: "testdata/rootCA.crt"})
+	assert.Error(t, err)
 }
 
-func TestCreateCaCertPoolFromFileThatIsBogus(t *testing.T) {
-	assert.Nil(t, createCaCertPoolFromFile("testdata/fakeRootCA.crt"))
+func TestLoadCertPoolFromFileThatDoesNotExist(t *testing.T) {
+	_, err := loadCertPool("testdata/nonExistentCA.crt")
+	assert.Error(t, err)
+}
+
+func TestLoadCertPoolFromFileThatIsBogus(t *testing.T) {
+	_, err := loadCertPool("testdata/fakeRootCA.crt")
+	assert.Error(t, err)
 }
 
 type mockSpanProcessorWrapper struct {
@@ -591,6 +644,39 @@ func TestMakeExporterFactory_Headers_ZipkinAndOTLPHTTP(t *testing.T) {
 	}
 }
 
+func TestMakeExporterFactory_LoggingToFile(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &v1.AgentConfig{
+		Reporting: &v1.Reporting{
+			TraceReporterType:  v1.TraceReporterType_LOGGING,
+			Endpoint:           config.String("file://" + filepath.Join(dir, "spans.jsonl") + "?max_size_mb=1"),
+			MetricReporterType: v1.MetricReporterType_METRIC_REPORTER_TYPE_LOGGING,
+			MetricEndpoint:     config.String("file://" + filepath.Join(dir, "metrics.jsonl")),
+		},
+	}
+
+	exporter, err := makeExporterFactory(cfg)()
+	require.NoError(t, err)
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := tp.Tracer("test-tracer").Start(context.Background(), "test-span")
+	span.End()
+	require.NoError(t, tp.Shutdown(context.Background()))
+
+	content, err := os.ReadFile(filepath.Join(dir, "spans.jsonl"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"name":"test-span"`)
+
+	metricsExporter, err := makeMetricsExporterFactory(cfg)()
+	require.NoError(t, err)
+	require.NoError(t, metricsExporter.Shutdown(context.Background()))
+	assert.FileExists(t, filepath.Join(dir, "metrics.jsonl"))
+
+	cfg.Reporting.Endpoint = config.String("file:///tmp/spans.jsonl?max_files=1")
+	_, err = makeExporterFactory(cfg)()
+	assert.Error(t, err)
+}
+
 func TestCreateGrpcConn(t *testing.T) {
 	lis, err := net.Listen("tcp", "localhost:0")
 	require.NoError(t, err)
@@ -2,12 +2,14 @@ package tracetesting
 
 import (
 	"context"
+	"sync"
 
 	"go.opentelemetry.io/otel/sdk/trace"
 )
 
 // Recorder records spans being synced through the SpanSyncer interface.
 type Recorder struct {
+	mu    sync.Mutex
 	spans []trace.ReadOnlySpan
 }
 
@@ -19,6 +21,9 @@ func NewRecorder() *Recorder {
 
 // ExportSpans records spans into the internal buffer
 func (r *Recorder) ExportSpans(_ context.Context, s []trace.ReadOnlySpan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.spans = append(r.spans, s...)
 	return nil
 }
@@ -31,6 +36,9 @@ func (r *Recorder) Shutdown(_ context.Context) error {
 
 // Flush returns the current recorded spans and reset the recordings
 func (r *Recorder) Flush() []trace.ReadOnlySpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	spans := r.spans
 	r.spans = nil
 	return spans
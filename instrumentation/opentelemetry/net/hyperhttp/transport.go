@@ -13,3 +13,9 @@ import (
 func WrapTransport(delegate http.RoundTripper) http.RoundTripper {
 	return sdkhttp.WrapTransport(delegate, opentelemetry.SpanFromContext, map[string]string{})
 }
+
+// WrapTransportWithOptions is like WrapTransport but it also accepts instrumentation options,
+// the filter in the options is evaluated before the request is sent.
+func WrapTransportWithOptions(delegate http.RoundTripper, options *sdkhttp.Options) http.RoundTripper {
+	return sdkhttp.WrapTransportWithOptions(delegate, opentelemetry.SpanFromContext, options, map[string]string{})
+}
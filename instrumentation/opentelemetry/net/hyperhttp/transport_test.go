@@ -14,7 +14,11 @@ import (
 
 	config "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	"github.com/hypertrace/goagent/sdk"
 	sdkconfig "github.com/hypertrace/goagent/sdk/config"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	sdkhttp "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
+	otelcodes "go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
 
 	"github.com/stretchr/testify/assert"
@@ -87,6 +91,52 @@ func TestClientRequestIsSuccessfullyTraced(t *testing.T) {
 	assert.Equal(t, `{"id":123}`, attrs.Get("http.response.body").AsString())
 }
 
+// destinationFilter blocks the requests to the given host.
+type destinationFilter struct {
+	host string
+}
+
+func (f destinationFilter) Evaluate(span sdk.Span) result.FilterResult {
+	if span.GetAttributes().GetValue("server.address") == f.host {
+		return result.FilterResult{Block: true, ResponseStatusCode: 403}
+	}
+	return result.FilterResult{}
+}
+
+func TestClientRequestIsBlockedByFilter(t *testing.T) {
+	_, flusher := tracetesting.InitTracer()
+
+	reached := false
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reached = true
+	}))
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: otelhttp.NewTransport(
+			WrapTransportWithOptions(http.DefaultTransport, &sdkhttp.Options{Filter: destinationFilter{host: "127.0.0.1"}}),
+		),
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	res, err := client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 403, res.StatusCode)
+	assert.False(t, reached)
+	// the span ends once the body is closed
+	res.Body.Close()
+
+	spans := flusher()
+	assert.Equal(t, 1, len(spans), "unexpected number of spans")
+
+	span := spans[0]
+	assert.Equal(t, otelcodes.Error, span.Status().Code)
+
+	attrs := tracetesting.LookupAttributes(span.Attributes())
+	assert.True(t, attrs.Get("http.request.blocked").AsBool())
+	assert.Equal(t, int64(403), attrs.Get("http.response.status_code").AsInt64())
+}
+
 type failingTransport struct {
 	err error
 }
@@ -0,0 +1,56 @@
+package hyperwebsocket // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/nhooyr.io/hyperwebsocket"
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
+	sdkwebsocket "github.com/hypertrace/goagent/sdk/instrumentation/websocket"
+	"nhooyr.io/websocket"
+)
+
+// Conn wraps a *websocket.Conn recording the messages going through Read and
+// Write. Messages going through Reader and Writer aren't recorded.
+type Conn struct {
+	*websocket.Conn
+	recorder *sdkwebsocket.MessageRecorder
+}
+
+// Accept accepts a WebSocket handshake from a client and upgrades the connection.
+// The handshake is recorded in its own span and the messages are recorded as events
+// in the span of the request.
+func Accept(w http.ResponseWriter, r *http.Request, acceptOptions *websocket.AcceptOptions, options *sdkwebsocket.Options) (*Conn, error) {
+	_, span, end := sdkwebsocket.StartHandshake(r, opentelemetry.StartSpan)
+	conn, err := websocket.Accept(w, r, acceptOptions)
+	if err == nil && conn.Subprotocol() != "" {
+		span.SetAttribute("websocket.subprotocol", conn.Subprotocol())
+	}
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{
+		Conn:     conn,
+		recorder: sdkwebsocket.NewMessageRecorder(opentelemetry.SpanFromContext(r.Context()), options),
+	}, nil
+}
+
+// Read is a convenience method around Reader to read a single message
+// from the connection.
+func (c *Conn) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	typ, p, err := c.Conn.Read(ctx)
+	if err == nil {
+		c.recorder.Record(sdkwebsocket.DirectionReceived, int(typ), p)
+	}
+	return typ, p, err
+}
+
+// Write writes a message to the connection.
+func (c *Conn) Write(ctx context.Context, typ websocket.MessageType, p []byte) error {
+	err := c.Conn.Write(ctx, typ, p)
+	if err == nil {
+		c.recorder.Record(sdkwebsocket.DirectionSent, int(typ), p)
+	}
+	return err
+}
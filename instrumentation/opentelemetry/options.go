@@ -0,0 +1,161 @@
+package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/opentelemetry"
+
+import (
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/retryqueue"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+)
+
+type options struct {
+	degraded         bool
+	healthHook       HealthHook
+	serviceOpts      []ServiceOption
+	logger           *zap.Logger
+	useDefaultLogger bool
+	wrapper          SpanProcessorWrapper
+	versionInfoAttrs []attribute.KeyValue
+	resourceAttrs    []attribute.KeyValue
+	sampler          sdktrace.Sampler
+	exporterFactory  func(opts ...ServiceOption) (sdktrace.SpanExporter, error)
+	propagator       propagation.TextMapPropagator
+	meterProvider    metric.MeterProvider
+	idGenerator      sdktrace.IDGenerator
+	targets          []ReportingTarget
+	retryQueue       *retryqueue.Options
+	prometheus       *PrometheusOptions
+	// systemRootsFallback is set by the legacy init functions, see withSystemRootsFallback.
+	systemRootsFallback bool
+}
+
+// Option configures the agent created by New and the error returning init functions.
+type Option func(*options)
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		useDefaultLogger: true,
+		versionInfoAttrs: versionInfoAttributes,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithDegradedMode makes the init fall back to noop tracing, or to no metrics if only
+// the metrics exporter fails, instead of returning an error. Propagation keeps working
+// so traces aren't broken across services. Failures are reported to the health hook.
+func WithDegradedMode() Option {
+	return func(o *options) {
+		o.degraded = true
+	}
+}
+
+// WithHealthHook sets the hook reporting the outcome of the init.
+func WithHealthHook(hook HealthHook) Option {
+	return func(o *options) {
+		o.healthHook = hook
+	}
+}
+
+// WithServiceOptions sets the options used to create the exporters, e.g. WithHeaders.
+func WithServiceOptions(opts ...ServiceOption) Option {
+	return func(o *options) {
+		o.serviceOpts = append(o.serviceOpts, opts...)
+	}
+}
+
+// WithLogger sets the logger used by the agent and the opentelemetry internals, a zap
+// production logger is used by default. Passing nil leaves the loggers untouched.
+func WithLogger(logger *zap.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+		o.useDefaultLogger = false
+	}
+}
+
+// WithSpanProcessorWrapper sets a wrapper over the span processors, e.g. to enrich the
+// spans on start and end.
+func WithSpanProcessorWrapper(wrapper SpanProcessorWrapper) Option {
+	return func(o *options) {
+		o.wrapper = wrapper
+	}
+}
+
+// WithVersionInfoAttributes replaces the telemetry SDK name and version attributes added
+// to the resource.
+func WithVersionInfoAttributes(attrs ...attribute.KeyValue) Option {
+	return func(o *options) {
+		o.versionInfoAttrs = attrs
+	}
+}
+
+// WithResourceAttributes adds attributes to the resource on top of the ones in the
+// config, they take precedence over the config ones.
+func WithResourceAttributes(attrs ...attribute.KeyValue) Option {
+	return func(o *options) {
+		o.resourceAttrs = append(o.resourceAttrs, attrs...)
+	}
+}
+
+// WithSampler sets the sampler deciding on the spans, every span is sampled by default.
+// Spans are still dropped while the agent is disabled through a config update.
+func WithSampler(sampler sdktrace.Sampler) Option {
+	return func(o *options) {
+		o.sampler = sampler
+	}
+}
+
+// WithExporterFactory replaces the exporter created from the reporting config. The
+// factory is called for the agent and for every service registered afterwards.
+func WithExporterFactory(factory func(opts ...ServiceOption) (sdktrace.SpanExporter, error)) Option {
+	return func(o *options) {
+		o.exporterFactory = factory
+	}
+}
+
+// WithPropagator replaces the propagator created from the propagation formats in the config.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(o *options) {
+		o.propagator = propagator
+	}
+}
+
+// WithMeterProvider sets the meter provider used for the agent metrics instead of the
+// one created from the reporting config. The caller owns it hence the agent doesn't
+// shut it down.
+func WithMeterProvider(meterProvider metric.MeterProvider) Option {
+	return func(o *options) {
+		o.meterProvider = meterProvider
+	}
+}
+
+// WithIDGenerator sets the generator of trace and span IDs.
+func WithIDGenerator(idGenerator sdktrace.IDGenerator) Option {
+	return func(o *options) {
+		o.idGenerator = idGenerator
+	}
+}
+
+// WithRetryQueue spills the batches of spans failing to be exported into a queue on disk
+// and replays them once the endpoint recovers, instead of dropping them. It applies to the
+// exporter created for the agent, including the one from WithExporterFactory, but not to
+// the reporting targets nor the services registered afterwards as they can't share the
+// queue directory. Those can use retryqueue.New in their exporter factory.
+func WithRetryQueue(opts retryqueue.Options) Option {
+	return func(o *options) {
+		o.retryQueue = &opts
+	}
+}
+
+// withSystemRootsFallback makes the exporters of the agent, and of the services registered
+// afterwards, use the system roots if reporting.cert_file can't be loaded instead of failing.
+// The legacy init functions exiting on errors use it as they always went on with a warning.
+func withSystemRootsFallback() Option {
+	return func(o *options) {
+		o.serviceOpts = append(o.serviceOpts, systemRootsFallback)
+		o.systemRootsFallback = true
+	}
+}
@@ -0,0 +1,94 @@
+package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/opentelemetry"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+const (
+	defaultPrometheusAddr = "0.0.0.0:9464"
+	defaultPrometheusPath = "/metrics"
+)
+
+// PrometheusOptions configures how the agent metrics are exposed to Prometheus.
+type PrometheusOptions struct {
+	// Addr is the address the metrics are served on, e.g. ":9464". Defaults to the
+	// reporting.metric_endpoint in the config or 0.0.0.0:9464. Ignored if Registerer is set.
+	Addr string
+	// Path is the path the metrics are served on. Defaults to /metrics.
+	Path string
+	// Registerer registers the metrics with an existing registry, e.g. prometheus.DefaultRegisterer,
+	// instead of serving them. The application serves the registry itself.
+	Registerer prometheus.Registerer
+}
+
+// WithPrometheusReader exposes the agent metrics, e.g. the batch span processor counters
+// and the system metrics, to Prometheus instead of pushing them to the metric endpoint. It
+// is the same as setting the metric reporter type to METRIC_REPORTER_TYPE_PROMETHEUS in
+// the config but allows registering with an existing registry.
+func WithPrometheusReader(opts PrometheusOptions) Option {
+	return func(o *options) {
+		o.prometheus = &opts
+	}
+}
+
+func prometheusOptionsFromConfig(cfg *config.AgentConfig) PrometheusOptions {
+	return PrometheusOptions{Addr: cfg.GetReporting().GetMetricEndpoint().GetValue()}
+}
+
+// newPrometheusReader creates a reader collecting the metrics on scrape. Unless a registerer
+// is passed, the metrics are served on their own registry and the returned function stops
+// the server.
+func newPrometheusReader(opts PrometheusOptions) (metric.Reader, func(context.Context) error, error) {
+	if opts.Registerer != nil {
+		reader, err := otelprometheus.New(otelprometheus.WithRegisterer(opts.Registerer))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create prometheus reader: %w", err)
+		}
+		return reader, func(context.Context) error { return nil }, nil
+	}
+
+	registry := prometheus.NewRegistry()
+	reader, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create prometheus reader: %w", err)
+	}
+
+	addr := opts.Addr
+	if len(addr) == 0 {
+		addr = defaultPrometheusAddr
+	}
+	path := opts.Path
+	if len(path) == 0 {
+		path = defaultPrometheusPath
+	}
+
+	// listening beforehand so a busy address fails the init rather than the server.
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		_ = reader.Shutdown(context.Background())
+		return nil, nil, fmt.Errorf("failed to listen for prometheus scrapes on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("prometheus metrics server stopped: %v", err)
+		}
+	}()
+
+	return reader, server.Shutdown, nil
+}
@@ -0,0 +1,96 @@
+package opentelemetry
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	v1 "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func freeAddr(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+func newPrometheusTestAgent(t *testing.T, cfg *v1.AgentConfig, opts ...Option) *Agent {
+	cfg.ServiceName = config.String("my_service")
+	cfg.Telemetry.StartupSpanEnabled = config.Bool(false)
+
+	agent, err := New(cfg, append([]Option{
+		WithLogger(nil),
+		WithExporterFactory(func(...ServiceOption) (sdktrace.SpanExporter, error) {
+			return failingExporter{}, nil
+		}),
+	}, opts...)...)
+	require.NoError(t, err)
+	return agent
+}
+
+func TestPrometheusReaderRegistersWithRegisterer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	agent := newPrometheusTestAgent(t, config.Load(), WithPrometheusReader(PrometheusOptions{Registerer: registry}))
+	defer agent.Shutdown(context.Background())
+
+	counter, err := otel.Meter("test").Int64Counter("test.requests")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 3)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	names := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			names[family.GetName()] = m.GetCounter().GetValue()
+		}
+	}
+	// names are only escaped on exposition to scrapers not supporting UTF-8
+	assert.Equal(t, float64(3), names["test.requests_total"])
+	assert.Contains(t, names, "hypertrace.agent.memory")
+}
+
+func TestPrometheusReaderFromConfigServesMetrics(t *testing.T) {
+	addr := freeAddr(t)
+	cfg := config.Load()
+	cfg.Reporting.MetricReporterType = v1.MetricReporterType_METRIC_REPORTER_TYPE_PROMETHEUS
+	cfg.Reporting.MetricEndpoint = config.String(addr)
+
+	agent := newPrometheusTestAgent(t, cfg)
+
+	counter, err := otel.Meter("test").Int64Counter("test.requests")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 2)
+
+	res, err := http.Get("http://" + addr + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, string(body), "test_requests_total")
+
+	// the server stops along with the agent
+	require.NoError(t, agent.Shutdown(context.Background()))
+	_, err = http.Get("http://" + addr + "/metrics")
+	assert.Error(t, err)
+}
+
+func TestPrometheusReaderFailsOnBusyAddress(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	_, _, err = newPrometheusReader(PrometheusOptions{Addr: lis.Addr().String()})
+	assert.Error(t, err)
+}
@@ -0,0 +1,283 @@
+package retryqueue // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/retryqueue"
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// encoder turns spans into an OTLP export request. The OTLP exporter does the
+// transformation and hands the result to the capturing client.
+type encoder struct {
+	mu       sync.Mutex
+	exporter *otlptrace.Exporter
+	client   *capturingClient
+}
+
+func newEncoder() (*encoder, error) {
+	client := &capturingClient{}
+	exporter, err := otlptrace.New(context.Background(), client)
+	if err != nil {
+		return nil, err
+	}
+	return &encoder{exporter: exporter, client: client}, nil
+}
+
+func (e *encoder) encode(spans []sdktrace.ReadOnlySpan) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.client.captured = nil
+	if err := e.exporter.ExportSpans(context.Background(), spans); err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(&coltracepb.ExportTraceServiceRequest{ResourceSpans: e.client.captured})
+}
+
+type capturingClient struct {
+	captured []*tracepb.ResourceSpans
+}
+
+var _ otlptrace.Client = (*capturingClient)(nil)
+
+func (c *capturingClient) Start(context.Context) error {
+	return nil
+}
+
+func (c *capturingClient) Stop(context.Context) error {
+	return nil
+}
+
+func (c *capturingClient) UploadTraces(_ context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	c.captured = protoSpans
+	return nil
+}
+
+// decode turns an encoded OTLP export request back into spans. The child span count isn't
+// part of OTLP hence it is lost.
+func decode(data []byte) ([]sdktrace.ReadOnlySpan, error) {
+	req := &coltracepb.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(data, req); err != nil {
+		return nil, fmt.Errorf("failed to decode batch: %v", err)
+	}
+
+	var stubs tracetest.SpanStubs
+	for _, rs := range req.GetResourceSpans() {
+		res := resource.NewWithAttributes(rs.GetSchemaUrl(), keyValues(rs.GetResource().GetAttributes())...)
+		for _, ss := range rs.GetScopeSpans() {
+			scope := instrumentation.Scope{
+				Name:      ss.GetScope().GetName(),
+				Version:   ss.GetScope().GetVersion(),
+				SchemaURL: ss.GetSchemaUrl(),
+			}
+			for _, s := range ss.GetSpans() {
+				stub, err := spanStub(s)
+				if err != nil {
+					return nil, err
+				}
+				stub.Resource = res
+				stub.InstrumentationScope = scope
+				stubs = append(stubs, stub)
+			}
+		}
+	}
+	return stubs.Snapshots(), nil
+}
+
+func spanStub(s *tracepb.Span) (tracetest.SpanStub, error) {
+	traceID, err := traceIDFromBytes(s.GetTraceId())
+	if err != nil {
+		return tracetest.SpanStub{}, err
+	}
+
+	spanID, err := spanIDFromBytes(s.GetSpanId())
+	if err != nil {
+		return tracetest.SpanStub{}, err
+	}
+
+	traceState, err := trace.ParseTraceState(s.GetTraceState())
+	if err != nil {
+		return tracetest.SpanStub{}, fmt.Errorf("invalid trace state: %v", err)
+	}
+
+	// only sampled spans are exported
+	stub := tracetest.SpanStub{
+		Name: s.GetName(),
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: trace.FlagsSampled,
+			TraceState: traceState,
+		}),
+		SpanKind:          trace.SpanKind(s.GetKind()),
+		StartTime:         timeFromUnixNano(s.GetStartTimeUnixNano()),
+		EndTime:           timeFromUnixNano(s.GetEndTimeUnixNano()),
+		Attributes:        keyValues(s.GetAttributes()),
+		Status:            status(s.GetStatus()),
+		DroppedAttributes: int(s.GetDroppedAttributesCount()),
+		DroppedEvents:     int(s.GetDroppedEventsCount()),
+		DroppedLinks:      int(s.GetDroppedLinksCount()),
+	}
+
+	if len(s.GetParentSpanId()) > 0 {
+		parentID, err := spanIDFromBytes(s.GetParentSpanId())
+		if err != nil {
+			return tracetest.SpanStub{}, err
+		}
+		stub.Parent = trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  parentID,
+			Remote:  isRemote(s.GetFlags()),
+		})
+	}
+
+	for _, e := range s.GetEvents() {
+		stub.Events = append(stub.Events, sdktrace.Event{
+			Name:                  e.GetName(),
+			Time:                  timeFromUnixNano(e.GetTimeUnixNano()),
+			Attributes:            keyValues(e.GetAttributes()),
+			DroppedAttributeCount: int(e.GetDroppedAttributesCount()),
+		})
+	}
+
+	for _, l := range s.GetLinks() {
+		linkTraceID, err := traceIDFromBytes(l.GetTraceId())
+		if err != nil {
+			return tracetest.SpanStub{}, err
+		}
+		linkSpanID, err := spanIDFromBytes(l.GetSpanId())
+		if err != nil {
+			return tracetest.SpanStub{}, err
+		}
+		linkTraceState, err := trace.ParseTraceState(l.GetTraceState())
+		if err != nil {
+			return tracetest.SpanStub{}, fmt.Errorf("invalid link trace state: %v", err)
+		}
+
+		stub.Links = append(stub.Links, sdktrace.Link{
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID:    linkTraceID,
+				SpanID:     linkSpanID,
+				TraceState: linkTraceState,
+				Remote:     isRemote(l.GetFlags()),
+			}),
+			Attributes:            keyValues(l.GetAttributes()),
+			DroppedAttributeCount: int(l.GetDroppedAttributesCount()),
+		})
+	}
+
+	return stub, nil
+}
+
+func traceIDFromBytes(b []byte) (trace.TraceID, error) {
+	var id trace.TraceID
+	if len(b) != len(id) {
+		return id, fmt.Errorf("invalid trace ID of %d bytes", len(b))
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+func spanIDFromBytes(b []byte) (trace.SpanID, error) {
+	var id trace.SpanID
+	if len(b) != len(id) {
+		return id, fmt.Errorf("invalid span ID of %d bytes", len(b))
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+func isRemote(flags uint32) bool {
+	return flags&uint32(tracepb.SpanFlags_SPAN_FLAGS_CONTEXT_IS_REMOTE_MASK) != 0
+}
+
+func status(s *tracepb.Status) sdktrace.Status {
+	switch s.GetCode() {
+	case tracepb.Status_STATUS_CODE_OK:
+		return sdktrace.Status{Code: codes.Ok}
+	case tracepb.Status_STATUS_CODE_ERROR:
+		return sdktrace.Status{Code: codes.Error, Description: s.GetMessage()}
+	default:
+		return sdktrace.Status{Code: codes.Unset}
+	}
+}
+
+func timeFromUnixNano(nanos uint64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(nanos))
+}
+
+func keyValues(kvs []*commonpb.KeyValue) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		attrs = append(attrs, attribute.KeyValue{Key: attribute.Key(kv.GetKey()), Value: value(kv.GetValue())})
+	}
+	return attrs
+}
+
+// value turns an OTLP value into an attribute value, arrays are turned into slices of the
+// type of their first item as attributes only hold homogeneous slices.
+func value(v *commonpb.AnyValue) attribute.Value {
+	switch v.GetValue().(type) {
+	case *commonpb.AnyValue_BoolValue:
+		return attribute.BoolValue(v.GetBoolValue())
+	case *commonpb.AnyValue_IntValue:
+		return attribute.Int64Value(v.GetIntValue())
+	case *commonpb.AnyValue_DoubleValue:
+		return attribute.Float64Value(v.GetDoubleValue())
+	case *commonpb.AnyValue_ArrayValue:
+		return arrayValue(v.GetArrayValue().GetValues())
+	default:
+		return attribute.StringValue(v.GetStringValue())
+	}
+}
+
+func arrayValue(values []*commonpb.AnyValue) attribute.Value {
+	if len(values) == 0 {
+		return attribute.StringSliceValue(nil)
+	}
+
+	switch values[0].GetValue().(type) {
+	case *commonpb.AnyValue_BoolValue:
+		items := make([]bool, 0, len(values))
+		for _, v := range values {
+			items = append(items, v.GetBoolValue())
+		}
+		return attribute.BoolSliceValue(items)
+	case *commonpb.AnyValue_IntValue:
+		items := make([]int64, 0, len(values))
+		for _, v := range values {
+			items = append(items, v.GetIntValue())
+		}
+		return attribute.Int64SliceValue(items)
+	case *commonpb.AnyValue_DoubleValue:
+		items := make([]float64, 0, len(values))
+		for _, v := range values {
+			items = append(items, v.GetDoubleValue())
+		}
+		return attribute.Float64SliceValue(items)
+	default:
+		items := make([]string, 0, len(values))
+		for _, v := range values {
+			items = append(items, v.GetStringValue())
+		}
+		return attribute.StringSliceValue(items)
+	}
+}
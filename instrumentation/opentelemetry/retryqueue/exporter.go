@@ -0,0 +1,305 @@
+package retryqueue // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/retryqueue"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	meterName                 = "goagent.hypertrace.org/retryqueue"
+	queueDepthGaugeName       = "hypertrace.agent.retry_queue.depth"
+	queueSizeGaugeName        = "hypertrace.agent.retry_queue.size"
+	queueOldestAgeGaugeName   = "hypertrace.agent.retry_queue.oldest_age"
+	batchesDroppedCounterName = "hypertrace.agent.retry_queue.batches_dropped"
+)
+
+// Exporter wraps a span exporter, spilling the batches it fails to export into the disk
+// queue. Queued batches are replayed in order in the background, while the queue isn't
+// empty new batches are queued right away instead of hitting the endpoint known to be down.
+type Exporter struct {
+	exporter sdktrace.SpanExporter
+	opts     Options
+	queue    *diskQueue
+	encoder  *encoder
+	now      func() time.Time
+
+	// exportMu serializes the exports as exporters aren't expected to be called concurrently.
+	exportMu sync.Mutex
+
+	batchesDroppedCounter metric.Int64Counter
+	registration          metric.Registration
+
+	wakeCh   chan struct{}
+	stopCh   chan struct{}
+	stopWait sync.WaitGroup
+	stopOnce sync.Once
+}
+
+var _ sdktrace.SpanExporter = (*Exporter)(nil)
+
+// New wraps the exporter with a retry queue stored in opts.Dir. The batches left in the
+// queue by a previous run are replayed.
+func New(exporter sdktrace.SpanExporter, opts Options) (*Exporter, error) {
+	opts = opts.withDefaults()
+
+	queue, err := newDiskQueue(opts.Dir, opts.MaxSizeBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := newEncoder()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Exporter{
+		exporter: exporter,
+		opts:     opts,
+		queue:    queue,
+		encoder:  enc,
+		now:      time.Now,
+		wakeCh:   make(chan struct{}, 1),
+		stopCh:   make(chan struct{}),
+	}
+	e.setUpMetrics()
+
+	e.stopWait.Add(1)
+	go e.replay()
+	if queue.len() > 0 {
+		e.wake()
+	}
+
+	return e, nil
+}
+
+func (e *Exporter) setUpMetrics() {
+	mp := e.opts.MeterProvider
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(meterName)
+
+	var err error
+	e.batchesDroppedCounter, err = meter.Int64Counter(
+		batchesDroppedCounterName,
+		metric.WithDescription("Batches dropped from the retry queue because it was full, they were too old or failed too many replays"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	depth, err := meter.Int64ObservableGauge(
+		queueDepthGaugeName,
+		metric.WithDescription("Batches waiting in the retry queue"),
+	)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+
+	size, err := meter.Int64ObservableGauge(
+		queueSizeGaugeName,
+		metric.WithDescription("Size of the retry queue on disk"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+
+	oldestAge, err := meter.Float64ObservableGauge(
+		queueOldestAgeGaugeName,
+		metric.WithDescription("Age of the oldest batch in the retry queue"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+
+	e.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		queueDepth, queueSize, oldest := e.queue.stats()
+		o.ObserveInt64(depth, int64(queueDepth))
+		o.ObserveInt64(size, queueSize)
+		if queueDepth > 0 {
+			o.ObserveFloat64(oldestAge, e.now().Sub(oldest).Seconds())
+		} else {
+			o.ObserveFloat64(oldestAge, 0)
+		}
+		return nil
+	}, depth, size, oldestAge)
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// ExportSpans exports the spans, queuing them if the export fails or other batches are
+// waiting to be replayed. It only fails if the spans can't be queued.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	if e.queue.len() == 0 {
+		e.exportMu.Lock()
+		err := e.exporter.ExportSpans(ctx, spans)
+		e.exportMu.Unlock()
+		if err == nil {
+			return nil
+		}
+		otel.Handle(err)
+	}
+
+	data, err := e.encoder.encode(spans)
+	if err != nil {
+		return err
+	}
+
+	dropped, err := e.queue.push(data, e.now())
+	e.recordDropped(dropped)
+	if err != nil {
+		return err
+	}
+
+	e.wake()
+	return nil
+}
+
+func (e *Exporter) recordDropped(dropped int) {
+	if dropped > 0 && e.batchesDroppedCounter != nil {
+		e.batchesDroppedCounter.Add(context.Background(), int64(dropped))
+	}
+}
+
+func (e *Exporter) wake() {
+	select {
+	case e.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// replay exports the queued batches oldest first until the queue is empty, backing off
+// exponentially while the exports fail.
+func (e *Exporter) replay() {
+	defer e.stopWait.Done()
+
+	var backoff time.Duration
+	for {
+		if e.queue.len() == 0 {
+			select {
+			case <-e.wakeCh:
+			case <-e.stopCh:
+				return
+			}
+			// the batch was queued because the endpoint just failed, give it some time.
+			backoff = e.opts.InitialInterval
+		}
+
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-e.stopCh:
+				timer.Stop()
+				return
+			}
+		}
+
+		if err := e.replayOldest(); err != nil {
+			otel.Handle(err)
+			backoff = e.nextBackoff(backoff)
+			continue
+		}
+		backoff = 0
+	}
+}
+
+func (e *Exporter) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff < e.opts.InitialInterval {
+		return e.opts.InitialInterval
+	}
+	if backoff > e.opts.MaxInterval {
+		return e.opts.MaxInterval
+	}
+	return backoff
+}
+
+// replayOldest exports the oldest batch, removing it from the queue if it succeeds or if it
+// failed MaxAttempts times.
+func (e *Exporter) replayOldest() error {
+	if e.opts.MaxAge > 0 {
+		e.recordDropped(e.queue.removeExpired(e.now().Add(-e.opts.MaxAge)))
+	}
+
+	b, data, err := e.queue.peek()
+	if errors.Is(err, errQueueEmpty) {
+		return nil
+	}
+	if err != nil {
+		// the batch can't be read, there is no point in retrying it.
+		e.queue.remove(b)
+		e.recordDropped(1)
+		return err
+	}
+
+	spans, err := decode(data)
+	if err != nil {
+		e.queue.remove(b)
+		e.recordDropped(1)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.opts.ExportTimeout)
+	defer cancel()
+
+	e.exportMu.Lock()
+	err = e.exporter.ExportSpans(ctx, spans)
+	e.exportMu.Unlock()
+	if err != nil {
+		if e.opts.MaxAttempts > 0 && e.queue.failed(b) >= e.opts.MaxAttempts {
+			e.queue.remove(b)
+			e.recordDropped(1)
+			return fmt.Errorf("dropped batch after %d failed replays: %w", e.opts.MaxAttempts, err)
+		}
+		return err
+	}
+
+	e.queue.remove(b)
+	return nil
+}
+
+// Shutdown stops replaying and shuts down the wrapped exporter. The batches still queued
+// are kept on disk and replayed by the next run.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	var err error
+	e.stopOnce.Do(func() {
+		close(e.stopCh)
+
+		done := make(chan struct{})
+		go func() {
+			e.stopWait.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+
+		if e.registration != nil {
+			_ = e.registration.Unregister()
+		}
+		err = e.exporter.Shutdown(ctx)
+	})
+	return err
+}
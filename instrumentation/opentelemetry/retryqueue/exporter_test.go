@@ -0,0 +1,286 @@
+package retryqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// flakyExporter fails while it is down and records the spans exported otherwise.
+type flakyExporter struct {
+	mu    sync.Mutex
+	down  bool
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (e *flakyExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.down {
+		return errors.New("endpoint is down")
+	}
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *flakyExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+func (e *flakyExporter) setDown(down bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.down = down
+}
+
+func (e *flakyExporter) exportedNames() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var names []string
+	for _, s := range e.spans {
+		names = append(names, s.Name())
+	}
+	return names
+}
+
+func endedSpans(t *testing.T, names ...string) []sdktrace.ReadOnlySpan {
+	var spans []sdktrace.ReadOnlySpan
+	tp := sdktrace.NewTracerProvider()
+	for _, name := range names {
+		_, span := tp.Tracer("test").Start(context.Background(), name)
+		span.End()
+		spans = append(spans, span.(sdktrace.ReadOnlySpan))
+	}
+	return spans
+}
+
+func testOptions(t *testing.T) Options {
+	return Options{
+		Dir:             t.TempDir(),
+		InitialInterval: 10 * time.Millisecond,
+		MaxInterval:     20 * time.Millisecond,
+	}
+}
+
+func TestExportSpansGoesStraightToTheExporter(t *testing.T) {
+	inner := &flakyExporter{}
+	e, err := New(inner, testOptions(t))
+	require.NoError(t, err)
+	defer e.Shutdown(context.Background())
+
+	require.NoError(t, e.ExportSpans(context.Background(), endedSpans(t, "a")))
+	assert.Equal(t, []string{"a"}, inner.exportedNames())
+	assert.Equal(t, 0, e.queue.len())
+}
+
+func TestFailedBatchesAreReplayedInOrder(t *testing.T) {
+	inner := &flakyExporter{down: true}
+	e, err := New(inner, testOptions(t))
+	require.NoError(t, err)
+	defer e.Shutdown(context.Background())
+
+	require.NoError(t, e.ExportSpans(context.Background(), endedSpans(t, "a")))
+	require.NoError(t, e.ExportSpans(context.Background(), endedSpans(t, "b", "c")))
+	assert.Equal(t, 2, e.queue.len())
+	assert.Empty(t, inner.exportedNames())
+
+	inner.setDown(false)
+	assert.Eventually(t, func() bool {
+		return e.queue.len() == 0
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"a", "b", "c"}, inner.exportedNames())
+}
+
+func TestQueueIsBounded(t *testing.T) {
+	inner := &flakyExporter{down: true}
+	opts := testOptions(t)
+	opts.InitialInterval = time.Hour
+
+	data, err := mustEncoder(t).encode(endedSpans(t, "a"))
+	require.NoError(t, err)
+	// room for two batches
+	opts.MaxSizeBytes = int64(2*len(data) + len(data)/2)
+
+	e, err := New(inner, opts)
+	require.NoError(t, err)
+	defer e.Shutdown(context.Background())
+
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, e.ExportSpans(context.Background(), endedSpans(t, name)))
+	}
+	assert.Equal(t, 2, e.queue.len())
+
+	inner.setDown(false)
+	require.NoError(t, e.replayOldest())
+	require.NoError(t, e.replayOldest())
+	// the oldest batch was dropped
+	assert.Equal(t, []string{"b", "c"}, inner.exportedNames())
+}
+
+func TestExpiredBatchesAreDropped(t *testing.T) {
+	inner := &flakyExporter{down: true}
+	opts := testOptions(t)
+	opts.InitialInterval = time.Hour
+	opts.MaxAge = time.Minute
+
+	e, err := New(inner, opts)
+	require.NoError(t, err)
+	defer e.Shutdown(context.Background())
+
+	now := time.Now()
+	e.now = func() time.Time { return now }
+	require.NoError(t, e.ExportSpans(context.Background(), endedSpans(t, "a")))
+
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, e.ExportSpans(context.Background(), endedSpans(t, "b")))
+
+	inner.setDown(false)
+	require.NoError(t, e.replayOldest())
+	assert.Equal(t, []string{"b"}, inner.exportedNames())
+	assert.Equal(t, 0, e.queue.len())
+}
+
+func TestBatchesAreDroppedAfterMaxAttempts(t *testing.T) {
+	inner := &flakyExporter{down: true}
+	opts := testOptions(t)
+	opts.InitialInterval = time.Hour
+	opts.MaxAttempts = 2
+
+	e, err := New(inner, opts)
+	require.NoError(t, err)
+	defer e.Shutdown(context.Background())
+
+	require.NoError(t, e.ExportSpans(context.Background(), endedSpans(t, "a")))
+	require.NoError(t, e.ExportSpans(context.Background(), endedSpans(t, "b")))
+
+	assert.Error(t, e.replayOldest())
+	assert.Equal(t, 2, e.queue.len())
+	assert.ErrorContains(t, e.replayOldest(), "dropped batch after 2 failed replays")
+	assert.Equal(t, 1, e.queue.len())
+
+	// the attempts are counted per batch
+	inner.setDown(false)
+	require.NoError(t, e.replayOldest())
+	assert.Equal(t, []string{"b"}, inner.exportedNames())
+}
+
+func TestDefaultOptionsBoundTheReplays(t *testing.T) {
+	opts := Options{}.withDefaults()
+	assert.Equal(t, 24*time.Hour, opts.MaxAge)
+	// batches failing to be replayed are kept until they expire
+	assert.Zero(t, opts.MaxAttempts)
+
+	opts = Options{MaxAge: -1}.withDefaults()
+	assert.Negative(t, opts.MaxAge)
+}
+
+func TestQueueSurvivesRestarts(t *testing.T) {
+	opts := testOptions(t)
+
+	inner := &flakyExporter{down: true}
+	e, err := New(inner, opts)
+	require.NoError(t, err)
+	require.NoError(t, e.ExportSpans(context.Background(), endedSpans(t, "a")))
+	require.NoError(t, e.Shutdown(context.Background()))
+
+	inner = &flakyExporter{}
+	e, err = New(inner, opts)
+	require.NoError(t, err)
+	defer e.Shutdown(context.Background())
+
+	assert.Eventually(t, func() bool {
+		return len(inner.exportedNames()) == 1
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"a"}, inner.exportedNames())
+}
+
+func TestQueueMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	opts := testOptions(t)
+	opts.InitialInterval = time.Hour
+	opts.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	e, err := New(&flakyExporter{down: true}, opts)
+	require.NoError(t, err)
+	defer e.Shutdown(context.Background())
+
+	queuedAt := time.Now()
+	e.now = func() time.Time { return queuedAt }
+	require.NoError(t, e.ExportSpans(context.Background(), endedSpans(t, "a")))
+	require.NoError(t, e.ExportSpans(context.Background(), endedSpans(t, "b")))
+	e.now = func() time.Time { return queuedAt.Add(5 * time.Second) }
+
+	rm := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	values := map[string]float64{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Gauge[int64]:
+			values[m.Name] = float64(data.DataPoints[0].Value)
+		case metricdata.Gauge[float64]:
+			values[m.Name] = data.DataPoints[0].Value
+		}
+	}
+	assert.Equal(t, float64(2), values[queueDepthGaugeName])
+	assert.Greater(t, values[queueSizeGaugeName], float64(0))
+	assert.Equal(t, float64(5), values[queueOldestAgeGaugeName])
+}
+
+func mustEncoder(t *testing.T) *encoder {
+	enc, err := newEncoder()
+	require.NoError(t, err)
+	return enc
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	ctx, parent := tp.Tracer("test", trace.WithInstrumentationVersion("1.0")).Start(context.Background(), "parent")
+	_, span := tp.Tracer("test").Start(ctx, "child", trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(
+		attribute.String("http.method", "GET"),
+		attribute.Int64("http.status_code", 500),
+		attribute.Bool("retried", true),
+		attribute.StringSlice("tags", []string{"a", "b"}),
+	)
+	span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", 2)))
+	span.SetStatus(codes.Error, "failed")
+	span.End()
+	parent.End()
+
+	original := span.(sdktrace.ReadOnlySpan)
+	data, err := mustEncoder(t).encode([]sdktrace.ReadOnlySpan{original})
+	require.NoError(t, err)
+
+	spans, err := decode(data)
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+
+	decoded := spans[0]
+	assert.Equal(t, original.Name(), decoded.Name())
+	assert.Equal(t, original.SpanContext().TraceID(), decoded.SpanContext().TraceID())
+	assert.Equal(t, original.SpanContext().SpanID(), decoded.SpanContext().SpanID())
+	assert.Equal(t, original.Parent().SpanID(), decoded.Parent().SpanID())
+	assert.Equal(t, trace.SpanKindClient, decoded.SpanKind())
+	assert.True(t, original.StartTime().Equal(decoded.StartTime()))
+	assert.True(t, original.EndTime().Equal(decoded.EndTime()))
+	assert.ElementsMatch(t, original.Attributes(), decoded.Attributes())
+	assert.Equal(t, original.Status(), decoded.Status())
+	require.Len(t, decoded.Events(), 1)
+	assert.Equal(t, "retry", decoded.Events()[0].Name)
+	assert.Equal(t, "test", decoded.InstrumentationScope().Name)
+	assert.Equal(t, original.Resource().Attributes(), decoded.Resource().Attributes())
+}
@@ -0,0 +1,67 @@
+// Package retryqueue provides a span exporter wrapper that spills the batches failing to
+// be exported into a bounded queue on disk and replays them with exponential backoff once
+// the endpoint recovers. The queue survives restarts as batches are stored as files.
+package retryqueue // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/retryqueue"
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultMaxSizeBytes    = 100 * 1024 * 1024
+	defaultMaxAge          = 24 * time.Hour
+	defaultInitialInterval = time.Second
+	defaultMaxInterval     = time.Minute
+	defaultExportTimeout   = 30 * time.Second
+)
+
+// Options configures the queue and how batches are replayed.
+type Options struct {
+	// Dir is the directory holding the queued batches, it must not be shared among exporters.
+	Dir string
+	// MaxSizeBytes bounds the size of the queue, the oldest batches are dropped to make
+	// room for the new ones. Defaults to 100MB.
+	MaxSizeBytes int64
+	// MaxAge drops the batches queued for longer than this. Defaults to 24h, a negative
+	// value keeps the batches regardless of their age.
+	MaxAge time.Duration
+	// MaxAttempts drops a batch after this many failed replays so a batch the endpoint
+	// rejects for good, e.g. an invalid one, doesn't hold the queue. Replays failing because
+	// the endpoint is down count too, hence a low value drops batches during outages. The
+	// attempts are counted per batch and since the start of the process. No batch is dropped
+	// because of its failed replays if zero.
+	MaxAttempts int
+	// InitialInterval is the time to wait before replaying after a failure, it doubles on
+	// every failed replay up to MaxInterval. Defaults to 1s.
+	InitialInterval time.Duration
+	// MaxInterval caps the time between replays. Defaults to 1m.
+	MaxInterval time.Duration
+	// ExportTimeout bounds the export of a replayed batch. Defaults to 30s.
+	ExportTimeout time.Duration
+	// MeterProvider is used for the queue metrics, the global one is used by default.
+	MeterProvider metric.MeterProvider
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxSizeBytes <= 0 {
+		o.MaxSizeBytes = defaultMaxSizeBytes
+	}
+	if o.MaxAge == 0 {
+		o.MaxAge = defaultMaxAge
+	}
+	if o.InitialInterval <= 0 {
+		o.InitialInterval = defaultInitialInterval
+	}
+	if o.MaxInterval <= 0 {
+		o.MaxInterval = defaultMaxInterval
+	}
+	if o.MaxInterval < o.InitialInterval {
+		o.MaxInterval = o.InitialInterval
+	}
+	if o.ExportTimeout <= 0 {
+		o.ExportTimeout = defaultExportTimeout
+	}
+	return o
+}
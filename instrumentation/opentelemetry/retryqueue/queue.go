@@ -0,0 +1,215 @@
+package retryqueue // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/retryqueue"
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const batchExt = ".batch"
+
+var errQueueEmpty = errors.New("queue is empty")
+
+// batch is a queued batch of spans stored in its own file, named after the time it was
+// queued at, e.g. 00000001704207845000000000-000001.batch.
+type batch struct {
+	path     string
+	size     int64
+	queuedAt time.Time
+	attempts int
+}
+
+// diskQueue is a FIFO of batches stored as files in a directory, bounded by size.
+type diskQueue struct {
+	dir          string
+	maxSizeBytes int64
+
+	mu      sync.Mutex
+	batches []batch // oldest first
+	size    int64
+	seq     uint64
+}
+
+// newDiskQueue opens the queue in dir, picking up the batches left by a previous run.
+func newDiskQueue(dir string, maxSizeBytes int64) (*diskQueue, error) {
+	if len(dir) == 0 {
+		return nil, fmt.Errorf("queue directory is empty")
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory %s: %v", dir, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue directory %s: %v", dir, err)
+	}
+
+	q := &diskQueue{dir: dir, maxSizeBytes: maxSizeBytes}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), batchExt) {
+			continue
+		}
+
+		queuedAt, ok := parseBatchName(entry.Name())
+		if !ok {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		q.batches = append(q.batches, batch{
+			path:     filepath.Join(dir, entry.Name()),
+			size:     info.Size(),
+			queuedAt: queuedAt,
+		})
+		q.size += info.Size()
+	}
+
+	sort.Slice(q.batches, func(i, j int) bool {
+		return q.batches[i].path < q.batches[j].path
+	})
+	return q, nil
+}
+
+func parseBatchName(name string) (time.Time, bool) {
+	ts, _, ok := strings.Cut(strings.TrimSuffix(name, batchExt), "-")
+	if !ok {
+		return time.Time{}, false
+	}
+
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// push stores the batch, dropping the oldest ones if the queue would grow beyond its max
+// size. It returns the number of dropped batches.
+func (q *diskQueue) push(data []byte, now time.Time) (int, error) {
+	size := int64(len(data))
+	if size > q.maxSizeBytes {
+		return 0, fmt.Errorf("batch of %d bytes is larger than the queue", size)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	dropped := 0
+	for len(q.batches) > 0 && q.size+size > q.maxSizeBytes {
+		q.removeLocked(q.batches[0])
+		dropped++
+	}
+
+	q.seq++
+	path := filepath.Join(q.dir, fmt.Sprintf("%020d-%06d%s", now.UnixNano(), q.seq%1000000, batchExt))
+
+	// the batch is written under a temporary name so a crash doesn't leave a partial batch
+	// to be replayed.
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0640); err != nil {
+		_ = os.Remove(tmpPath)
+		return dropped, fmt.Errorf("failed to write batch: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return dropped, fmt.Errorf("failed to write batch: %v", err)
+	}
+
+	q.batches = append(q.batches, batch{path: path, size: size, queuedAt: now})
+	q.size += size
+	return dropped, nil
+}
+
+// peek returns the oldest batch along with its content.
+func (q *diskQueue) peek() (batch, []byte, error) {
+	q.mu.Lock()
+	if len(q.batches) == 0 {
+		q.mu.Unlock()
+		return batch{}, nil, errQueueEmpty
+	}
+	b := q.batches[0]
+	q.mu.Unlock()
+
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return b, nil, fmt.Errorf("failed to read batch %s: %v", b.path, err)
+	}
+	return b, data, nil
+}
+
+// remove removes the batch from the queue and the disk.
+func (q *diskQueue) remove(b batch) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.removeLocked(b)
+}
+
+func (q *diskQueue) removeLocked(b batch) {
+	for i := range q.batches {
+		if q.batches[i].path == b.path {
+			q.batches = append(q.batches[:i], q.batches[i+1:]...)
+			q.size -= b.size
+			_ = os.Remove(b.path)
+			return
+		}
+	}
+}
+
+// failed counts a failed replay of the batch and returns the failed replays so far.
+func (q *diskQueue) failed(b batch) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.batches {
+		if q.batches[i].path == b.path {
+			q.batches[i].attempts++
+			return q.batches[i].attempts
+		}
+	}
+	return 0
+}
+
+// removeExpired removes the batches queued before the deadline and returns how many were
+// removed.
+func (q *diskQueue) removeExpired(deadline time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	removed := 0
+	for len(q.batches) > 0 && q.batches[0].queuedAt.Before(deadline) {
+		q.removeLocked(q.batches[0])
+		removed++
+	}
+	return removed
+}
+
+// stats returns the number of batches, the size of the queue and the time the oldest batch
+// was queued at.
+func (q *diskQueue) stats() (depth int, size int64, oldest time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.batches) > 0 {
+		oldest = q.batches[0].queuedAt
+	}
+	return len(q.batches), q.size, oldest
+}
+
+func (q *diskQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.batches)
+}
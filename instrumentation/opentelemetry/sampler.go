@@ -0,0 +1,41 @@
+package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/opentelemetry"
+
+import (
+	"sync/atomic"
+
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// configSampler samples spans as told by the delegate, every span if nil, unless the agent
+// is disabled through a config update at runtime, in such case spans are dropped until the
+// agent is enabled again.
+type configSampler struct {
+	disabled atomic.Bool
+	delegate sdktrace.Sampler
+}
+
+var _ sdktrace.Sampler = (*configSampler)(nil)
+
+// update is subscribed to the config changes.
+func (s *configSampler) update(cfg *config.AgentConfig) {
+	s.disabled.Store(!cfg.GetEnabled().GetValue())
+}
+
+func (s *configSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if s.disabled.Load() {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.Drop,
+			Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	}
+	if s.delegate != nil {
+		return s.delegate.ShouldSample(p)
+	}
+	return sdktrace.AlwaysSample().ShouldSample(p)
+}
+
+func (s *configSampler) Description() string {
+	return "HypertraceConfigSampler"
+}
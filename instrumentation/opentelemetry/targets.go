@@ -0,0 +1,127 @@
+package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/opentelemetry"
+
+import (
+	"context"
+	"fmt"
+
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	modbsp "github.com/hypertrace/goagent/instrumentation/opentelemetry/batchspanprocessor"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/protobuf/proto"
+)
+
+// ReportingTarget is a destination spans are reported to on top of the one in the reporting
+// config, e.g. to send spans to the old and the new collector during a migration. Every
+// target gets its own batch span processor hence a slow target doesn't hold the others.
+// The service options apply to the targets too except WithGrpcConn and WithServerName.
+type ReportingTarget struct {
+	// Name identifies the target in errors and health events.
+	Name string
+	// Reporting holds the endpoint, trace reporter type and TLS settings (secure and cert
+	// file) of the target, the same way they are set in the agent config.
+	Reporting *config.Reporting
+	// Headers are sent along with the spans, they take precedence over the ones passed
+	// with WithHeaders.
+	Headers map[string]string
+	// ExporterWrapper wraps the exporter of the target, e.g. RemoveGoAgentAttrs to strip
+	// the captured headers and bodies before sending spans to a third party.
+	ExporterWrapper func(sdktrace.SpanExporter) sdktrace.SpanExporter
+	// ExporterFactory replaces the exporter created from Reporting.
+	ExporterFactory func(opts ...ServiceOption) (sdktrace.SpanExporter, error)
+}
+
+// WithReportingTarget adds a target spans are reported to. It can be passed multiple times,
+// the targets also apply to the services registered afterwards.
+func WithReportingTarget(target ReportingTarget) Option {
+	return func(o *options) {
+		o.targets = append(o.targets, target)
+	}
+}
+
+type targetExporterFactory struct {
+	name    string
+	factory func(opts ...ServiceOption) (sdktrace.SpanExporter, error)
+}
+
+func makeTargetExporterFactory(cfg *config.AgentConfig, target ReportingTarget) targetExporterFactory {
+	factory := target.ExporterFactory
+	if factory == nil {
+		targetCfg := proto.Clone(cfg).(*config.AgentConfig)
+		targetCfg.Reporting = target.Reporting
+		if targetCfg.Reporting == nil {
+			targetCfg.Reporting = &config.Reporting{}
+		}
+		factory = makeExporterFactory(targetCfg)
+	}
+
+	return targetExporterFactory{
+		name: target.Name,
+		factory: func(opts ...ServiceOption) (sdktrace.SpanExporter, error) {
+			targetOpts := append(append([]ServiceOption{}, opts...), withoutConnectionOptions, WithHeaders(target.Headers))
+			exporter, err := factory(targetOpts...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create trace exporter for target %q: %w", target.Name, err)
+			}
+
+			if target.ExporterWrapper != nil {
+				exporter = target.ExporterWrapper(exporter)
+			}
+			return exporter, nil
+		},
+	}
+}
+
+// withoutConnectionOptions drops the service options tied to the reporting endpoint, i.e. the
+// gRPC connection and the server name, as a target reports to its own endpoint.
+func withoutConnectionOptions(opts *ServiceOptions) {
+	opts.grpcConn = nil
+	opts.serverName = ""
+}
+
+func newBatchSpanProcessor(useCustomBsp bool, exporter sdktrace.SpanExporter) sdktrace.SpanProcessor {
+	return modbsp.CreateBatchSpanProcessor(useCustomBsp, exporter, sdktrace.WithBatchTimeout(batchTimeout))
+}
+
+// createTargetExporters creates the exporters of the reporting targets, the ones created
+// are shut down if any fails.
+func createTargetExporters(targets []targetExporterFactory, opts ...ServiceOption) ([]sdktrace.SpanExporter, error) {
+	exporters := make([]sdktrace.SpanExporter, 0, len(targets))
+	for _, target := range targets {
+		exporter, err := target.factory(opts...)
+		if err != nil {
+			shutdownExporters(exporters)
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+	return exporters, nil
+}
+
+// newSpanProcessors creates a batch span processor per exporter. The wrapper only wraps the
+// first processor as processors are called in order, hence the changes it does on start are
+// seen by the others.
+func newSpanProcessors(useCustomBsp bool, exporters []sdktrace.SpanExporter, wrapper SpanProcessorWrapper) []sdktrace.SpanProcessor {
+	sps := make([]sdktrace.SpanProcessor, 0, len(exporters))
+	for _, exporter := range exporters {
+		sps = append(sps, newBatchSpanProcessor(useCustomBsp, exporter))
+	}
+
+	if wrapper != nil && len(sps) > 0 {
+		sps[0] = &spanProcessorWithWrapper{wrapper, sps[0]}
+	}
+	return sps
+}
+
+func shutdownExporters(exporters []sdktrace.SpanExporter) {
+	for _, exporter := range exporters {
+		_ = exporter.Shutdown(context.Background())
+	}
+}
+
+func withSpanProcessors(sps []sdktrace.SpanProcessor) []sdktrace.TracerProviderOption {
+	opts := make([]sdktrace.TracerProviderOption, 0, len(sps))
+	for _, sp := range sps {
+		opts = append(opts, sdktrace.WithSpanProcessor(sp))
+	}
+	return opts
+}
@@ -0,0 +1,216 @@
+package opentelemetry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	v1 "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/config"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// keptRecorder keeps the recorded spans on shutdown.
+type keptRecorder struct {
+	*tracetesting.Recorder
+}
+
+func (keptRecorder) Shutdown(context.Context) error {
+	return nil
+}
+
+type zipkinCollector struct {
+	mu      sync.Mutex
+	spans   []model.SpanModel
+	headers http.Header
+}
+
+func (c *zipkinCollector) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	spans := []model.SpanModel{}
+	_ = json.Unmarshal(body, &spans)
+
+	c.mu.Lock()
+	c.spans = append(c.spans, spans...)
+	c.headers = r.Header
+	c.mu.Unlock()
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+func TestReportingTargets(t *testing.T) {
+	collector := &zipkinCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	cfg := config.Load()
+	cfg.ServiceName = config.String("my_service")
+	cfg.Telemetry.StartupSpanEnabled = config.Bool(false)
+
+	recorder := tracetesting.NewRecorder()
+	agent, err := New(cfg,
+		WithLogger(nil),
+		WithExporterFactory(func(...ServiceOption) (sdktrace.SpanExporter, error) {
+			return keptRecorder{recorder}, nil
+		}),
+		WithServiceOptions(WithHeaders(map[string]string{"x-service": "a", "x-token": "default"})),
+		WithReportingTarget(ReportingTarget{
+			Name: "zipkin",
+			Reporting: &v1.Reporting{
+				Endpoint:          config.String(srv.URL),
+				TraceReporterType: v1.TraceReporterType_ZIPKIN,
+			},
+			Headers:         map[string]string{"x-token": "zipkin"},
+			ExporterWrapper: RemoveGoAgentAttrs,
+		}),
+	)
+	require.NoError(t, err)
+
+	_, span := agent.TracerProvider().Tracer("test").Start(context.Background(), "my_span")
+	span.SetAttributes(attribute.String("http.request.header.x-forwarded-for", "1.2.3.4"), attribute.String("http.method", "GET"))
+	span.End()
+
+	// one shutdown flushes every target
+	require.NoError(t, agent.Shutdown(context.Background()))
+
+	spans := recorder.Flush()
+	require.Len(t, spans, 1)
+	assert.Len(t, spans[0].Attributes(), 2)
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	require.Len(t, collector.spans, 1)
+	assert.Equal(t, "my_span", collector.spans[0].Name)
+	assert.Equal(t, "GET", collector.spans[0].Tags["http.method"])
+	assert.NotContains(t, collector.spans[0].Tags, "http.request.header.x-forwarded-for")
+	assert.Equal(t, "a", collector.headers.Get("x-service"))
+	assert.Equal(t, "zipkin", collector.headers.Get("x-token"))
+}
+
+// startOTLPCollector starts an OTLP gRPC collector and returns its address.
+func startOTLPCollector(t *testing.T, metadataCh chan metadata.MD) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(server, &MockTraceService{metadataCh: metadataCh})
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	return listener.Addr().String()
+}
+
+func TestOTLPReportingTargetDoesNotUseTheGrpcConn(t *testing.T) {
+	primaryCh, targetCh := make(chan metadata.MD, 10), make(chan metadata.MD, 10)
+
+	conn, err := grpc.NewClient(startOTLPCollector(t, primaryCh), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	cfg := config.Load()
+	cfg.Reporting.Endpoint = config.String("127.0.0.1:1")
+	cfg.Reporting.TraceReporterType = v1.TraceReporterType_OTLP
+	cfg.Telemetry.StartupSpanEnabled = config.Bool(false)
+	cfg.Telemetry.MetricsEnabled = config.Bool(false)
+
+	agent, err := New(cfg,
+		WithLogger(nil),
+		WithServiceOptions(WithGrpcConn(conn)),
+		WithReportingTarget(ReportingTarget{
+			Name: "otlp",
+			Reporting: &v1.Reporting{
+				Endpoint:          config.String(startOTLPCollector(t, targetCh)),
+				TraceReporterType: v1.TraceReporterType_OTLP,
+			},
+			Headers: map[string]string{"x-target": "otlp"},
+		}),
+	)
+	require.NoError(t, err)
+
+	_, span := agent.TracerProvider().Tracer("test").Start(context.Background(), "my_span")
+	span.End()
+	require.NoError(t, agent.Shutdown(context.Background()))
+
+	// each collector receives the spans once, the target through its own endpoint
+	require.Len(t, primaryCh, 1)
+	assert.Empty(t, (<-primaryCh).Get("x-target"))
+	require.Len(t, targetCh, 1)
+	assert.Equal(t, []string{"otlp"}, (<-targetCh).Get("x-target"))
+}
+
+func TestReportingTargetsApplyToRegisteredServices(t *testing.T) {
+	cfg := config.Load()
+	cfg.Telemetry.StartupSpanEnabled = config.Bool(false)
+
+	recorder, targetRecorder := tracetesting.NewRecorder(), tracetesting.NewRecorder()
+	agent, err := New(cfg,
+		WithLogger(nil),
+		WithExporterFactory(func(...ServiceOption) (sdktrace.SpanExporter, error) {
+			return recorder, nil
+		}),
+		WithReportingTarget(ReportingTarget{
+			Name: "recorder",
+			ExporterFactory: func(...ServiceOption) (sdktrace.SpanExporter, error) {
+				return targetRecorder, nil
+			},
+		}),
+	)
+	require.NoError(t, err)
+	defer agent.Shutdown(context.Background())
+
+	startSpan, _, err := agent.RegisterService("custom_service", nil)
+	require.NoError(t, err)
+	_, _, ender := startSpan(context.Background(), "service_span", nil)
+	ender()
+	require.NoError(t, agent.ForceFlush(context.Background()))
+
+	assert.Len(t, recorder.Flush(), 1)
+	assert.Len(t, targetRecorder.Flush(), 1)
+}
+
+func TestFailingReportingTarget(t *testing.T) {
+	brokenTarget := ReportingTarget{
+		Name: "broken",
+		Reporting: &v1.Reporting{
+			Endpoint:          config.String("localhost:9411"),
+			TraceReporterType: v1.TraceReporterType_ZIPKIN,
+		},
+	}
+	recorderFactory := WithExporterFactory(func(...ServiceOption) (sdktrace.SpanExporter, error) {
+		return tracetesting.NewRecorder(), nil
+	})
+
+	_, err := New(config.Load(), WithLogger(nil), recorderFactory, WithReportingTarget(brokenTarget))
+	require.ErrorContains(t, err, `target "broken"`)
+
+	// in degraded mode the failing target is left out
+	var events []HealthEvent
+	agent, err := New(config.Load(), WithLogger(nil), recorderFactory, WithReportingTarget(brokenTarget),
+		WithDegradedMode(), WithHealthHook(func(e HealthEvent) {
+			events = append(events, e)
+		}))
+	require.NoError(t, err)
+	defer agent.Shutdown(context.Background())
+
+	require.Len(t, events, 1)
+	assert.Equal(t, HealthDegraded, events[0].Status)
+	assert.Equal(t, ComponentTraceExporter, events[0].Component)
+
+	_, _, err = agent.RegisterService("custom_service", nil)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,315 @@
+package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/opentelemetry"
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	otlpgrpc "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	otlphttp "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+)
+
+const grpcLoadBalancingConfig = `{"loadBalancingConfig": [ { "round_robin": {} } ]}`
+
+// Compression is the compression of the payloads sent by the OTLP exporters.
+type Compression string
+
+const (
+	NoCompression   Compression = ""
+	GzipCompression Compression = "gzip"
+)
+
+// WithClientCertificate sets the client certificate and key presented to the endpoint for
+// mutual TLS. It only applies when reporting.secure is true. The files are reloaded when they
+// change on disk, the same way as reporting.cert_file.
+func WithClientCertificate(certFile, keyFile string) ServiceOption {
+	return func(opts *ServiceOptions) {
+		opts.clientCertFile = certFile
+		opts.clientKeyFile = keyFile
+	}
+}
+
+// WithServerName overrides the server name sent to the endpoint and verified against its
+// certificate, e.g. when the endpoint is reached through an IP address or a proxy.
+func WithServerName(serverName string) ServiceOption {
+	return func(opts *ServiceOptions) {
+		opts.serverName = serverName
+	}
+}
+
+// WithCompression sets the compression of the payloads sent by the OTLP exporters, Zipkin
+// payloads aren't compressed.
+func WithCompression(compression Compression) ServiceOption {
+	return func(opts *ServiceOptions) {
+		opts.compression = compression
+	}
+}
+
+// WithExportTimeout bounds the time an export takes, the exporter default applies if zero.
+func WithExportTimeout(timeout time.Duration) ServiceOption {
+	return func(opts *ServiceOptions) {
+		opts.timeout = timeout
+	}
+}
+
+// systemRootsFallback makes the exporters use the system roots, logging the error, if
+// reporting.cert_file can't be loaded instead of failing.
+func systemRootsFallback(opts *ServiceOptions) {
+	opts.systemRootsFallback = true
+}
+
+// transport is the connection setup shared by the exporters. It is built from the reporting
+// config and the service options, and turned into the options of every exporter so they all
+// handle TLS, headers, compression and timeouts the same way.
+type transport struct {
+	endpoint      string
+	secure        bool
+	tlsConfig     *tls.Config
+	headers       map[string]string
+	compression   Compression
+	timeout       time.Duration
+	grpcConn      *grpc.ClientConn
+	loadBalancing bool
+}
+
+// newTransport creates the transport to the endpoint, failing if the cert files can't be loaded.
+func newTransport(reporting *config.Reporting, endpoint string, opts ...ServiceOption) (*transport, error) {
+	serviceOpts := &ServiceOptions{
+		headers: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(serviceOpts)
+	}
+
+	tlsConfig, err := newTLSConfig(reporting, endpoint, serviceOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transport{
+		endpoint:      endpoint,
+		secure:        reporting.GetSecure().GetValue(),
+		tlsConfig:     tlsConfig,
+		headers:       serviceOpts.headers,
+		compression:   serviceOpts.compression,
+		timeout:       serviceOpts.timeout,
+		grpcConn:      serviceOpts.grpcConn,
+		loadBalancing: reporting.GetEnableGrpcLoadbalancing().GetValue(),
+	}, nil
+}
+
+// newTLSConfig creates the TLS config verifying the endpoint against the reporting.cert_file,
+// or the system roots if not set, and presenting the client certificate if any. The cert files
+// are reloaded when they change, see certReloader. Verification is skipped if reporting.secure
+// is false, which only matters for the exporters reaching https endpoints while insecure, e.g.
+// Zipkin.
+func newTLSConfig(reporting *config.Reporting, endpoint string, serviceOpts *ServiceOptions) (*tls.Config, error) {
+	secure := reporting.GetSecure().GetValue()
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         serviceOpts.serverName,
+		InsecureSkipVerify: !secure,
+	}
+
+	certFile := reporting.GetCertFile().GetValue()
+	reloader, err := newCertReloader(certFile, serviceOpts.clientCertFile, serviceOpts.clientKeyFile)
+	if err != nil && len(certFile) > 0 && serviceOpts.systemRootsFallback {
+		log.Printf("error while loading cert file %s, using the system roots: %v", certFile, err)
+		certFile = ""
+		reloader, err = newCertReloader("", serviceOpts.clientCertFile, serviceOpts.clientKeyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(certFile) > 0 && secure {
+		serverName := serviceOpts.serverName
+		if len(serverName) == 0 {
+			serverName = endpointHost(endpoint)
+		}
+		// the default verification is replaced by one against the reloaded CA certificates.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = reloader.verifyConnection(serverName)
+	}
+
+	if reloader.clientCert != nil {
+		tlsConfig.GetClientCertificate = reloader.getClientCertificate
+	}
+
+	return tlsConfig, nil
+}
+
+// endpointHost returns the host of the endpoint, e.g. collector for http://collector:4318/v1/traces.
+func endpointHost(endpoint string) string {
+	hostport := strings.TrimLeft(removeProtocolPrefixForOTLP(endpoint), "/")
+	if i := strings.IndexByte(hostport, '/'); i >= 0 {
+		hostport = hostport[:i]
+	}
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
+
+// loadCertPool creates a cert pool from the PEM certificates in the file.
+func loadCertPool(certFile string) (*x509.CertPool, error) {
+	certBytes, err := os.ReadFile(filepath.Clean(certFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cert file %s: %w", certFile, err)
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(certBytes) {
+		return nil, fmt.Errorf("failed to read cert file %s: no PEM certificate found", certFile)
+	}
+	return certPool, nil
+}
+
+func (t *transport) grpcCredentials() credentials.TransportCredentials {
+	if !t.secure {
+		return insecure.NewCredentials()
+	}
+	return credentials.NewTLS(t.tlsConfig)
+}
+
+// grpcDialOptions returns the options of a gRPC connection to the endpoint.
+func (t *transport) grpcDialOptions() []grpc.DialOption {
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(t.grpcCredentials())}
+	if t.loadBalancing {
+		resolver.SetDefaultScheme("dns")
+		dialOpts = append(dialOpts, grpc.WithDefaultServiceConfig(grpcLoadBalancingConfig))
+	}
+	return dialOpts
+}
+
+func (t *transport) otlpTraceGRPCOptions() []otlpgrpc.Option {
+	opts := []otlpgrpc.Option{
+		otlpgrpc.WithEndpoint(removeProtocolPrefixForOTLP(t.endpoint)),
+		otlpgrpc.WithHeaders(t.headers),
+	}
+
+	if t.secure {
+		opts = append(opts, otlpgrpc.WithTLSCredentials(t.grpcCredentials()))
+	} else {
+		opts = append(opts, otlpgrpc.WithInsecure())
+	}
+
+	if t.compression != NoCompression {
+		opts = append(opts, otlpgrpc.WithCompressor(string(t.compression)))
+	}
+
+	if t.timeout > 0 {
+		opts = append(opts, otlpgrpc.WithTimeout(t.timeout))
+	}
+
+	if t.loadBalancing {
+		resolver.SetDefaultScheme("dns")
+		opts = append(opts, otlpgrpc.WithServiceConfig(grpcLoadBalancingConfig))
+	}
+
+	// Important: gRPC connection takes precedence over other connection based options
+	if t.grpcConn != nil {
+		opts = append(opts, otlpgrpc.WithGRPCConn(t.grpcConn))
+	}
+	return opts
+}
+
+func (t *transport) otlpTraceHTTPOptions() []otlphttp.Option {
+	opts := []otlphttp.Option{
+		otlphttp.WithEndpoint(t.endpoint),
+		otlphttp.WithHeaders(t.headers),
+	}
+
+	if t.secure {
+		opts = append(opts, otlphttp.WithTLSClientConfig(t.tlsConfig))
+	} else {
+		opts = append(opts, otlphttp.WithInsecure())
+	}
+
+	if t.compression == GzipCompression {
+		opts = append(opts, otlphttp.WithCompression(otlphttp.GzipCompression))
+	}
+
+	if t.timeout > 0 {
+		opts = append(opts, otlphttp.WithTimeout(t.timeout))
+	}
+	return opts
+}
+
+func (t *transport) otlpMetricGRPCOptions() []otlpmetricgrpc.Option {
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithEndpoint(removeProtocolPrefixForOTLP(t.endpoint)),
+		otlpmetricgrpc.WithHeaders(t.headers),
+	}
+
+	if t.secure {
+		opts = append(opts, otlpmetricgrpc.WithTLSCredentials(t.grpcCredentials()))
+	} else {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+
+	if t.compression != NoCompression {
+		opts = append(opts, otlpmetricgrpc.WithCompressor(string(t.compression)))
+	}
+
+	if t.timeout > 0 {
+		opts = append(opts, otlpmetricgrpc.WithTimeout(t.timeout))
+	}
+
+	if t.loadBalancing {
+		resolver.SetDefaultScheme("dns")
+		opts = append(opts, otlpmetricgrpc.WithServiceConfig(grpcLoadBalancingConfig))
+	}
+	return opts
+}
+
+func (t *transport) otlpMetricHTTPOptions() []otlpmetrichttp.Option {
+	opts := []otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpoint(removeProtocolPrefixForOTLP(t.endpoint)),
+		otlpmetrichttp.WithHeaders(t.headers),
+	}
+
+	if t.secure {
+		opts = append(opts, otlpmetrichttp.WithTLSClientConfig(t.tlsConfig))
+	} else {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+
+	if t.compression == GzipCompression {
+		opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+	}
+
+	if t.timeout > 0 {
+		opts = append(opts, otlpmetrichttp.WithTimeout(t.timeout))
+	}
+	return opts
+}
+
+func (t *transport) zipkinOptions() []zipkin.Option {
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: t.tlsConfig,
+		},
+		Timeout: t.timeout,
+	}
+
+	return []zipkin.Option{
+		zipkin.WithClient(client),
+		zipkin.WithHeaders(t.headers),
+	}
+}
@@ -0,0 +1,545 @@
+package opentelemetry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// testCA issues certificates for the TLS tests.
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue creates a certificate valid for 127.0.0.1 and returns the PEM encoded cert and key.
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{commonName},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, dir, name string, content []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, content, 0600))
+	return path
+}
+
+// newMTLSServerConfig creates the TLS config of a server named collector requiring client
+// certificates issued by the CA.
+func newMTLSServerConfig(t *testing.T, ca *testCA) *tls.Config {
+	serverCertPEM, serverKeyPEM := ca.issue(t, "collector", x509.ExtKeyUsageServerAuth)
+	serverCert, err := tls.X509KeyPair(serverCertPEM, serverKeyPEM)
+	require.NoError(t, err)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// newMTLSServer starts a server requiring client certificates issued by the CA.
+func newMTLSServer(t *testing.T, ca *testCA, handler http.Handler) *httptest.Server {
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = newMTLSServerConfig(t, ca)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOTLPHTTPTraceExporterWithClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+
+	var clientCN string
+	srv := newMTLSServer(t, ca, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientCN = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	clientCertPEM, clientKeyPEM := ca.issue(t, "goagent", x509.ExtKeyUsageClientAuth)
+	cfg := &v1.AgentConfig{
+		Reporting: &v1.Reporting{
+			TraceReporterType: v1.TraceReporterType_OTLP_HTTP,
+			Endpoint:          config.String(removeProtocolPrefixForOTLP(srv.URL)),
+			Secure:            config.Bool(true),
+			CertFile:          config.String(writeFile(t, dir, "ca.crt", ca.certPEM)),
+		},
+	}
+
+	span := endedSpan()
+
+	// the handshake fails without client certificate
+	exporter, err := makeExporterFactory(cfg)(WithExportTimeout(2 * time.Second))
+	require.NoError(t, err)
+	assert.Error(t, exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{span}))
+	_ = exporter.Shutdown(context.Background())
+
+	exporter, err = makeExporterFactory(cfg)(WithClientCertificate(
+		writeFile(t, dir, "client.crt", clientCertPEM),
+		writeFile(t, dir, "client.key", clientKeyPEM),
+	))
+	require.NoError(t, err)
+	defer exporter.Shutdown(context.Background())
+
+	require.NoError(t, exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{span}))
+	assert.Equal(t, "goagent", clientCN)
+}
+
+func TestOTLPHTTPMetricsExporter(t *testing.T) {
+	type request struct {
+		path            string
+		contentEncoding string
+		token           string
+	}
+	requests := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- request{r.URL.Path, r.Header.Get("Content-Encoding"), r.Header.Get("test-token-key")}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cfg := config.Load()
+	cfg.Reporting.TraceReporterType = v1.TraceReporterType_OTLP_HTTP
+	cfg.Reporting.Endpoint = config.String(removeProtocolPrefixForOTLP(srv.URL))
+	// the traces endpoint is used for metrics
+	assert.False(t, shouldDisableMetrics(cfg))
+
+	exporter, err := makeMetricsExporterFactory(cfg)(
+		WithHeaders(map[string]string{"test-token-key": "test-token-value"}),
+		WithCompression(GzipCompression),
+		WithExportTimeout(2*time.Second),
+	)
+	require.NoError(t, err)
+	defer exporter.Shutdown(context.Background())
+
+	err = exporter.Export(context.Background(), &metricdata.ResourceMetrics{Resource: resource.Empty()})
+	require.NoError(t, err)
+
+	select {
+	case r := <-requests:
+		assert.Equal(t, "/v1/metrics", r.path)
+		assert.Equal(t, "gzip", r.contentEncoding)
+		assert.Equal(t, "test-token-value", r.token)
+	case <-time.After(2 * time.Second):
+		t.Fatal("metrics were not received")
+	}
+}
+
+func TestExporterFactoriesFailOnInvalidCertFile(t *testing.T) {
+	for _, reporterType := range []v1.TraceReporterType{
+		v1.TraceReporterType_ZIPKIN,
+		v1.TraceReporterType_OTLP,
+		v1.TraceReporterType_OTLP_HTTP,
+	} {
+		t.Run(reporterType.String(), func(t *testing.T) {
+			cfg := config.Load()
+			cfg.Reporting.TraceReporterType = reporterType
+			cfg.Reporting.Endpoint = config.String("localhost:4317")
+			cfg.Reporting.MetricEndpoint = config.String("localhost:4317")
+			cfg.Reporting.Secure = config.Bool(true)
+			cfg.Reporting.CertFile = config.String("testdata/fakeRootCA.crt")
+
+			_, err := makeExporterFactory(cfg)()
+			assert.Error(t, err)
+
+			_, err = makeMetricsExporterFactory(cfg)()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLegacyInitGoesOnWithInvalidCertFile(t *testing.T) {
+	for reporterType, endpoint := range map[v1.TraceReporterType]string{
+		v1.TraceReporterType_ZIPKIN:    "https://localhost:9411/api/v2/spans",
+		v1.TraceReporterType_OTLP:      "localhost:4317",
+		v1.TraceReporterType_OTLP_HTTP: "localhost:4318",
+	} {
+		t.Run(reporterType.String(), func(t *testing.T) {
+			cfg := config.Load()
+			cfg.Reporting.TraceReporterType = reporterType
+			cfg.Reporting.Endpoint = config.String(endpoint)
+			cfg.Reporting.Secure = config.Bool(true)
+			cfg.Reporting.CertFile = config.String("testdata/fakeRootCA.crt")
+			cfg.Telemetry.StartupSpanEnabled = config.Bool(false)
+			cfg.Telemetry.MetricsEnabled = config.Bool(false)
+
+			_, err := TryInit(cfg)
+			require.Error(t, err)
+
+			// the legacy init functions use the system roots instead of exiting
+			shutdown := InitWithSpanProcessorWrapperAndZap(cfg, nil, versionInfoAttributes, nil)
+			defer shutdown()
+
+			_, _, err = RegisterService("custom_service", nil)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestShouldDisableMetricsPerReporterType(t *testing.T) {
+	tCases := map[string]struct {
+		traceReporterType  v1.TraceReporterType
+		metricReporterType v1.MetricReporterType
+		disabled           bool
+	}{
+		"otlp http traces endpoint": {v1.TraceReporterType_OTLP_HTTP, v1.MetricReporterType_METRIC_REPORTER_TYPE_OTLP, false},
+		"unspecified is otlp":       {v1.TraceReporterType_UNSPECIFIED, v1.MetricReporterType_METRIC_REPORTER_TYPE_OTLP, false},
+		"zipkin traces endpoint":    {v1.TraceReporterType_ZIPKIN, v1.MetricReporterType_METRIC_REPORTER_TYPE_OTLP, true},
+		"logging to stdout":         {v1.TraceReporterType_ZIPKIN, v1.MetricReporterType_METRIC_REPORTER_TYPE_LOGGING, false},
+		"prometheus":                {v1.TraceReporterType_ZIPKIN, v1.MetricReporterType_METRIC_REPORTER_TYPE_PROMETHEUS, false},
+		"none":                      {v1.TraceReporterType_OTLP, v1.MetricReporterType_METRIC_REPORTER_TYPE_NONE, true},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.Load()
+			cfg.Reporting.TraceReporterType = tCase.traceReporterType
+			cfg.Reporting.MetricReporterType = tCase.metricReporterType
+			assert.Equal(t, tCase.disabled, shouldDisableMetrics(cfg))
+		})
+	}
+}
+
+// clientCNHandler sends the common name of the client certificates to the channel. The
+// connections are closed so every request goes through a handshake.
+func clientCNHandler(clientCNs chan<- string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientCNs <- r.TLS.PeerCertificates[0].Subject.CommonName
+		w.Header().Set("Connection", "close")
+		// zipkin expects 202
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func receiveClientCN(t *testing.T, clientCNs <-chan string) string {
+	select {
+	case cn := <-clientCNs:
+		return cn
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not received")
+		return ""
+	}
+}
+
+func TestExportersReloadRotatedCertificates(t *testing.T) {
+	tCases := map[string]struct {
+		reporterType v1.TraceReporterType
+		endpoint     func(url string) string
+		export       func(cfg *v1.AgentConfig, opts ...ServiceOption) (func() error, error)
+	}{
+		"zipkin": {
+			reporterType: v1.TraceReporterType_ZIPKIN,
+			endpoint:     func(url string) string { return url + "/api/v2/spans" },
+			export:       exportSpans,
+		},
+		"otlp http": {
+			reporterType: v1.TraceReporterType_OTLP_HTTP,
+			endpoint:     removeProtocolPrefixForOTLP,
+			export:       exportSpans,
+		},
+		"otlp http metrics": {
+			reporterType: v1.TraceReporterType_OTLP_HTTP,
+			endpoint:     removeProtocolPrefixForOTLP,
+			export: func(cfg *v1.AgentConfig, opts ...ServiceOption) (func() error, error) {
+				exporter, err := makeMetricsExporterFactory(cfg)(opts...)
+				if err != nil {
+					return nil, err
+				}
+				t.Cleanup(func() { _ = exporter.Shutdown(context.Background()) })
+				return func() error {
+					return exporter.Export(context.Background(), &metricdata.ResourceMetrics{Resource: resource.Empty()})
+				}, nil
+			},
+		},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			ca := newTestCA(t)
+			dir := t.TempDir()
+
+			clientCNs := make(chan string, 1)
+			srv := newMTLSServer(t, ca, clientCNHandler(clientCNs))
+
+			cfg := config.Load()
+			cfg.Reporting.TraceReporterType = tCase.reporterType
+			cfg.Reporting.Endpoint = config.String(tCase.endpoint(srv.URL))
+			cfg.Reporting.Secure = config.Bool(true)
+			cfg.Reporting.CertFile = config.String(writeFile(t, dir, "ca.crt", ca.certPEM))
+
+			certPEM, keyPEM := ca.issue(t, "goagent", x509.ExtKeyUsageClientAuth)
+			certFile := writeFile(t, dir, "client.crt", certPEM)
+			keyFile := writeFile(t, dir, "client.key", keyPEM)
+
+			export, err := tCase.export(cfg, WithClientCertificate(certFile, keyFile), WithExportTimeout(5*time.Second))
+			require.NoError(t, err)
+
+			require.NoError(t, export())
+			assert.Equal(t, "goagent", receiveClientCN(t, clientCNs))
+
+			rotatedCertPEM, rotatedKeyPEM := ca.issue(t, "goagent-rotated", x509.ExtKeyUsageClientAuth)
+			rotateFile(t, certFile, rotatedCertPEM)
+			rotateFile(t, keyFile, rotatedKeyPEM)
+
+			require.NoError(t, export())
+			assert.Equal(t, "goagent-rotated", receiveClientCN(t, clientCNs))
+		})
+	}
+}
+
+func exportSpans(cfg *v1.AgentConfig, opts ...ServiceOption) (func() error, error) {
+	exporter, err := makeExporterFactory(cfg)(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		return exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{endedSpan()})
+	}, nil
+}
+
+type clientCNTraceService struct {
+	coltracepb.UnimplementedTraceServiceServer
+	clientCNs chan string
+}
+
+func (s *clientCNTraceService) Export(ctx context.Context, _ *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	p, _ := peer.FromContext(ctx)
+	s.clientCNs <- p.AuthInfo.(credentials.TLSInfo).State.PeerCertificates[0].Subject.CommonName
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+// startMTLSGRPCServer serves the trace service on the address until the returned function is called.
+func startMTLSGRPCServer(t *testing.T, addr string, tlsConfig *tls.Config, clientCNs chan string) func() {
+	lis, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	coltracepb.RegisterTraceServiceServer(server, &clientCNTraceService{clientCNs: clientCNs})
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	return server.GracefulStop
+}
+
+func TestOTLPGRPCReloadsRotatedCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+
+	// reserving a port so the server can be restarted on it
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	serverTLSConfig := newMTLSServerConfig(t, ca)
+	clientCNs := make(chan string, 1)
+	stop := startMTLSGRPCServer(t, addr, serverTLSConfig, clientCNs)
+
+	cfg := config.Load()
+	cfg.Reporting.TraceReporterType = v1.TraceReporterType_OTLP
+	cfg.Reporting.Endpoint = config.String(addr)
+	cfg.Reporting.Secure = config.Bool(true)
+	cfg.Reporting.CertFile = config.String(writeFile(t, dir, "ca.crt", ca.certPEM))
+
+	certPEM, keyPEM := ca.issue(t, "goagent", x509.ExtKeyUsageClientAuth)
+	certFile := writeFile(t, dir, "client.crt", certPEM)
+	keyFile := writeFile(t, dir, "client.key", keyPEM)
+
+	conn, err := CreateGrpcConn(cfg, WithClientCertificate(certFile, keyFile))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	export, err := exportSpans(cfg, WithGrpcConn(conn))
+	require.NoError(t, err)
+
+	require.NoError(t, export())
+	assert.Equal(t, "goagent", receiveClientCN(t, clientCNs))
+
+	rotatedCertPEM, rotatedKeyPEM := ca.issue(t, "goagent-rotated", x509.ExtKeyUsageClientAuth)
+	rotateFile(t, certFile, rotatedCertPEM)
+	rotateFile(t, keyFile, rotatedKeyPEM)
+
+	// the connection is only established again once the server goes away
+	stop()
+	stop = startMTLSGRPCServer(t, addr, serverTLSConfig, clientCNs)
+	defer stop()
+	waitForReconnection(t, conn)
+
+	require.NoError(t, export())
+	assert.Equal(t, "goagent-rotated", receiveClientCN(t, clientCNs))
+}
+
+// waitForReconnection waits for the connection to drop and be established again, so the export
+// doesn't hit the exporter retry backoff.
+func waitForReconnection(t *testing.T, conn *grpc.ClientConn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for state := conn.GetState(); state == connectivity.Ready; state = conn.GetState() {
+		require.True(t, conn.WaitForStateChange(ctx, state), "connection wasn't dropped")
+	}
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		conn.Connect()
+		require.True(t, conn.WaitForStateChange(ctx, state), "connection wasn't established again")
+	}
+}
+
+func TestExportersReloadRotatedCACertificate(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+
+	clientCNs := make(chan string, 1)
+	srv := newMTLSServer(t, ca, clientCNHandler(clientCNs))
+
+	// the collector certificate is issued by a CA we don't trust yet
+	caFile := writeFile(t, dir, "ca.crt", newTestCA(t).certPEM)
+	certPEM, keyPEM := ca.issue(t, "goagent", x509.ExtKeyUsageClientAuth)
+
+	cfg := config.Load()
+	cfg.Reporting.TraceReporterType = v1.TraceReporterType_OTLP_HTTP
+	cfg.Reporting.Endpoint = config.String(removeProtocolPrefixForOTLP(srv.URL))
+	cfg.Reporting.Secure = config.Bool(true)
+	cfg.Reporting.CertFile = config.String(caFile)
+
+	export, err := exportSpans(cfg,
+		WithClientCertificate(writeFile(t, dir, "client.crt", certPEM), writeFile(t, dir, "client.key", keyPEM)),
+		WithExportTimeout(2*time.Second),
+	)
+	require.NoError(t, err)
+	assert.Error(t, export())
+
+	rotateFile(t, caFile, ca.certPEM)
+	require.NoError(t, export())
+	assert.Equal(t, "goagent", receiveClientCN(t, clientCNs))
+}
+
+func TestExporterWithServerName(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+
+	clientCNs := make(chan string, 1)
+	srv := newMTLSServer(t, ca, clientCNHandler(clientCNs))
+	certPEM, keyPEM := ca.issue(t, "goagent", x509.ExtKeyUsageClientAuth)
+	certFile := writeFile(t, dir, "client.crt", certPEM)
+	keyFile := writeFile(t, dir, "client.key", keyPEM)
+
+	for _, secure := range []bool{true, false} {
+		cfg := config.Load()
+		cfg.Reporting.TraceReporterType = v1.TraceReporterType_ZIPKIN
+		cfg.Reporting.Endpoint = config.String(srv.URL + "/api/v2/spans")
+		cfg.Reporting.Secure = config.Bool(secure)
+		cfg.Reporting.CertFile = config.String(writeFile(t, dir, "ca.crt", ca.certPEM))
+
+		// the certificate is issued for collector and 127.0.0.1
+		for serverName, valid := range map[string]bool{"": true, "collector": true, "other": !secure} {
+			export, err := exportSpans(cfg,
+				WithServerName(serverName),
+				WithClientCertificate(certFile, keyFile),
+				WithExportTimeout(2*time.Second),
+			)
+			require.NoError(t, err)
+
+			err = export()
+			if valid {
+				assert.NoError(t, err, "server name %q, secure %t", serverName, secure)
+				<-clientCNs
+			} else {
+				assert.Error(t, err, "server name %q, secure %t", serverName, secure)
+			}
+		}
+	}
+}
+
+func TestEndpointHost(t *testing.T) {
+	for endpoint, host := range map[string]string{
+		"collector:4317":                      "collector",
+		"http://collector:4318/v1/traces":     "collector",
+		"https://127.0.0.1:9411/api/v2/spans": "127.0.0.1",
+		"dns:///collector:4317":               "collector",
+		"[::1]:4317":                          "::1",
+		"collector":                           "collector",
+	} {
+		assert.Equal(t, host, endpointHost(endpoint), endpoint)
+	}
+}
+
+func endedSpan() sdktrace.ReadOnlySpan {
+	_, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "test-span")
+	span.End()
+	return span.(sdktrace.ReadOnlySpan)
+}
@@ -10,6 +10,19 @@ func InitConfig(c *agentconfig.AgentConfig) {
 	internalconfig.InitConfig(c)
 }
 
+// UpdateConfig replaces the config at runtime and notifies the subscribers, the data
+// capture settings apply to the instrumented handlers from the next request on.
+func UpdateConfig(c *agentconfig.AgentConfig) {
+	internalconfig.UpdateConfig(c)
+}
+
+// Subscribe registers a callback called with the new config every time it is updated
+// and returns a function to unsubscribe. The callbacks are called in the order the updates
+// are applied, one update at a time, hence they must not update the config themselves.
+func Subscribe(callback func(*agentconfig.AgentConfig)) func() {
+	return internalconfig.Subscribe(callback)
+}
+
 func ResetConfig() {
 	internalconfig.ResetConfig()
 }
@@ -0,0 +1,133 @@
+package config // import "github.com/hypertrace/goagent/sdk/config"
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	agentconfig "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/config"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"google.golang.org/protobuf/proto"
+)
+
+const defaultWatchInterval = 30 * time.Second
+
+// Source loads the agent config from a location watched for changes.
+type Source interface {
+	Load(ctx context.Context) (*agentconfig.AgentConfig, error)
+}
+
+type fileSource struct {
+	path string
+}
+
+// FileSource returns a source loading the config from a JSON or YAML file, as told by
+// its extension. Env vars and default values apply the same way they do in config.Load.
+func FileSource(path string) Source {
+	return &fileSource{path: path}
+}
+
+func (s *fileSource) Load(_ context.Context) (*agentconfig.AgentConfig, error) {
+	content, err := os.ReadFile(filepath.Clean(s.path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %v", s.path, err)
+	}
+
+	return config.Parse(content, strings.TrimPrefix(filepath.Ext(s.path), "."))
+}
+
+type endpointSource struct {
+	url    string
+	client *http.Client
+}
+
+// EndpointSource returns a source loading the config from an HTTP endpoint, usually a
+// local one e.g. a sidecar. The response is parsed as YAML if its content type says so
+// and as JSON otherwise.
+func EndpointSource(url string) Source {
+	return &endpointSource{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (s *endpointSource) Load(ctx context.Context) (*agentconfig.AgentConfig, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config request: %v", err)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request config from %s: %v", s.url, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", res.StatusCode, s.url)
+	}
+
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config from %s: %v", s.url, err)
+	}
+
+	format := "json"
+	if strings.Contains(res.Header.Get("Content-Type"), "yaml") {
+		format = "yaml"
+	}
+	return config.Parse(content, format)
+}
+
+// Watch loads the config from the source every interval, 30s if zero, and updates the
+// agent config when it changes. Data capture settings apply from the next request on
+// without wrapping the handlers again. Failures are logged and the current config is
+// kept. It returns a function to stop watching.
+func Watch(source Source, interval time.Duration) func() {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			reload(ctx, source)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// reload updates the config if the one loaded from the source is different.
+func reload(ctx context.Context, source Source) {
+	cfg, err := source.Load(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("failed to reload the config: %v\n", err)
+		}
+		return
+	}
+
+	if proto.Equal(cfg, internalconfig.GetConfig()) {
+		return
+	}
+	internalconfig.UpdateConfig(cfg)
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	agentconfig "github.com/hypertrace/agent-config/gen/go/v1"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchFileUpdatesConfig(t *testing.T) {
+	InitConfig(&agentconfig.AgentConfig{ServiceName: agentconfig.String("my_service")})
+	defer ResetConfig()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("service_name: my_service\ndata_capture:\n  body_max_size_bytes: 10\n"), 0600))
+
+	updates := make(chan *agentconfig.AgentConfig, 10)
+	unsubscribe := Subscribe(func(cfg *agentconfig.AgentConfig) {
+		updates <- cfg
+	})
+	defer unsubscribe()
+
+	stop := Watch(FileSource(path), 10*time.Millisecond)
+	defer stop()
+
+	cfg := <-updates
+	assert.Equal(t, int32(10), cfg.GetDataCapture().GetBodyMaxSizeBytes().GetValue())
+	assert.Equal(t, int32(10), internalconfig.GetConfig().GetDataCapture().GetBodyMaxSizeBytes().GetValue())
+
+	// a broken file keeps the current config
+	require.NoError(t, os.WriteFile(path, []byte("service_name: [\n"), 0600))
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, updates)
+	assert.Equal(t, int32(10), internalconfig.GetConfig().GetDataCapture().GetBodyMaxSizeBytes().GetValue())
+
+	require.NoError(t, os.WriteFile(path, []byte("service_name: my_service\ndata_capture:\n  body_max_size_bytes: 20\n"), 0600))
+	cfg = <-updates
+	assert.Equal(t, int32(20), cfg.GetDataCapture().GetBodyMaxSizeBytes().GetValue())
+}
+
+func TestWatchEndpointUpdatesConfig(t *testing.T) {
+	InitConfig(&agentconfig.AgentConfig{ServiceName: agentconfig.String("my_service")})
+	defer ResetConfig()
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"service_name": "my_service", "data_capture": {"http_body": {"request": false}}}`))
+	}))
+	defer srv.Close()
+
+	updates := make(chan *agentconfig.AgentConfig, 10)
+	unsubscribe := Subscribe(func(cfg *agentconfig.AgentConfig) {
+		updates <- cfg
+	})
+	defer unsubscribe()
+
+	stop := Watch(EndpointSource(srv.URL), 10*time.Millisecond)
+	cfg := <-updates
+	assert.False(t, cfg.GetDataCapture().GetHttpBody().GetRequest().GetValue())
+
+	// the config doesn't change hence subscribers aren't notified again
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	assert.Greater(t, atomic.LoadInt32(&requests), int32(1))
+	assert.Empty(t, updates)
+}
@@ -74,6 +74,16 @@ func SetEncodedBodyAttribute(attrName string, body []byte, truncated bool, span
 	}
 }
 
+// TruncateBody truncates the body to bodyMaxSize without splitting multibyte runes
+// and tells whether the body was truncated.
+func TruncateBody(body []byte, bodyMaxSize int) ([]byte, bool) {
+	if len(body) <= bodyMaxSize {
+		return body, false
+	}
+
+	return truncateUTF8Bytes(body, bodyMaxSize), true
+}
+
 // Largely based on:
 // https://github.com/jmacd/opentelemetry-go/blob/e8973b75b230246545cdae072a548c83877cba09/sdk/trace/span.go#L358-L375
 // Intention here is to ensure that we capture the final parsed rune to prevent splitting multibyte rune in the middle
@@ -0,0 +1,203 @@
+package bodyattribute // import "github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"mime"
+	"net/url"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const jsonContentType = "application/json"
+
+// Body is a captured body to be decoded.
+type Body struct {
+	// ContentType is the value of the Content-Type header, parameters included.
+	ContentType string
+	// Path is the path of the request URL, e.g. "/helloworld.Greeter/SayHello".
+	Path string
+	// Response tells whether the body is the one of the response.
+	Response bool
+	// Data is the captured body, it may be cut by the capture limit.
+	Data []byte
+}
+
+// Decoder turns a body into the form that gets recorded, e.g. JSON, along with the
+// content type of the decoded form. It returns false if the body can't be decoded,
+// in such case the body is recorded as is.
+type Decoder interface {
+	Decode(body Body) (decoded []byte, contentType string, ok bool)
+}
+
+// DecoderFunc is an adapter to use functions as decoders.
+type DecoderFunc func(body Body) ([]byte, string, bool)
+
+// Decode calls f(body).
+func (f DecoderFunc) Decode(body Body) ([]byte, string, bool) {
+	return f(body)
+}
+
+// Decoders maps media types, e.g. "application/x-protobuf" or "application/*", to the
+// decoder for the bodies of that type.
+type Decoders map[string]Decoder
+
+// DefaultDecoders returns the built-in decoders: urlencoded forms are turned into a JSON
+// object with the values per key and protobuf messages are turned into JSON using the
+// descriptors registered in protoregistry.GlobalFiles.
+func DefaultDecoders() Decoders {
+	protobufDecoder := NewProtobufDecoder(nil)
+	return Decoders{
+		"application/x-www-form-urlencoded": FormDecoder,
+		"application/x-protobuf":            protobufDecoder,
+		"application/protobuf":              protobufDecoder,
+		"application/grpc-web":              protobufDecoder,
+		"application/grpc-web+proto":        protobufDecoder,
+	}
+}
+
+// Supports tells whether there is a decoder for the given content type.
+func (d Decoders) Supports(contentType string) bool {
+	decoder, ok := lookupMediaType(d, parseMediaType(contentType))
+	return ok && decoder != nil
+}
+
+// Decode decodes the body with the decoder for its content type. It returns the body
+// and its content type as they are if there is no decoder or the decoding fails.
+func (d Decoders) Decode(body Body) ([]byte, string) {
+	if len(d) == 0 || len(body.Data) == 0 {
+		return body.Data, body.ContentType
+	}
+
+	decoder, ok := lookupMediaType(d, parseMediaType(body.ContentType))
+	if !ok || decoder == nil {
+		return body.Data, body.ContentType
+	}
+
+	decoded, contentType, ok := decoder.Decode(body)
+	if !ok {
+		return body.Data, body.ContentType
+	}
+	return decoded, contentType
+}
+
+// FormDecoder turns urlencoded forms into a JSON object with the values per key, e.g.
+// {"name":["Jacinto"]}, so each value can be told apart from its key.
+var FormDecoder Decoder = DecoderFunc(func(body Body) ([]byte, string, bool) {
+	values, err := url.ParseQuery(string(body.Data))
+	if err != nil && len(values) == 0 {
+		return nil, "", false
+	}
+
+	decoded, err := json.Marshal(values)
+	if err != nil {
+		return nil, "", false
+	}
+	return decoded, jsonContentType, true
+})
+
+// protobufDecoder turns protobuf messages into JSON.
+type protobufDecoder struct {
+	files *protoregistry.Files
+	types *dynamicpb.Types
+}
+
+// NewProtobufDecoder returns a decoder turning protobuf messages into JSON using the
+// given descriptors, protoregistry.GlobalFiles if nil. The message type is taken from
+// the "messageType" or "proto" parameter of the content type, e.g.
+// `application/x-protobuf; messageType="helloworld.HelloRequest"`, or from the RPC
+// method in the request path, e.g. "/helloworld.Greeter/SayHello". gRPC-Web frames
+// are unwrapped, only the first message is decoded.
+func NewProtobufDecoder(files *protoregistry.Files) Decoder {
+	if files == nil {
+		files = protoregistry.GlobalFiles
+	}
+	return &protobufDecoder{files: files, types: dynamicpb.NewTypes(files)}
+}
+
+func (d *protobufDecoder) Decode(body Body) ([]byte, string, bool) {
+	md, ok := d.messageDescriptor(body)
+	if !ok {
+		return nil, "", false
+	}
+
+	data := body.Data
+	if strings.HasPrefix(parseMediaType(body.ContentType), "application/grpc-web") {
+		if data, ok = firstGRPCWebMessage(data); !ok {
+			return nil, "", false
+		}
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := (proto.UnmarshalOptions{Resolver: d.types}).Unmarshal(data, msg); err != nil {
+		return nil, "", false
+	}
+
+	decoded, err := (protojson.MarshalOptions{Resolver: d.types}).Marshal(msg)
+	if err != nil {
+		return nil, "", false
+	}
+	return decoded, jsonContentType, true
+}
+
+// messageDescriptor finds out the descriptor of the message in the body.
+func (d *protobufDecoder) messageDescriptor(body Body) (protoreflect.MessageDescriptor, bool) {
+	if _, params, err := mime.ParseMediaType(body.ContentType); err == nil {
+		for _, param := range []string{"messagetype", "proto"} {
+			if name, ok := params[param]; ok {
+				desc, err := d.files.FindDescriptorByName(protoreflect.FullName(name))
+				if err != nil {
+					return nil, false
+				}
+				md, ok := desc.(protoreflect.MessageDescriptor)
+				return md, ok
+			}
+		}
+	}
+
+	// e.g. "/helloworld.Greeter/SayHello"
+	service, method, ok := strings.Cut(strings.TrimPrefix(body.Path, "/"), "/")
+	if !ok {
+		return nil, false
+	}
+	desc, err := d.files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, false
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, false
+	}
+	methodDesc := sd.Methods().ByName(protoreflect.Name(method))
+	if methodDesc == nil {
+		return nil, false
+	}
+	if body.Response {
+		return methodDesc.Output(), true
+	}
+	return methodDesc.Input(), true
+}
+
+// firstGRPCWebMessage returns the first message of a gRPC-Web body, messages are
+// prefixed by a flags byte and their length.
+func firstGRPCWebMessage(data []byte) ([]byte, bool) {
+	const prefixLen = 5
+	for len(data) >= prefixLen {
+		flags, length := data[0], int(binary.BigEndian.Uint32(data[1:prefixLen]))
+		data = data[prefixLen:]
+		if length > len(data) {
+			return nil, false
+		}
+		// skips the trailers frame and compressed messages
+		if flags == 0 {
+			return data[:length], true
+		}
+		data = data[length:]
+	}
+	return nil, false
+}
@@ -0,0 +1,176 @@
+package bodyattribute
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// greeterFiles returns the descriptors of a helloworld.Greeter service.
+func greeterFiles(t *testing.T) *protoregistry.Files {
+	stringField := func(name string) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(1),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		}
+	}
+
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("helloworld.proto"),
+		Package: proto.String("helloworld"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("HelloRequest"), Field: []*descriptorpb.FieldDescriptorProto{stringField("name")}},
+			{Name: proto.String("HelloReply"), Field: []*descriptorpb.FieldDescriptorProto{stringField("message")}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Greeter"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("SayHello"),
+				InputType:  proto.String(".helloworld.HelloRequest"),
+				OutputType: proto.String(".helloworld.HelloReply"),
+			}},
+		}},
+	}, nil)
+	require.NoError(t, err)
+
+	files := &protoregistry.Files{}
+	require.NoError(t, files.RegisterFile(fd))
+	return files
+}
+
+func greeterMessage(t *testing.T, files *protoregistry.Files, name, field, value string) []byte {
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	require.NoError(t, err)
+
+	md := desc.(protoreflect.MessageDescriptor)
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName(protoreflect.Name(field)), protoreflect.ValueOfString(value))
+	data, err := proto.Marshal(msg)
+	require.NoError(t, err)
+	return data
+}
+
+func grpcWebFrame(flags byte, message []byte) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+func TestFormDecoder(t *testing.T) {
+	decoded, contentType := DefaultDecoders().Decode(Body{
+		ContentType: "application/x-www-form-urlencoded",
+		Data:        []byte("name=Jacinto&tags=a&tags=b+c&empty="),
+	})
+	assert.Equal(t, "application/json", contentType)
+	assert.JSONEq(t, `{"name":["Jacinto"],"tags":["a","b c"],"empty":[""]}`, string(decoded))
+}
+
+func TestProtobufDecoder(t *testing.T) {
+	files := greeterFiles(t)
+	request := greeterMessage(t, files, "helloworld.HelloRequest", "name", "Jacinto")
+	reply := greeterMessage(t, files, "helloworld.HelloReply", "message", "Hello Jacinto")
+	decoders := Decoders{
+		"application/x-protobuf": NewProtobufDecoder(files),
+		"application/grpc-web":   NewProtobufDecoder(files),
+	}
+
+	tCases := map[string]struct {
+		body         Body
+		expectedBody string
+	}{
+		"message type from the content type": {
+			body: Body{
+				ContentType: `application/x-protobuf; messageType="helloworld.HelloReply"`,
+				Data:        reply,
+			},
+			expectedBody: `{"message":"Hello Jacinto"}`,
+		},
+		"request message type from the path": {
+			body: Body{
+				ContentType: "application/x-protobuf",
+				Path:        "/helloworld.Greeter/SayHello",
+				Data:        request,
+			},
+			expectedBody: `{"name":"Jacinto"}`,
+		},
+		"response message type from the path": {
+			body: Body{
+				ContentType: "application/x-protobuf",
+				Path:        "/helloworld.Greeter/SayHello",
+				Response:    true,
+				Data:        reply,
+			},
+			expectedBody: `{"message":"Hello Jacinto"}`,
+		},
+		"gRPC-Web frames are unwrapped": {
+			body: Body{
+				ContentType: "application/grpc-web",
+				Path:        "/helloworld.Greeter/SayHello",
+				Response:    true,
+				Data:        append(grpcWebFrame(0, reply), grpcWebFrame(0x80, []byte("grpc-status:0\r\n"))...),
+			},
+			expectedBody: `{"message":"Hello Jacinto"}`,
+		},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			decoded, contentType := decoders.Decode(tCase.body)
+			assert.Equal(t, "application/json", contentType)
+			assert.JSONEq(t, tCase.expectedBody, string(decoded))
+		})
+	}
+}
+
+func TestProtobufDecoderUsesGlobalFiles(t *testing.T) {
+	data, err := proto.Marshal(wrapperspb.String("Jacinto"))
+	require.NoError(t, err)
+
+	decoded, contentType := DefaultDecoders().Decode(Body{
+		ContentType: "application/protobuf; proto=google.protobuf.StringValue",
+		Data:        data,
+	})
+	assert.Equal(t, "application/json", contentType)
+	assert.Equal(t, `"Jacinto"`, string(decoded))
+}
+
+func TestBodyIsKeptIfItCantBeDecoded(t *testing.T) {
+	decoders := Decoders{"application/x-protobuf": NewProtobufDecoder(greeterFiles(t))}
+
+	tCases := map[string]Body{
+		"no decoder":           {ContentType: "application/json", Data: []byte(`{"name":"Jacinto"}`)},
+		"unknown message type": {ContentType: "application/x-protobuf; messageType=helloworld.Unknown", Data: []byte("\x0a\x01a")},
+		"unknown method":       {ContentType: "application/x-protobuf", Path: "/helloworld.Greeter/SayBye", Data: []byte("\x0a\x01a")},
+		"malformed message":    {ContentType: "application/x-protobuf", Path: "/helloworld.Greeter/SayHello", Data: []byte("\x0a\x05a")},
+	}
+
+	for name, body := range tCases {
+		t.Run(name, func(t *testing.T) {
+			decoded, contentType := decoders.Decode(body)
+			assert.Equal(t, body.ContentType, contentType)
+			assert.Equal(t, body.Data, decoded)
+		})
+	}
+}
+
+func TestDecodersSupports(t *testing.T) {
+	decoders := Decoders{"application/x-protobuf": NewProtobufDecoder(nil), "text/*": FormDecoder}
+	assert.True(t, decoders.Supports("application/x-protobuf; messageType=foo.Bar"))
+	assert.True(t, decoders.Supports("text/plain"))
+	assert.False(t, decoders.Supports("application/json"))
+	assert.False(t, Decoders(nil).Supports("application/x-protobuf"))
+}
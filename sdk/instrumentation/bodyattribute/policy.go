@@ -0,0 +1,138 @@
+package bodyattribute // import "github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hypertrace/goagent/sdk"
+)
+
+// Encoding is the way a body is recorded as a span attribute. The name of the
+// attribute tells the encoding being used, e.g. "http.request.body.base64".
+type Encoding string
+
+const (
+	// EncodingRaw records the body as is. Bodies that are not valid UTF-8 are
+	// base64 encoded instead as they would break the exporters otherwise.
+	EncodingRaw Encoding = "raw"
+	// EncodingBase64 records the base64 encoded body in the ".base64" attribute.
+	EncodingBase64 Encoding = "base64"
+	// EncodingHash records only the SHA-256 of the body in the ".sha256" attribute.
+	EncodingHash Encoding = "sha256"
+	// EncodingSize records only the size of the body in the ".captured_size" attribute, i.e.
+	// the size of the body as it would have been recorded.
+	EncodingSize Encoding = "size"
+)
+
+// Policy maps media types, e.g. "image/png" or "image/*", to the encoding used
+// for the bodies of that type. Bodies of any other type are recorded raw unless
+// they are binary, as sniffed from their content, or multipart/form-data in
+// which case they are base64 encoded.
+type Policy map[string]Encoding
+
+// encoding returns the encoding for the body based on the media type declared
+// by contentType or sniffed from the body if none.
+func (p Policy) encoding(contentType string, body []byte) Encoding {
+	mediaType := parseMediaType(contentType)
+	if mediaType == "" {
+		mediaType = parseMediaType(http.DetectContentType(body))
+	}
+
+	if encoding, ok := lookupMediaType(p, mediaType); ok {
+		return encoding
+	}
+
+	if mediaType == "multipart/form-data" || isBinary(body) {
+		return EncodingBase64
+	}
+	return EncodingRaw
+}
+
+// SetBodyAttributeWithPolicy truncates the body and sets it as a span attribute
+// encoded according to the policy for its content type. The content type is
+// sniffed from the body when it is empty.
+func SetBodyAttributeWithPolicy(attrName string, contentType string, body []byte, bodyMaxSize int, policy Policy, span sdk.Span) {
+	if len(body) == 0 {
+		return
+	}
+
+	switch policy.encoding(contentType, body) {
+	case EncodingHash:
+		sum := sha256.Sum256(body)
+		span.SetAttribute(attrName+".sha256", hex.EncodeToString(sum[:]))
+	case EncodingSize:
+		span.SetAttribute(attrName+".captured_size", int64(len(body)))
+	case EncodingBase64:
+		SetTruncatedEncodedBodyAttribute(attrName, body, bodyMaxSize, span)
+	default:
+		truncatedBody, truncated := TruncateBody(body, bodyMaxSize)
+		if !utf8.Valid(trimCutRune(truncatedBody)) {
+			SetEncodedBodyAttribute(attrName, truncatedBody, truncated, span)
+			return
+		}
+		SetBodyAttribute(attrName, trimCutRune(truncatedBody), truncated, span)
+	}
+}
+
+// isBinary tells whether the body is not text based on its content.
+func isBinary(body []byte) bool {
+	if !validUTF8(body) {
+		return true
+	}
+
+	mediaType := parseMediaType(http.DetectContentType(body))
+	return !strings.HasPrefix(mediaType, "text/") &&
+		!strings.Contains(mediaType, "json") &&
+		!strings.Contains(mediaType, "xml")
+}
+
+// validUTF8 is like utf8.Valid but it accepts a rune cut by a capture limit at the
+// end of the body.
+func validUTF8(body []byte) bool {
+	return utf8.Valid(trimCutRune(body))
+}
+
+// trimCutRune removes the incomplete rune at the end of the body if any.
+func trimCutRune(body []byte) []byte {
+	i := len(body) - 1
+	for i > 0 && len(body)-i < utf8.UTFMax && !utf8.RuneStart(body[i]) {
+		i--
+	}
+	if i >= 0 && !utf8.FullRune(body[i:]) {
+		return body[:i]
+	}
+	return body
+}
+
+// lookupMediaType returns the value for the media type, e.g. "image/png", or for
+// the wildcard of its type, e.g. "image/*".
+func lookupMediaType[V any](m map[string]V, mediaType string) (V, bool) {
+	if value, ok := m[mediaType]; ok {
+		return value, true
+	}
+	if i := strings.Index(mediaType, "/"); i > 0 {
+		if value, ok := m[mediaType[:i]+"/*"]; ok {
+			return value, true
+		}
+	}
+
+	var zero V
+	return zero, false
+}
+
+func parseMediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// best effort for content types with malformed parameters.
+		mediaType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	}
+	return strings.ToLower(mediaType)
+}
@@ -0,0 +1,93 @@
+package bodyattribute
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+var pngBody = []byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR\xff\xfe")
+
+func TestSetBodyAttributeWithPolicyDefaults(t *testing.T) {
+	tCases := map[string]struct {
+		contentType   string
+		body          []byte
+		expectedName  string
+		expectedValue string
+	}{
+		"json is recorded raw": {
+			contentType:   "application/json; charset=utf-8",
+			body:          []byte(`{"name":"Jacinto"}`),
+			expectedName:  "http.request.body",
+			expectedValue: `{"name":"Jacinto"}`,
+		},
+		"binary with allowed content type is base64 encoded": {
+			contentType:   "application/json",
+			body:          pngBody,
+			expectedName:  "http.request.body.base64",
+			expectedValue: base64.RawStdEncoding.EncodeToString(pngBody),
+		},
+		"binary without content type is sniffed": {
+			body:          pngBody,
+			expectedName:  "http.request.body.base64",
+			expectedValue: base64.RawStdEncoding.EncodeToString(pngBody),
+		},
+		"multipart is base64 encoded": {
+			contentType:   "multipart/form-data; boundary=xyz",
+			body:          []byte("--xyz--"),
+			expectedName:  "http.request.body.base64",
+			expectedValue: base64.RawStdEncoding.EncodeToString([]byte("--xyz--")),
+		},
+		"rune cut by the capture limit": {
+			contentType:   "text/plain",
+			body:          []byte("señor")[:3],
+			expectedName:  "http.request.body",
+			expectedValue: "se",
+		},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			s := mock.NewSpan()
+			SetBodyAttributeWithPolicy("http.request.body", tCase.contentType, tCase.body, 100, nil, s)
+			assert.Equal(t, tCase.expectedValue, s.ReadAttribute(tCase.expectedName))
+			assert.Zero(t, s.RemainingAttributes(), "unexpected remaining attribute: %v", s.Attributes)
+		})
+	}
+}
+
+func TestSetBodyAttributeWithPolicy(t *testing.T) {
+	policy := Policy{
+		"image/*":                  EncodingSize,
+		"application/octet-stream": EncodingHash,
+		"application/pdf":          EncodingRaw,
+		"application/json":         EncodingBase64,
+	}
+
+	s := mock.NewSpan()
+	SetBodyAttributeWithPolicy("http.request.body", "image/png", pngBody, 10, policy, s)
+	assert.Equal(t, int64(len(pngBody)), s.ReadAttribute("http.request.body.captured_size"))
+	assert.Zero(t, s.RemainingAttributes(), "unexpected remaining attribute: %v", s.Attributes)
+
+	s = mock.NewSpan()
+	SetBodyAttributeWithPolicy("http.request.body", "application/octet-stream", pngBody, 10, policy, s)
+	sum := sha256.Sum256(pngBody)
+	assert.Equal(t, hex.EncodeToString(sum[:]), s.ReadAttribute("http.request.body.sha256"))
+	assert.Zero(t, s.RemainingAttributes(), "unexpected remaining attribute: %v", s.Attributes)
+
+	s = mock.NewSpan()
+	SetBodyAttributeWithPolicy("http.request.body", "application/json", []byte(`{"id":1}`), 100, policy, s)
+	assert.Equal(t, base64.RawStdEncoding.EncodeToString([]byte(`{"id":1}`)), s.ReadAttribute("http.request.body.base64"))
+	assert.Zero(t, s.RemainingAttributes(), "unexpected remaining attribute: %v", s.Attributes)
+
+	// raw never records invalid UTF-8
+	s = mock.NewSpan()
+	SetBodyAttributeWithPolicy("http.request.body", "application/pdf", pngBody, 10, policy, s)
+	assert.Equal(t, base64.RawStdEncoding.EncodeToString(pngBody[:10]), s.ReadAttribute("http.request.body.base64"))
+	assert.True(t, s.ReadAttribute("http.request.body.truncated").(bool))
+	assert.Zero(t, s.RemainingAttributes(), "unexpected remaining attribute: %v", s.Attributes)
+}
@@ -0,0 +1,46 @@
+package connect // import "github.com/hypertrace/goagent/sdk/instrumentation/connectrpc.com/connect"
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// marshaler matches the one used by the gRPC instrumentation so bodies look the same
+// regardless of the protocol.
+var marshaler = protojson.MarshalOptions{EmitUnpopulated: false}
+
+// marshalMessageableJSON marshals a value that can be cast as proto.Message into JSON.
+func marshalMessageableJSON(messageable interface{}) ([]byte, error) {
+	if msg, ok := messageable.(proto.Message); ok {
+		return marshaler.Marshal(msg)
+	}
+
+	return nil, nil
+}
+
+// setAttributesFromHeader sets the headers as metadata attributes, keys are lowercased
+// as in gRPC metadata.
+func setAttributesFromHeader(_type string, h http.Header, span sdk.Span) {
+	for key, values := range h {
+		key = strings.ToLower(key)
+		if len(values) == 1 {
+			span.SetAttribute(fmt.Sprintf("rpc.%s.metadata.%s", _type, key), values[0])
+			continue
+		}
+
+		for index, value := range values {
+			span.SetAttribute(fmt.Sprintf("rpc.%s.metadata.%s[%d]", _type, key, index), value)
+		}
+	}
+}
+
+// setTruncatedBodyAttribute truncates the body and sets it as a span attribute.
+func setTruncatedBodyAttribute(_type string, body []byte, bodyMaxSize int, span sdk.Span) {
+	bodyattribute.SetTruncatedBodyAttribute(fmt.Sprintf("rpc.%s.body", _type), body, bodyMaxSize, span)
+}
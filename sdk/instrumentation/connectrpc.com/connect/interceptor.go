@@ -0,0 +1,308 @@
+package connect // import "github.com/hypertrace/goagent/sdk/instrumentation/connectrpc.com/connect"
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
+	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/hypertrace/goagent/sdk/internal/container"
+)
+
+// Options for Connect instrumentation
+type Options struct {
+	Filter filter.Filter
+}
+
+type interceptor struct {
+	startSpan         sdk.StartSpan
+	spanFromContext   sdk.SpanFromContext
+	filter            filter.Filter
+	defaultAttributes map[string]string
+}
+
+var _ connect.Interceptor = (*interceptor)(nil)
+
+// NewInterceptor returns an interceptor that records the request and response message's body
+// and metadata the same way the gRPC instrumentation does. On the handler side the attributes
+// are added to the span of the HTTP request, hence the handler is expected to be wrapped by an
+// instrumented HTTP handler. On the client side a span is started for each call using startSpan.
+func NewInterceptor(
+	startSpan sdk.StartSpan,
+	spanFromContext sdk.SpanFromContext,
+	options *Options,
+	spanAttributes map[string]string,
+) connect.Interceptor {
+	defaultAttributes := map[string]string{
+		"rpc.system": "connect_rpc",
+	}
+	for k, v := range spanAttributes {
+		defaultAttributes[k] = v
+	}
+	if containerID, err := container.GetID(); err == nil {
+		defaultAttributes["container_id"] = containerID
+	}
+
+	var f filter.Filter = &filter.NoopFilter{}
+	if options != nil && options.Filter != nil {
+		f = options.Filter
+	}
+
+	return &interceptor{
+		startSpan:         startSpan,
+		spanFromContext:   spanFromContext,
+		filter:            f,
+		defaultAttributes: defaultAttributes,
+	}
+}
+
+// dataCaptureConfig returns the data capture config, it is read every time as it can be
+// updated at runtime.
+func (i *interceptor) dataCaptureConfig() *config.DataCapture {
+	return internalconfig.GetConfig().GetDataCapture()
+}
+
+func (i *interceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return i.unaryClient(ctx, req, next)
+		}
+		return i.unaryHandler(ctx, req, next)
+	}
+}
+
+func (i *interceptor) unaryHandler(ctx context.Context, req connect.AnyRequest, next connect.UnaryFunc) (connect.AnyResponse, error) {
+	span := i.spanFromContext(ctx)
+	if span.IsNoop() {
+		// isNoop means either the span is not sampled or there was no span
+		// in the request context which means this interceptor is not used
+		// inside an instrumented handler, hence we just invoke the next one.
+		return next(ctx, req)
+	}
+
+	i.setRequestAttributes(span, req.Spec().Procedure, req.Header())
+	i.setBodyAttribute("request", req.Any(), span)
+
+	// single evaluation call to filter after capturing the configured parameters
+	if err := i.evaluateFilter(span, req.Header()); err != nil {
+		return nil, err
+	}
+
+	res, err := next(ctx, req)
+	i.setResponseAttributes(span, res, err)
+	return res, err
+}
+
+func (i *interceptor) unaryClient(ctx context.Context, req connect.AnyRequest, next connect.UnaryFunc) (connect.AnyResponse, error) {
+	ctx, span, end := i.startSpan(ctx, spanName(req.Spec().Procedure), &sdk.SpanOptions{Kind: sdk.SpanKindClient})
+	defer end()
+
+	if span.IsNoop() {
+		return next(ctx, req)
+	}
+
+	i.setRequestAttributes(span, req.Spec().Procedure, req.Header())
+	i.setBodyAttribute("request", req.Any(), span)
+
+	res, err := next(ctx, req)
+	i.setResponseAttributes(span, res, err)
+	return res, err
+}
+
+func (i *interceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		ctx, span, end := i.startSpan(ctx, spanName(spec.Procedure), &sdk.SpanOptions{Kind: sdk.SpanKindClient})
+		conn := next(ctx, spec)
+		if span.IsNoop() {
+			end()
+			return conn
+		}
+
+		return &streamingClientConn{StreamingClientConn: conn, interceptor: i, span: span, end: end}
+	}
+}
+
+func (i *interceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		span := i.spanFromContext(ctx)
+		if span.IsNoop() {
+			return next(ctx, conn)
+		}
+
+		i.setRequestAttributes(span, conn.Spec().Procedure, conn.RequestHeader())
+
+		if err := i.evaluateFilter(span, conn.RequestHeader()); err != nil {
+			return err
+		}
+
+		err := next(ctx, &streamingHandlerConn{StreamingHandlerConn: conn, interceptor: i, span: span})
+		if i.dataCaptureConfig().RpcMetadata.Response.Value {
+			setAttributesFromHeader("response", conn.ResponseHeader(), span)
+			setAttributesFromHeader("response", conn.ResponseTrailer(), span)
+		}
+		setErrorAttributes(span, err)
+		return err
+	}
+}
+
+func (i *interceptor) setRequestAttributes(span sdk.Span, procedure string, header http.Header) {
+	for key, value := range i.defaultAttributes {
+		span.SetAttribute(key, value)
+	}
+
+	if service, method, ok := strings.Cut(strings.TrimPrefix(procedure, "/"), "/"); ok {
+		span.SetAttribute("rpc.service", service)
+		span.SetAttribute("rpc.method", method)
+	}
+
+	if i.dataCaptureConfig().RpcMetadata.Request.Value {
+		setAttributesFromHeader("request", header, span)
+	}
+}
+
+func (i *interceptor) setResponseAttributes(span sdk.Span, res connect.AnyResponse, err error) {
+	if err != nil {
+		setErrorAttributes(span, err)
+
+		var connectErr *connect.Error
+		if errors.As(err, &connectErr) && i.dataCaptureConfig().RpcMetadata.Response.Value {
+			setAttributesFromHeader("response", connectErr.Meta(), span)
+		}
+		return
+	}
+
+	if res == nil {
+		return
+	}
+
+	if i.dataCaptureConfig().RpcMetadata.Response.Value {
+		setAttributesFromHeader("response", res.Header(), span)
+		setAttributesFromHeader("response", res.Trailer(), span)
+	}
+	i.setBodyAttribute("response", res.Any(), span)
+}
+
+func (i *interceptor) setBodyAttribute(_type string, msg interface{}, span sdk.Span) {
+	if _type == "request" && !i.dataCaptureConfig().RpcBody.Request.Value ||
+		_type == "response" && !i.dataCaptureConfig().RpcBody.Response.Value {
+		return
+	}
+
+	body, err := marshalMessageableJSON(msg)
+	if len(body) > 0 && err == nil {
+		setTruncatedBodyAttribute(_type, body, int(i.dataCaptureConfig().BodyMaxSizeBytes.Value), span)
+	}
+}
+
+// evaluateFilter returns the error the handler has to return when the request is blocked,
+// otherwise the decorations are applied to the request headers.
+func (i *interceptor) evaluateFilter(span sdk.Span, header http.Header) error {
+	filterResult := i.filter.Evaluate(span)
+	if filterResult.Block {
+		statusCode := int(filterResult.ResponseStatusCode)
+		return connect.NewError(connect.Code(sdkgrpc.StatusCode(statusCode)), errors.New(sdkgrpc.StatusText(statusCode)))
+	} else if filterResult.Decorations != nil {
+		for _, h := range filterResult.Decorations.RequestHeaderInjections {
+			header.Add(h.Key, h.Value)
+			span.SetAttribute("rpc.request.metadata."+strings.ToLower(h.Key), h.Value)
+		}
+	}
+	return nil
+}
+
+func setErrorAttributes(span sdk.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	code := connect.CodeOf(err)
+	span.SetAttribute("rpc.connect_rpc.error_code", code.String())
+
+	message := err.Error()
+	var connectErr *connect.Error
+	if errors.As(err, &connectErr) {
+		message = connectErr.Message()
+	}
+	span.SetStatus(sdk.StatusCodeError, message)
+}
+
+// spanName returns the name of the client span as per the RPC semantic conventions,
+// e.g. "acme.foo.v1.FooService/Bar".
+func spanName(procedure string) string {
+	return strings.TrimPrefix(procedure, "/")
+}
+
+type streamingHandlerConn struct {
+	connect.StreamingHandlerConn
+	interceptor *interceptor
+	span        sdk.Span
+}
+
+// Receive records the last received message as the request body.
+func (c *streamingHandlerConn) Receive(msg interface{}) error {
+	err := c.StreamingHandlerConn.Receive(msg)
+	if err == nil {
+		c.interceptor.setBodyAttribute("request", msg, c.span)
+	}
+	return err
+}
+
+// Send records the last sent message as the response body.
+func (c *streamingHandlerConn) Send(msg interface{}) error {
+	c.interceptor.setBodyAttribute("response", msg, c.span)
+	return c.StreamingHandlerConn.Send(msg)
+}
+
+type streamingClientConn struct {
+	connect.StreamingClientConn
+	interceptor *interceptor
+	span        sdk.Span
+	end         func()
+	sent        bool
+	err         error
+}
+
+// Send records the request attributes along with the first message as the headers
+// can't be modified after that, every message sent overrides the request body.
+func (c *streamingClientConn) Send(msg interface{}) error {
+	if !c.sent {
+		c.sent = true
+		c.interceptor.setRequestAttributes(c.span, c.Spec().Procedure, c.RequestHeader())
+	}
+	c.interceptor.setBodyAttribute("request", msg, c.span)
+	return c.StreamingClientConn.Send(msg)
+}
+
+func (c *streamingClientConn) Receive(msg interface{}) error {
+	err := c.StreamingClientConn.Receive(msg)
+	if err == nil {
+		c.interceptor.setBodyAttribute("response", msg, c.span)
+	} else if !errors.Is(err, io.EOF) {
+		c.err = err
+	}
+	return err
+}
+
+// CloseResponse ends the span as the stream is done.
+func (c *streamingClientConn) CloseResponse() error {
+	err := c.StreamingClientConn.CloseResponse()
+
+	if !c.sent {
+		c.interceptor.setRequestAttributes(c.span, c.Spec().Procedure, c.RequestHeader())
+	}
+	if c.interceptor.dataCaptureConfig().RpcMetadata.Response.Value {
+		setAttributesFromHeader("response", c.ResponseHeader(), c.span)
+		setAttributesFromHeader("response", c.ResponseTrailer(), c.span)
+	}
+	setErrorAttributes(c.span, c.err)
+	c.end()
+
+	return err
+}
@@ -0,0 +1,226 @@
+package connect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const sayHelloProcedure = "/helloworld.Greeter/SayHello"
+
+type spanRecorder struct {
+	spans []*mock.Span
+}
+
+func (r *spanRecorder) startSpan(ctx context.Context, name string, opts *sdk.SpanOptions) (context.Context, sdk.Span, func()) {
+	span := mock.NewSpan()
+	span.Name = name
+	span.Options = *opts
+	r.spans = append(r.spans, span)
+	return mock.ContextWithSpan(ctx, span), span, func() {}
+}
+
+// spanHandler simulates an instrumented HTTP handler.
+func spanHandler(h http.Handler, spans *[]*mock.Span) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := mock.NewSpan()
+		*spans = append(*spans, span)
+		h.ServeHTTP(w, r.WithContext(mock.ContextWithSpan(r.Context(), span)))
+	})
+}
+
+func sayHello(_ context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[wrapperspb.StringValue], error) {
+	if req.Msg.Value == "" {
+		err := connect.NewError(connect.CodeInvalidArgument, errors.New("name is required"))
+		err.Meta().Set("x-reason", "empty-name")
+		return nil, err
+	}
+
+	res := connect.NewResponse(wrapperspb.String("Hello " + req.Msg.Value))
+	res.Header().Set("x-greeting", "formal")
+	return res, nil
+}
+
+func newServer(t *testing.T, options *Options, spans *[]*mock.Span) *httptest.Server {
+	h := connect.NewUnaryHandler(sayHelloProcedure, sayHello,
+		connect.WithInterceptors(NewInterceptor(nil, mock.SpanFromContext, options, map[string]string{"foo": "bar"})))
+	mux := http.NewServeMux()
+	mux.Handle(sayHelloProcedure, spanHandler(h, spans))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHandlerInterceptorSuccess(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	srv := newServer(t, &Options{}, &spans)
+
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](srv.Client(), srv.URL+sayHelloProcedure)
+	req := connect.NewRequest(wrapperspb.String("Pupo"))
+	req.Header().Set("test_key", "test_value")
+	_, err := client.CallUnary(context.Background(), req)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, len(spans))
+	span := spans[0]
+	assert.Equal(t, "connect_rpc", span.ReadAttribute("rpc.system"))
+	assert.Equal(t, "bar", span.ReadAttribute("foo"))
+	assert.Equal(t, "helloworld.Greeter", span.ReadAttribute("rpc.service"))
+	assert.Equal(t, "SayHello", span.ReadAttribute("rpc.method"))
+	assert.Equal(t, "test_value", span.ReadAttribute("rpc.request.metadata.test_key"))
+	assert.Equal(t, `"Pupo"`, span.ReadAttribute("rpc.request.body"))
+	assert.Equal(t, `"Hello Pupo"`, span.ReadAttribute("rpc.response.body"))
+	assert.Equal(t, "formal", span.ReadAttribute("rpc.response.metadata.x-greeting"))
+	assert.Nil(t, span.ReadAttribute("rpc.connect_rpc.error_code"))
+}
+
+func TestHandlerInterceptorError(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	srv := newServer(t, &Options{}, &spans)
+
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](srv.Client(), srv.URL+sayHelloProcedure)
+	_, err := client.CallUnary(context.Background(), connect.NewRequest(wrapperspb.String("")))
+	assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+
+	span := spans[0]
+	assert.Equal(t, "invalid_argument", span.ReadAttribute("rpc.connect_rpc.error_code"))
+	assert.Equal(t, "empty-name", span.ReadAttribute("rpc.response.metadata.x-reason"))
+	assert.Equal(t, sdk.StatusCodeError, span.Status.Code)
+	assert.Equal(t, "name is required", span.Status.Message)
+	assert.Nil(t, span.ReadAttribute("rpc.response.body"))
+}
+
+func TestHandlerInterceptorFilter(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	srv := newServer(t, &Options{Filter: mock.Filter{
+		Evaluator: func(span sdk.Span) result.FilterResult {
+			assert.Equal(t, `"Pupo"`, span.GetAttributes().GetValue("rpc.request.body"))
+			return result.FilterResult{Block: true, ResponseStatusCode: 403}
+		},
+	}}, &spans)
+
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](srv.Client(), srv.URL+sayHelloProcedure)
+	_, err := client.CallUnary(context.Background(), connect.NewRequest(wrapperspb.String("Pupo")))
+	assert.Equal(t, connect.CodePermissionDenied, connect.CodeOf(err))
+
+	assert.Nil(t, spans[0].ReadAttribute("rpc.response.body"))
+}
+
+func TestHandlerInterceptorFilterDecorations(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	var injected string
+	h := connect.NewUnaryHandler(sayHelloProcedure,
+		func(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[wrapperspb.StringValue], error) {
+			injected = req.Header().Get("x-injected")
+			return sayHello(ctx, req)
+		},
+		connect.WithInterceptors(NewInterceptor(nil, mock.SpanFromContext, &Options{Filter: mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				return result.FilterResult{Decorations: &result.Decorations{
+					RequestHeaderInjections: []result.KeyValueString{{Key: "x-injected", Value: "yes"}},
+				}}
+			},
+		}}, nil)))
+	srv := httptest.NewServer(spanHandler(h, &spans))
+	defer srv.Close()
+
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](srv.Client(), srv.URL+sayHelloProcedure)
+	_, err := client.CallUnary(context.Background(), connect.NewRequest(wrapperspb.String("Pupo")))
+	require.NoError(t, err)
+
+	assert.Equal(t, "yes", injected)
+	assert.Equal(t, "yes", spans[0].ReadAttribute("rpc.request.metadata.x-injected"))
+}
+
+func TestClientInterceptor(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	srv := newServer(t, &Options{}, &spans)
+
+	recorder := &spanRecorder{}
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](srv.Client(), srv.URL+sayHelloProcedure,
+		connect.WithInterceptors(NewInterceptor(recorder.startSpan, mock.SpanFromContext, nil, nil)))
+
+	_, err := client.CallUnary(context.Background(), connect.NewRequest(wrapperspb.String("Pupo")))
+	require.NoError(t, err)
+
+	_, err = client.CallUnary(context.Background(), connect.NewRequest(wrapperspb.String("")))
+	assert.Error(t, err)
+
+	assert.Equal(t, 2, len(recorder.spans))
+	span := recorder.spans[0]
+	assert.Equal(t, "helloworld.Greeter/SayHello", span.Name)
+	assert.Equal(t, sdk.SpanKindClient, span.Options.Kind)
+	assert.Equal(t, "connect_rpc", span.ReadAttribute("rpc.system"))
+	assert.Equal(t, "helloworld.Greeter", span.ReadAttribute("rpc.service"))
+	assert.Equal(t, "SayHello", span.ReadAttribute("rpc.method"))
+	assert.Equal(t, `"Pupo"`, span.ReadAttribute("rpc.request.body"))
+	assert.Equal(t, `"Hello Pupo"`, span.ReadAttribute("rpc.response.body"))
+	assert.Equal(t, "formal", span.ReadAttribute("rpc.response.metadata.x-greeting"))
+
+	errSpan := recorder.spans[1]
+	assert.Equal(t, "invalid_argument", errSpan.ReadAttribute("rpc.connect_rpc.error_code"))
+	assert.Equal(t, sdk.StatusCodeError, errSpan.Status.Code)
+}
+
+func TestServerStreaming(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	const procedure = "/helloworld.Greeter/SayHellos"
+	spans := []*mock.Span{}
+	h := connect.NewServerStreamHandler(procedure,
+		func(_ context.Context, req *connect.Request[wrapperspb.StringValue], stream *connect.ServerStream[wrapperspb.StringValue]) error {
+			for _, greeting := range []string{"Hello ", "Bye "} {
+				if err := stream.Send(wrapperspb.String(greeting + req.Msg.Value)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		connect.WithInterceptors(NewInterceptor(nil, mock.SpanFromContext, nil, nil)))
+	srv := httptest.NewServer(spanHandler(h, &spans))
+	defer srv.Close()
+
+	recorder := &spanRecorder{}
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](srv.Client(), srv.URL+procedure,
+		connect.WithInterceptors(NewInterceptor(recorder.startSpan, mock.SpanFromContext, nil, nil)))
+
+	stream, err := client.CallServerStream(context.Background(), connect.NewRequest(wrapperspb.String("Pupo")))
+	require.NoError(t, err)
+	for stream.Receive() {
+	}
+	require.NoError(t, stream.Err())
+	require.NoError(t, stream.Close())
+
+	serverSpan := spans[0]
+	assert.Equal(t, "SayHellos", serverSpan.ReadAttribute("rpc.method"))
+	assert.Equal(t, `"Pupo"`, serverSpan.ReadAttribute("rpc.request.body"))
+	// the last message overrides the previous ones
+	assert.Equal(t, `"Bye Pupo"`, serverSpan.ReadAttribute("rpc.response.body"))
+
+	clientSpan := recorder.spans[0]
+	assert.Equal(t, "helloworld.Greeter/SayHellos", clientSpan.Name)
+	assert.Equal(t, `"Pupo"`, clientSpan.ReadAttribute("rpc.request.body"))
+	assert.Equal(t, `"Bye Pupo"`, clientSpan.ReadAttribute("rpc.response.body"))
+	assert.Nil(t, clientSpan.ReadAttribute("rpc.connect_rpc.error_code"))
+}
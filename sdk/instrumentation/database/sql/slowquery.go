@@ -0,0 +1,284 @@
+package sql // import "github.com/hypertrace/goagent/sdk/instrumentation/database/sql"
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hypertrace/goagent/sdk"
+)
+
+const (
+	slowQueryEventName = "db.slow_query"
+
+	defaultExplainInterval = time.Second
+	defaultExplainTimeout  = 5 * time.Second
+
+	// explainMaxPlanSize caps the size of the plan attached to the span event
+	// as some plans (e.g. for big joins) can be considerably large.
+	explainMaxPlanSize = 8 * 1024
+)
+
+// explainer runs EXPLAIN for slow queries on a connection separate from the
+// application ones. EXPLAIN runs asynchronously and at most once per interval
+// so it can't pile up load on an already slow database.
+type explainer struct {
+	driver   driver.Driver
+	system   string
+	interval time.Duration
+	timeout  time.Duration
+
+	mu  sync.Mutex
+	dsn string
+	db  *explainDB
+
+	// lastRun holds the unix nano timestamp of the last EXPLAIN run.
+	lastRun  atomic.Int64
+	inFlight atomic.Bool
+}
+
+// explainDB is the dedicated database handle. It is reference counted so a
+// handle replaced by setDSN is only closed once the running EXPLAIN is done.
+type explainDB struct {
+	*stdSQL.DB
+	refs    int
+	retired bool
+}
+
+func newExplainer(d driver.Driver, options *Options) *explainer {
+	e := &explainer{
+		driver:   d,
+		interval: defaultExplainInterval,
+		timeout:  defaultExplainTimeout,
+	}
+	if options.ExplainInterval > 0 {
+		e.interval = options.ExplainInterval
+	}
+	if options.ExplainTimeout > 0 {
+		e.timeout = options.ExplainTimeout
+	}
+	return e
+}
+
+// setDSN records the DSN and database system used by the application so
+// EXPLAIN connects to the same database.
+func (e *explainer) setDSN(dsn string, system string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.dsn == dsn && e.system == system {
+		return
+	}
+
+	if e.db != nil {
+		e.db.retired = true
+		if e.db.refs == 0 {
+			_ = e.db.Close()
+		}
+		e.db = nil
+	}
+	e.dsn = dsn
+	e.system = system
+}
+
+// conn returns the dedicated database handle, creating it on first use. The
+// handle has to be released once it is not used anymore.
+func (e *explainer) conn() (*explainDB, string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !isExplainable(e.system) {
+		return nil, "", false
+	}
+
+	if e.db == nil {
+		db := stdSQL.OpenDB(&dsnConnector{dsn: e.dsn, driver: e.driver})
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		e.db = &explainDB{DB: db}
+	}
+
+	e.db.refs++
+	return e.db, e.system, true
+}
+
+// release gives back a handle obtained from conn, closing it if it was replaced
+// in the meantime.
+func (e *explainer) release(db *explainDB) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	db.refs--
+	if db.retired && db.refs == 0 {
+		_ = db.Close()
+	}
+}
+
+// acquire enforces the rate limit, returning false if the EXPLAIN has to be skipped.
+func (e *explainer) acquire(now time.Time) bool {
+	last := e.lastRun.Load()
+	if now.UnixNano()-last < int64(e.interval) {
+		return false
+	}
+
+	if !e.inFlight.CompareAndSwap(false, true) {
+		return false
+	}
+
+	if !e.lastRun.CompareAndSwap(last, now.UnixNano()) {
+		e.inFlight.Store(false)
+		return false
+	}
+
+	return true
+}
+
+// explain asynchronously runs EXPLAIN for the query. As the query span has
+// ended by the time the plan is available, the plan is attached to a
+// slow query event in a child span.
+func (e *explainer) explain(ctx context.Context, startSpan sdk.StartSpan, query string, args []driver.NamedValue) {
+	if !isExplainableStatement(query) {
+		return
+	}
+
+	db, system, ok := e.conn()
+	if !ok {
+		return
+	}
+
+	if !e.acquire(time.Now()) {
+		e.release(db)
+		return
+	}
+
+	// the explain outlives the query hence it should not be cancelled with it
+	// nor use the args the driver may reuse once the query returns.
+	ctx = context.WithoutCancel(ctx)
+	args = copyArgs(args)
+	go func() {
+		defer e.inFlight.Store(false)
+		defer e.release(db)
+
+		ctx, cancel := context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+
+		_, span, end := startSpan(ctx, "db:explain", &sdk.SpanOptions{Kind: sdk.SpanKindClient})
+		defer end()
+
+		span.SetAttribute("db.system", system)
+		span.SetAttribute("db.statement", query)
+
+		plan, err := runExplain(ctx, db.DB, system, query, args)
+		setError(span, err)
+		if err != nil {
+			return
+		}
+
+		span.AddEvent(slowQueryEventName, time.Now(), map[string]interface{}{
+			"db.statement":    query,
+			"db.explain.plan": truncatePlan(plan),
+		})
+	}()
+}
+
+// copyArgs deep copies the args, byte slices included, as they are only valid
+// for the duration of the query.
+func copyArgs(args []driver.NamedValue) []driver.NamedValue {
+	copied := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		if b, ok := arg.Value.([]byte); ok {
+			arg.Value = append([]byte(nil), b...)
+		}
+		copied[i] = arg
+	}
+	return copied
+}
+
+func runExplain(ctx context.Context, db *stdSQL.DB, system string, query string, args []driver.NamedValue) (string, error) {
+	var explainQuery string
+	switch system {
+	case "postgresql":
+		explainQuery = "EXPLAIN (FORMAT JSON) " + query
+	case "mysql":
+		explainQuery = "EXPLAIN FORMAT=JSON " + query
+	}
+
+	values := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		if arg.Name != "" {
+			values = append(values, stdSQL.Named(arg.Name, arg.Value))
+		} else {
+			values = append(values, arg.Value)
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, explainQuery, values...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n"), rows.Err()
+}
+
+func isExplainable(system string) bool {
+	return system == "postgresql" || system == "mysql"
+}
+
+// isExplainableStatement returns true for statements EXPLAIN can run without
+// executing them, notice EXPLAIN ANALYZE is never used.
+func isExplainableStatement(query string) bool {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH", "REPLACE":
+		return true
+	default:
+		return false
+	}
+}
+
+func truncatePlan(plan string) string {
+	if len(plan) <= explainMaxPlanSize {
+		return plan
+	}
+
+	// avoids splitting a multibyte rune in the middle
+	end := explainMaxPlanSize
+	for end > 0 && !utf8.RuneStart(plan[end]) {
+		end--
+	}
+	return plan[:end]
+}
+
+// dsnConnector opens connections using the unwrapped driver so EXPLAIN
+// queries are not instrumented themselves.
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c *dsnConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
@@ -6,6 +6,7 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/hypertrace/goagent/sdk"
 	"github.com/ngrok/sqlmw"
@@ -15,10 +16,27 @@ import (
 
 var regMu sync.Mutex
 
+// Options for SQL driver instrumentation
+type Options struct {
+	// SlowQueryThreshold is the latency above which a query or exec is flagged
+	// as slow with the `db.slow` attribute and a span event. Zero disables it.
+	SlowQueryThreshold time.Duration
+	// ExplainSlowQueries runs EXPLAIN for slow queries on PostgreSQL and MySQL
+	// using a separate connection. EXPLAIN runs asynchronously and the plan is
+	// attached to a slow query event in a `db:explain` child span.
+	ExplainSlowQueries bool
+	// ExplainInterval is the minimum time between two EXPLAIN runs, defaults to 1s.
+	ExplainInterval time.Duration
+	// ExplainTimeout bounds the time an EXPLAIN can take, defaults to 5s.
+	ExplainTimeout time.Duration
+}
+
 type interceptor struct {
 	sqlmw.NullInterceptor
-	startSpan         sdk.StartSpan
-	defaultAttributes map[string]string
+	startSpan          sdk.StartSpan
+	defaultAttributes  map[string]string
+	slowQueryThreshold time.Duration
+	explainer          *explainer
 }
 
 func setError(s sdk.Span, err error) {
@@ -30,6 +48,29 @@ func setError(s sdk.Span, err error) {
 	}
 }
 
+// recordLatency flags the span as slow when the statement took longer than
+// the configured threshold and optionally triggers an EXPLAIN for it.
+func (in *interceptor) recordLatency(ctx context.Context, span sdk.Span, query string, args []driver.NamedValue, startTime time.Time) {
+	if in.slowQueryThreshold <= 0 {
+		return
+	}
+
+	latency := time.Since(startTime)
+	if latency < in.slowQueryThreshold {
+		return
+	}
+
+	span.SetAttribute("db.slow", true)
+	span.AddEvent(slowQueryEventName, time.Now(), map[string]interface{}{
+		"db.slow.latency_ms":   latency.Milliseconds(),
+		"db.slow.threshold_ms": in.slowQueryThreshold.Milliseconds(),
+	})
+
+	if in.explainer != nil {
+		in.explainer.explain(ctx, in.startSpan, query, args)
+	}
+}
+
 func (in *interceptor) StmtQueryContext(ctx context.Context, conn driver.StmtQueryContext, query string, args []driver.NamedValue) (driver.Rows, error) {
 	ctx, span, end := in.startSpan(ctx, "db:query", &sdk.SpanOptions{Kind: sdk.SpanKindClient})
 	defer end()
@@ -39,8 +80,10 @@ func (in *interceptor) StmtQueryContext(ctx context.Context, conn driver.StmtQue
 	}
 	span.SetAttribute("db.statement", query)
 
+	startTime := time.Now()
 	rows, err := conn.QueryContext(ctx, args)
 	setError(span, err)
+	in.recordLatency(ctx, span, query, args, startTime)
 
 	return rows, err
 }
@@ -54,8 +97,10 @@ func (in *interceptor) StmtExecContext(ctx context.Context, conn driver.StmtExec
 	}
 	span.SetAttribute("db.statement", query)
 
+	startTime := time.Now()
 	rows, err := conn.ExecContext(ctx, args)
 	setError(span, err)
+	in.recordLatency(ctx, span, query, args, startTime)
 
 	return rows, err
 }
@@ -69,8 +114,10 @@ func (in *interceptor) ConnQueryContext(ctx context.Context, conn driver.Queryer
 	}
 	span.SetAttribute("db.statement", query)
 
+	startTime := time.Now()
 	rows, err := conn.QueryContext(ctx, query, args)
 	setError(span, err)
+	in.recordLatency(ctx, span, query, args, startTime)
 
 	return rows, err
 }
@@ -84,8 +131,10 @@ func (in *interceptor) ConnExecContext(ctx context.Context, conn driver.ExecerCo
 	}
 	span.SetAttribute("db.statement", query)
 
+	startTime := time.Now()
 	rows, err := conn.ExecContext(ctx, query, args)
 	setError(span, err)
+	in.recordLatency(ctx, span, query, args, startTime)
 
 	return rows, err
 }
@@ -165,10 +214,14 @@ type dsnReadWrapper struct {
 	driver.Driver
 	driverName          string
 	inDefaultAttributes *map[string]string
+	explainer           *explainer
 }
 
 func (w *dsnReadWrapper) Open(dsn string) (driver.Conn, error) {
 	*w.inDefaultAttributes = w.parseDSNAttributes(dsn)
+	if w.explainer != nil {
+		w.explainer.setDSN(dsn, (*w.inDefaultAttributes)["db.system"])
+	}
 	return w.Driver.Open(dsn)
 }
 
@@ -183,21 +236,47 @@ func (w *dsnReadWrapper) parseDSNAttributes(dsn string) map[string]string {
 			attrs = parsedAttrs
 		}
 		attrs["db.system"] = "mysql"
+	case "github.com/lib/pq.Driver",
+		"github.com/jackc/pgx/v4/stdlib.Driver",
+		"github.com/jackc/pgx/v5/stdlib.Driver":
+		attrs["db.system"] = "postgresql"
 	}
 	return attrs
 }
 
 // Wrap takes a SQL driver and wraps it with Hypertrace instrumentation.
 func Wrap(d driver.Driver, startSpan sdk.StartSpan) driver.Driver {
+	return WrapWithOptions(d, startSpan, nil)
+}
+
+// WrapWithOptions is like Wrap but it also accepts instrumentation options.
+func WrapWithOptions(d driver.Driver, startSpan sdk.StartSpan, options *Options) driver.Driver {
+	if options == nil {
+		options = &Options{}
+	}
+
 	driverName := getDriverName(d)
-	in := &interceptor{startSpan: startSpan}
-	return &dsnReadWrapper{Driver: sqlmw.Driver(d, in), driverName: driverName, inDefaultAttributes: &in.defaultAttributes}
+	in := &interceptor{startSpan: startSpan, slowQueryThreshold: options.SlowQueryThreshold}
+	if options.SlowQueryThreshold > 0 && options.ExplainSlowQueries {
+		in.explainer = newExplainer(d, options)
+	}
+	return &dsnReadWrapper{
+		Driver:              sqlmw.Driver(d, in),
+		driverName:          driverName,
+		inDefaultAttributes: &in.defaultAttributes,
+		explainer:           in.explainer,
+	}
 }
 
 // Register initializes and registers the hypersql wrapped database driver
 // identified by its driverName. On success it
 // returns the generated driverName to use when calling hypersql.Open.
 func Register(driverName string, startSpan sdk.StartSpan) (string, error) {
+	return RegisterWithOptions(driverName, startSpan, nil)
+}
+
+// RegisterWithOptions is like Register but it also accepts instrumentation options.
+func RegisterWithOptions(driverName string, startSpan sdk.StartSpan, options *Options) (string, error) {
 	// retrieve the driver implementation we need to wrap with instrumentation
 	db, err := stdSQL.Open(driverName, "")
 	if err != nil {
@@ -212,6 +291,6 @@ func Register(driverName string, startSpan sdk.StartSpan) (string, error) {
 	defer regMu.Unlock()
 
 	hyperDriverName := fmt.Sprintf("hyper-%s-%d", driverName, len(stdSQL.Drivers()))
-	stdSQL.Register(hyperDriverName, Wrap(dri, startSpan))
+	stdSQL.Register(hyperDriverName, WrapWithOptions(dri, startSpan, options))
 	return hyperDriverName, nil
 }
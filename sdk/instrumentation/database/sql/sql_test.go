@@ -5,11 +5,13 @@ package sql
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"testing"
+	"time"
 
 	"github.com/hypertrace/goagent/sdk"
 	"github.com/hypertrace/goagent/sdk/internal/mock"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -27,9 +29,13 @@ func (sb *spansBuffer) StartSpan(ctx context.Context, name string, opts *sdk.Spa
 }
 
 func createDB(t *testing.T) (*sql.DB, func() []*mock.Span) {
+	return createDBWithOptions(t, nil)
+}
+
+func createDBWithOptions(t *testing.T, options *Options) (*sql.DB, func() []*mock.Span) {
 	b := &spansBuffer{}
 
-	driverName, err := Register("sqlite3", b.StartSpan)
+	driverName, err := RegisterWithOptions("sqlite3", b.StartSpan, options)
 	if err != nil {
 		t.Fatalf("unable to register driver")
 	}
@@ -215,3 +221,84 @@ func TestTxWithRollbackSuccess(t *testing.T) {
 
 	db.Close()
 }
+
+func TestSlowQueryIsFlagged(t *testing.T) {
+	db, flusher := createDBWithOptions(t, &Options{SlowQueryThreshold: time.Nanosecond, ExplainSlowQueries: true})
+	defer db.Close()
+
+	_, err := db.Exec("SELECT 1")
+	require.NoError(t, err)
+
+	spans := flusher()
+	require.Equal(t, 1, len(spans))
+
+	span := spans[0]
+	assert.Equal(t, true, span.ReadAttribute("db.slow"))
+
+	events := span.Events()
+	require.Equal(t, 1, len(events))
+	assert.Equal(t, "db.slow_query", events[0].Name)
+	assert.Equal(t, int64(0), events[0].Attributes["db.slow.threshold_ms"])
+	assert.Contains(t, events[0].Attributes, "db.slow.latency_ms")
+}
+
+func TestFastQueryIsNotFlagged(t *testing.T) {
+	db, flusher := createDBWithOptions(t, &Options{SlowQueryThreshold: time.Hour})
+	defer db.Close()
+
+	_, err := db.Exec("SELECT 1")
+	require.NoError(t, err)
+
+	spans := flusher()
+	require.Equal(t, 1, len(spans))
+	assert.Nil(t, spans[0].ReadAttribute("db.slow"))
+	assert.Empty(t, spans[0].Events())
+}
+
+func TestExplainerRateLimit(t *testing.T) {
+	e := newExplainer(nil, &Options{ExplainInterval: time.Minute})
+	now := time.Now()
+
+	assert.True(t, e.acquire(now))
+	// the first explain is still in flight
+	assert.False(t, e.acquire(now.Add(2*time.Minute)))
+
+	e.inFlight.Store(false)
+	assert.False(t, e.acquire(now.Add(time.Second)))
+	assert.True(t, e.acquire(now.Add(2*time.Minute)))
+}
+
+func TestCopyArgsClonesBytes(t *testing.T) {
+	b := []byte("abc")
+	args := []driver.NamedValue{{Ordinal: 1, Value: b}, {Name: "n", Ordinal: 2, Value: int64(1)}}
+
+	copied := copyArgs(args)
+	b[0] = 'x'
+	args[1].Value = int64(2)
+
+	assert.Equal(t, []byte("abc"), copied[0].Value)
+	assert.Equal(t, "n", copied[1].Name)
+	assert.Equal(t, int64(1), copied[1].Value)
+}
+
+func TestSetDSNKeepsTheHandleInUseOpen(t *testing.T) {
+	e := newExplainer(&sqlite3.SQLiteDriver{}, &Options{})
+	e.setDSN(":memory:", "postgresql")
+
+	db, _, ok := e.conn()
+	require.True(t, ok)
+
+	e.setDSN(":memory:", "mysql")
+	// the handle is still in use by the explain hence not closed yet
+	require.NoError(t, db.Ping())
+
+	e.release(db)
+	assert.Error(t, db.Ping())
+}
+
+func TestIsExplainableStatement(t *testing.T) {
+	assert.True(t, isExplainableStatement("  select * from foo"))
+	assert.True(t, isExplainableStatement("UPDATE foo SET a = 1"))
+	assert.False(t, isExplainableStatement("create table foo (id integer)"))
+	assert.False(t, isExplainableStatement(""))
+}
@@ -0,0 +1,173 @@
+package gqlgen // import "github.com/hypertrace/goagent/sdk/instrumentation/github.com/99designs/gqlgen"
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/hypertrace/goagent/sdk"
+	sdkgraphql "github.com/hypertrace/goagent/sdk/instrumentation/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	extensionName = "HypertraceTracer"
+
+	// defaultOperationSpanName is used when the operation can't be found, e.g.
+	// when the document can't be parsed.
+	defaultOperationSpanName = "GraphQL Operation"
+)
+
+// Options for gqlgen instrumentation
+type Options struct {
+	// FieldSpans creates a span per resolver field, trivial fields (those
+	// resolved by reading a struct field) are never recorded.
+	FieldSpans bool
+	// MaxFieldDepth is the deepest field, counting from the root fields as
+	// depth 1, for which a span is created. Zero means no limit.
+	MaxFieldDepth int
+}
+
+type tracer struct {
+	startSpan     sdk.StartSpan
+	fieldSpans    bool
+	maxFieldDepth int
+}
+
+var (
+	_ graphql.HandlerExtension    = &tracer{}
+	_ graphql.ResponseInterceptor = &tracer{}
+	_ graphql.FieldInterceptor    = &tracer{}
+)
+
+// NewTracer returns a gqlgen extension creating a span per operation and,
+// if enabled, per resolver field. It is meant to be added to the server using
+// `srv.Use(tracer)`.
+func NewTracer(startSpan sdk.StartSpan, options *Options) graphql.HandlerExtension {
+	t := &tracer{startSpan: startSpan}
+	if options != nil {
+		t.fieldSpans = options.FieldSpans
+		t.maxFieldDepth = options.MaxFieldDepth
+	}
+	return t
+}
+
+func (t *tracer) ExtensionName() string {
+	return extensionName
+}
+
+func (t *tracer) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptResponse creates a span for the operation. Subscriptions get a span per
+// response.
+func (t *tracer) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	if !graphql.HasOperationContext(ctx) {
+		return next(ctx)
+	}
+
+	op := operationFromContext(graphql.GetOperationContext(ctx))
+	spanName := defaultOperationSpanName
+	if op.Type != "" {
+		spanName = op.SpanName()
+	}
+
+	ctx, span, end := t.startSpan(ctx, spanName, &sdk.SpanOptions{})
+	defer end()
+
+	if op.Type != "" {
+		span.SetAttribute("graphql.operation.type", op.Type)
+	}
+	if op.Name != "" {
+		span.SetAttribute("graphql.operation.name", op.Name)
+	}
+	if op.Document != "" {
+		span.SetAttribute("graphql.document", op.Document)
+	}
+
+	resp := next(ctx)
+	if resp != nil && len(resp.Errors) > 0 {
+		setErrors(span, resp.Errors)
+	}
+
+	return resp
+}
+
+// InterceptField creates a span for the resolver fields up to the max depth.
+func (t *tracer) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	if !t.fieldSpans {
+		return next(ctx)
+	}
+
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	path := fc.Path()
+	if t.maxFieldDepth > 0 && fieldDepth(path) > t.maxFieldDepth {
+		return next(ctx)
+	}
+
+	ctx, span, end := t.startSpan(ctx, fmt.Sprintf("%s.%s", fc.Object, fc.Field.Name), &sdk.SpanOptions{})
+	defer end()
+
+	span.SetAttribute("graphql.field.name", fc.Field.Name)
+	span.SetAttribute("graphql.field.parent_type", fc.Object)
+	span.SetAttribute("graphql.field.path", path.String())
+	if fc.Field.Alias != "" && fc.Field.Alias != fc.Field.Name {
+		span.SetAttribute("graphql.field.alias", fc.Field.Alias)
+	}
+	if fc.Field.Definition != nil && fc.Field.Definition.Type != nil {
+		span.SetAttribute("graphql.field.type", fc.Field.Definition.Type.String())
+	}
+
+	res, err := next(ctx)
+	if err != nil {
+		span.SetError(err)
+		span.SetStatus(sdk.StatusCodeError, err.Error())
+	}
+
+	return res, err
+}
+
+// operationFromContext returns the executed operation, the document is normalized
+// so it does not include any literal value.
+func operationFromContext(opCtx *graphql.OperationContext) sdkgraphql.Operation {
+	op, err := sdkgraphql.ParseOperation(opCtx.RawQuery, opCtx.OperationName)
+	if err == nil {
+		return op
+	}
+
+	// the document could still be parsed by gqlgen, e.g. when it isn't valid against
+	// the schema.
+	if opCtx.Operation != nil {
+		return sdkgraphql.Operation{
+			Type: string(opCtx.Operation.Operation),
+			Name: opCtx.Operation.Name,
+		}
+	}
+
+	return sdkgraphql.Operation{}
+}
+
+// setErrors maps the GraphQL errors to the span error, GraphQL errors do not change
+// the HTTP status code hence they are only visible here.
+func setErrors(span sdk.Span, errs gqlerror.List) {
+	span.SetAttribute("graphql.errors.count", len(errs))
+	span.SetError(errs)
+	span.SetStatus(sdk.StatusCodeError, errs.Error())
+}
+
+// fieldDepth returns the number of fields in the path, list indexes don't count.
+func fieldDepth(path ast.Path) int {
+	depth := 0
+	for _, p := range path {
+		if _, ok := p.(ast.PathName); ok {
+			depth++
+		}
+	}
+	return depth
+}
@@ -0,0 +1,175 @@
+package gqlgen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+var schema = gqlparser.MustLoadSchema(&ast.Source{Input: `
+	type User {
+		id: ID!
+		friends: [User!]!
+	}
+	type Query {
+		user(id: ID!): User
+	}
+`})
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*mock.Span
+}
+
+func (r *spanRecorder) startSpan(ctx context.Context, name string, opts *sdk.SpanOptions) (context.Context, sdk.Span, func()) {
+	span := mock.NewSpan()
+	span.Name = name
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+	return mock.ContextWithSpan(ctx, span), span, func() {}
+}
+
+// resolveField simulates the generated code resolving a field.
+func resolveField(ctx context.Context, parent *graphql.FieldContext, object, name string, resolve graphql.Resolver) (interface{}, error) {
+	ctx = graphql.WithFieldContext(ctx, &graphql.FieldContext{
+		Parent:     parent,
+		Object:     object,
+		IsResolver: true,
+		Field: graphql.CollectedField{
+			Field: &ast.Field{
+				Name:       name,
+				Alias:      name,
+				Definition: schema.Types[object].Fields.ForName(name),
+			},
+		},
+	})
+	return graphql.GetOperationContext(ctx).ResolverMiddleware(ctx, resolve)
+}
+
+func newServer() *handler.Server {
+	srv := handler.New(&graphql.ExecutableSchemaMock{
+		ExecFunc: func(ctx context.Context) graphql.ResponseHandler {
+			return graphql.OneShot(nil)
+		},
+		SchemaFunc: func() *ast.Schema {
+			return schema
+		},
+	})
+	srv.AddTransport(transport.POST{})
+	return srv
+}
+
+func newServerWithResolvers(resolverErr error) *handler.Server {
+	srv := handler.New(&graphql.ExecutableSchemaMock{
+		ExecFunc: func(ctx context.Context) graphql.ResponseHandler {
+			return func(ctx context.Context) *graphql.Response {
+				_, err := resolveField(ctx, nil, "Query", "user", func(ctx context.Context) (interface{}, error) {
+					userCtx := graphql.GetFieldContext(ctx)
+					return resolveField(ctx, userCtx, "User", "friends", func(ctx context.Context) (interface{}, error) {
+						index := 0
+						itemCtx := &graphql.FieldContext{Parent: graphql.GetFieldContext(ctx), Index: &index}
+						ctx = graphql.WithFieldContext(ctx, itemCtx)
+						return resolveField(ctx, itemCtx, "User", "friends", func(ctx context.Context) (interface{}, error) {
+							return nil, resolverErr
+						})
+					})
+				})
+				if err != nil {
+					graphql.AddError(ctx, err)
+				}
+				return &graphql.Response{Data: []byte(`{"user":null}`)}
+			}
+		},
+		SchemaFunc: func() *ast.Schema {
+			return schema
+		},
+	})
+	srv.AddTransport(transport.POST{})
+	return srv
+}
+
+func doRequest(srv http.Handler, body string) {
+	r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	srv.ServeHTTP(httptest.NewRecorder(), r)
+}
+
+func TestOperationSpanIsCreated(t *testing.T) {
+	recorder := &spanRecorder{}
+	srv := newServerWithResolvers(nil)
+	srv.Use(NewTracer(recorder.startSpan, nil))
+
+	doRequest(srv, `{"query": "query GetUser { user(id: \"1\") { friends { friends { id } } } }"}`)
+
+	assert.Equal(t, 1, len(recorder.spans))
+	span := recorder.spans[0]
+	assert.Equal(t, "query GetUser", span.Name)
+	assert.Equal(t, "query", span.ReadAttribute("graphql.operation.type"))
+	assert.Equal(t, "GetUser", span.ReadAttribute("graphql.operation.name"))
+	assert.Equal(t, `query GetUser { user(id: "") { friends { friends { id } } } }`, span.ReadAttribute("graphql.document"))
+	assert.Nil(t, span.Err)
+	assert.Equal(t, 0, span.RemainingAttributes())
+}
+
+func TestFieldSpansAreCreatedUpToMaxDepth(t *testing.T) {
+	recorder := &spanRecorder{}
+	srv := newServerWithResolvers(errors.New("user not found"))
+	srv.Use(NewTracer(recorder.startSpan, &Options{FieldSpans: true, MaxFieldDepth: 2}))
+
+	doRequest(srv, `{"query": "query GetUser { user(id: \"1\") { friends { friends { id } } } }"}`)
+
+	// operation span, user and user.friends, user.friends[0].friends is too deep
+	assert.Equal(t, 3, len(recorder.spans))
+
+	opSpan := recorder.spans[0]
+	assert.Equal(t, 1, opSpan.ReadAttribute("graphql.errors.count"))
+	assert.EqualError(t, opSpan.Err, "input: user not found\n")
+	assert.Equal(t, sdk.StatusCodeError, opSpan.Status.Code)
+
+	userSpan := recorder.spans[1]
+	assert.Equal(t, "Query.user", userSpan.Name)
+	assert.Equal(t, "user", userSpan.ReadAttribute("graphql.field.name"))
+	assert.Equal(t, "Query", userSpan.ReadAttribute("graphql.field.parent_type"))
+	assert.Equal(t, "user", userSpan.ReadAttribute("graphql.field.path"))
+	assert.Equal(t, "User", userSpan.ReadAttribute("graphql.field.type"))
+	assert.EqualError(t, userSpan.Err, "user not found")
+
+	friendsSpan := recorder.spans[2]
+	assert.Equal(t, "User.friends", friendsSpan.Name)
+	assert.Equal(t, "user.friends", friendsSpan.ReadAttribute("graphql.field.path"))
+	assert.Equal(t, "[User!]!", friendsSpan.ReadAttribute("graphql.field.type"))
+}
+
+func TestInvalidDocumentIsRecorded(t *testing.T) {
+	recorder := &spanRecorder{}
+	srv := newServer()
+	srv.Use(NewTracer(recorder.startSpan, nil))
+
+	doRequest(srv, `{"query": "query { unknown }"}`)
+
+	assert.Equal(t, 1, len(recorder.spans))
+	span := recorder.spans[0]
+	assert.Equal(t, "query", span.Name)
+	assert.Equal(t, 1, span.ReadAttribute("graphql.errors.count"))
+	assert.Error(t, span.Err)
+	assert.Equal(t, sdk.StatusCodeError, span.Status.Code)
+}
+
+func TestFieldDepth(t *testing.T) {
+	assert.Equal(t, 1, fieldDepth(ast.Path{ast.PathName("user")}))
+	assert.Equal(t, 3, fieldDepth(ast.Path{ast.PathName("user"), ast.PathName("friends"), ast.PathIndex(0), ast.PathName("id")}))
+}
@@ -0,0 +1,124 @@
+package graphqlgo // import "github.com/hypertrace/goagent/sdk/instrumentation/github.com/graph-gophers/graphql-go"
+
+import (
+	"context"
+	"errors"
+
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/introspection"
+	"github.com/graph-gophers/graphql-go/trace/tracer"
+	"github.com/hypertrace/goagent/sdk"
+	sdkgraphql "github.com/hypertrace/goagent/sdk/instrumentation/graphql"
+)
+
+// defaultOperationSpanName is used when the operation can't be found, e.g.
+// when the document can't be parsed.
+const defaultOperationSpanName = "GraphQL Operation"
+
+// Options for graphql-go instrumentation
+type Options struct {
+	// FieldSpans creates a span per resolver field, trivial fields (those
+	// resolved by reading a struct field) are never recorded.
+	FieldSpans bool
+	// MaxFieldDepth is the deepest field, counting from the root fields as
+	// depth 1, for which a span is created. Zero means no limit.
+	MaxFieldDepth int
+}
+
+type fieldDepthKey struct{}
+
+type graphqlTracer struct {
+	startSpan     sdk.StartSpan
+	fieldSpans    bool
+	maxFieldDepth int
+}
+
+var _ tracer.Tracer = &graphqlTracer{}
+
+// NewTracer returns a graphql-go tracer creating a span per operation and, if enabled,
+// per resolver field. It is meant to be passed to the schema using `graphql.Tracer(t)`.
+func NewTracer(startSpan sdk.StartSpan, options *Options) tracer.Tracer {
+	t := &graphqlTracer{startSpan: startSpan}
+	if options != nil {
+		t.fieldSpans = options.FieldSpans
+		t.maxFieldDepth = options.MaxFieldDepth
+	}
+	return t
+}
+
+// TraceQuery creates a span for the operation, the document is normalized so it does
+// not include any literal value.
+func (t *graphqlTracer) TraceQuery(
+	ctx context.Context,
+	queryString string,
+	operationName string,
+	_ map[string]interface{},
+	_ map[string]*introspection.Type,
+) (context.Context, tracer.QueryFinishFunc) {
+	spanName := defaultOperationSpanName
+	op, err := sdkgraphql.ParseOperation(queryString, operationName)
+	if err == nil {
+		spanName = op.SpanName()
+	}
+
+	ctx, span, end := t.startSpan(ctx, spanName, &sdk.SpanOptions{})
+	if err == nil {
+		span.SetAttribute("graphql.operation.type", op.Type)
+		if op.Name != "" {
+			span.SetAttribute("graphql.operation.name", op.Name)
+		}
+		span.SetAttribute("graphql.document", op.Document)
+	}
+
+	return ctx, func(queryErrs []*gqlerrors.QueryError) {
+		defer end()
+
+		if len(queryErrs) == 0 {
+			return
+		}
+
+		errs := make([]error, 0, len(queryErrs))
+		for _, queryErr := range queryErrs {
+			errs = append(errs, queryErr)
+		}
+		err := errors.Join(errs...)
+
+		span.SetAttribute("graphql.errors.count", len(queryErrs))
+		span.SetError(err)
+		span.SetStatus(sdk.StatusCodeError, err.Error())
+	}
+}
+
+// TraceField creates a span for the resolver fields up to the max depth.
+func (t *graphqlTracer) TraceField(
+	ctx context.Context,
+	_, typeName, fieldName string,
+	trivial bool,
+	_ map[string]interface{},
+) (context.Context, tracer.FieldFinishFunc) {
+	if !t.fieldSpans {
+		return ctx, func(*gqlerrors.QueryError) {}
+	}
+
+	// the context returned here is the one used for the nested fields.
+	depth, _ := ctx.Value(fieldDepthKey{}).(int)
+	depth++
+	ctx = context.WithValue(ctx, fieldDepthKey{}, depth)
+
+	if trivial || (t.maxFieldDepth > 0 && depth > t.maxFieldDepth) {
+		return ctx, func(*gqlerrors.QueryError) {}
+	}
+
+	ctx, span, end := t.startSpan(ctx, typeName+"."+fieldName, &sdk.SpanOptions{})
+	span.SetAttribute("graphql.field.name", fieldName)
+	span.SetAttribute("graphql.field.parent_type", typeName)
+
+	return ctx, func(err *gqlerrors.QueryError) {
+		defer end()
+
+		if err != nil {
+			span.SetError(err)
+			span.SetStatus(sdk.StatusCodeError, err.Error())
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package graphqlgo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+const schemaString = `
+	type User {
+		id: ID!
+		name: String!
+		friends: [User!]!
+	}
+	type Query {
+		user(id: ID!): User
+	}
+`
+
+type user struct {
+	ID   graphql.ID
+	Name string
+}
+
+func (u *user) Friends() ([]*user, error) {
+	if u.ID == "2" {
+		return nil, errors.New("friends not available")
+	}
+	return []*user{{ID: "2", Name: "jane"}}, nil
+}
+
+type resolver struct{}
+
+func (*resolver) User(args struct{ ID graphql.ID }) *user {
+	return &user{ID: args.ID, Name: "john"}
+}
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*mock.Span
+}
+
+func (r *spanRecorder) startSpan(ctx context.Context, name string, opts *sdk.SpanOptions) (context.Context, sdk.Span, func()) {
+	span := mock.NewSpan()
+	span.Name = name
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+	return mock.ContextWithSpan(ctx, span), span, func() {}
+}
+
+func (r *spanRecorder) spanByName(name string) *mock.Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestOperationSpanIsCreated(t *testing.T) {
+	recorder := &spanRecorder{}
+	schema := graphql.MustParseSchema(schemaString, &resolver{},
+		graphql.UseFieldResolvers(), graphql.Tracer(NewTracer(recorder.startSpan, nil)))
+
+	res := schema.Exec(context.Background(), `query GetUser { user(id: "1") { name } }`, "", nil)
+	assert.Empty(t, res.Errors)
+
+	assert.Equal(t, 1, len(recorder.spans))
+	span := recorder.spans[0]
+	assert.Equal(t, "query GetUser", span.Name)
+	assert.Equal(t, "query", span.ReadAttribute("graphql.operation.type"))
+	assert.Equal(t, "GetUser", span.ReadAttribute("graphql.operation.name"))
+	assert.Equal(t, `query GetUser { user(id: "") { name } }`, span.ReadAttribute("graphql.document"))
+	assert.Equal(t, 0, span.RemainingAttributes())
+	assert.Nil(t, span.Err)
+}
+
+func TestFieldSpansAreCreatedUpToMaxDepth(t *testing.T) {
+	recorder := &spanRecorder{}
+	schema := graphql.MustParseSchema(schemaString, &resolver{},
+		graphql.UseFieldResolvers(), graphql.Tracer(NewTracer(recorder.startSpan, &Options{FieldSpans: true, MaxFieldDepth: 2})))
+
+	res := schema.Exec(context.Background(), `{ user(id: "1") { name friends { id friends { id } } } }`, "", nil)
+	assert.Equal(t, 1, len(res.Errors))
+
+	// operation span, Query.user and User.friends, the nested User.friends is too deep
+	// and User.name and User.id are trivial fields.
+	assert.Equal(t, 3, len(recorder.spans))
+
+	opSpan := recorder.spanByName("query")
+	assert.Equal(t, 1, opSpan.ReadAttribute("graphql.errors.count"))
+	assert.Equal(t, sdk.StatusCodeError, opSpan.Status.Code)
+	assert.ErrorContains(t, opSpan.Err, "friends not available")
+
+	userSpan := recorder.spanByName("Query.user")
+	assert.Equal(t, "user", userSpan.ReadAttribute("graphql.field.name"))
+	assert.Equal(t, "Query", userSpan.ReadAttribute("graphql.field.parent_type"))
+	assert.Nil(t, userSpan.Err)
+
+	assert.NotNil(t, recorder.spanByName("User.friends"))
+}
+
+func TestFieldErrorIsRecorded(t *testing.T) {
+	recorder := &spanRecorder{}
+	schema := graphql.MustParseSchema(schemaString, &resolver{},
+		graphql.UseFieldResolvers(), graphql.Tracer(NewTracer(recorder.startSpan, &Options{FieldSpans: true})))
+
+	schema.Exec(context.Background(), `{ user(id: "2") { friends { id } } }`, "", nil)
+
+	friendsSpan := recorder.spanByName("User.friends")
+	assert.ErrorContains(t, friendsSpan.Err, "friends not available")
+	assert.Equal(t, sdk.StatusCodeError, friendsSpan.Status.Code)
+}
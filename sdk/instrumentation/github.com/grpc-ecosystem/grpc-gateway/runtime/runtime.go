@@ -0,0 +1,53 @@
+package runtime // import "github.com/hypertrace/goagent/sdk/instrumentation/github.com/grpc-ecosystem/grpc-gateway/runtime"
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/hypertrace/goagent/sdk"
+	"google.golang.org/grpc/metadata"
+)
+
+// Propagate injects the trace context of ctx into the metadata.
+type Propagate func(ctx context.Context, md metadata.MD)
+
+// WithSpanAnnotator returns a ServeMux option that tags the span of the HTTP request, that
+// is the one started by the instrumented HTTP handler wrapping the ServeMux, with the gRPC
+// method the request is transcoded to. The trace context is injected in the metadata
+// sent to the gRPC server by propagate, if not nil, so its span is a child of the HTTP span.
+func WithSpanAnnotator(spanFromContext sdk.SpanFromContext, propagate Propagate) runtime.ServeMuxOption {
+	return runtime.WithMetadata(func(ctx context.Context, _ *http.Request) metadata.MD {
+		if span := spanFromContext(ctx); !span.IsNoop() {
+			SetRPCAttributes(ctx, span)
+		}
+
+		if propagate == nil {
+			return nil
+		}
+
+		md := metadata.MD{}
+		propagate(ctx, md)
+		return md
+	})
+}
+
+// SetRPCAttributes sets the gRPC method and the HTTP route of the request being
+// transcoded, ctx is the one passed by the gateway to the handler.
+func SetRPCAttributes(ctx context.Context, span sdk.Span) {
+	fullMethod, ok := runtime.RPCMethod(ctx)
+	if !ok {
+		return
+	}
+
+	span.SetAttribute("rpc.system", "grpc")
+	if service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/"); ok {
+		span.SetAttribute("rpc.service", service)
+		span.SetAttribute("rpc.method", method)
+	}
+
+	if pattern, ok := runtime.HTTPPathPattern(ctx); ok {
+		span.SetAttribute("http.route", pattern)
+	}
+}
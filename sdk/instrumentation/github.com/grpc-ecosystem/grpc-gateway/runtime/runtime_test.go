@@ -0,0 +1,48 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestSpanIsAnnotated(t *testing.T) {
+	var outgoingMD metadata.MD
+	mux := runtime.NewServeMux(WithSpanAnnotator(mock.SpanFromContext, func(_ context.Context, md metadata.MD) {
+		md.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	}))
+
+	// simulates the generated code
+	err := mux.HandlePath(http.MethodGet, "/v1/hello/{name}", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		ctx, err := runtime.AnnotateContext(r.Context(), mux, r, "/helloworld.Greeter/SayHello",
+			runtime.WithHTTPPathPattern("/v1/hello/{name}"))
+		assert.NoError(t, err)
+		outgoingMD, _ = metadata.FromOutgoingContext(ctx)
+	})
+	assert.NoError(t, err)
+
+	span := mock.NewSpan()
+	r := httptest.NewRequest(http.MethodGet, "/v1/hello/pupo", nil)
+	r = r.WithContext(mock.ContextWithSpan(r.Context(), span))
+	mux.ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Equal(t, "grpc", span.ReadAttribute("rpc.system"))
+	assert.Equal(t, "helloworld.Greeter", span.ReadAttribute("rpc.service"))
+	assert.Equal(t, "SayHello", span.ReadAttribute("rpc.method"))
+	assert.Equal(t, "/v1/hello/{name}", span.ReadAttribute("http.route"))
+	assert.Equal(t, 0, span.RemainingAttributes())
+
+	assert.Equal(t, []string{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}, outgoingMD.Get("traceparent"))
+}
+
+func TestSpanIsNotAnnotatedWithoutRPCMethod(t *testing.T) {
+	span := mock.NewSpan()
+	SetRPCAttributes(context.Background(), span)
+	assert.Equal(t, 0, span.RemainingAttributes())
+}
@@ -3,18 +3,29 @@ package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
 	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
 	"github.com/hypertrace/goagent/sdk/internal/container"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
 )
 
 // WrapUnaryClientInterceptor returns an interceptor that records the request and response message's body
 // and serialize it as JSON.
 func WrapUnaryClientInterceptor(delegateInterceptor grpc.UnaryClientInterceptor, spanFromContext sdk.SpanFromContext,
 	spanAttributes map[string]string) grpc.UnaryClientInterceptor {
+	return WrapUnaryClientInterceptorWithOptions(delegateInterceptor, spanFromContext, nil, spanAttributes)
+}
+
+// WrapUnaryClientInterceptorWithOptions is like WrapUnaryClientInterceptor but it also accepts
+// instrumentation options.
+func WrapUnaryClientInterceptorWithOptions(delegateInterceptor grpc.UnaryClientInterceptor, spanFromContext sdk.SpanFromContext,
+	options *Options, spanAttributes map[string]string) grpc.UnaryClientInterceptor {
 	defaultAttributes := map[string]string{
 		"rpc.system": "grpc",
 	}
@@ -25,9 +36,9 @@ func WrapUnaryClientInterceptor(delegateInterceptor grpc.UnaryClientInterceptor,
 		defaultAttributes["container_id"] = containerID
 	}
 
-	dataCaptureConfig := internalconfig.GetConfig().GetDataCapture()
-
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		// the config is read on every call as it can be updated at runtime.
+		dataCaptureConfig := internalconfig.GetConfig().GetDataCapture()
 		var header metadata.MD
 		var trailer metadata.MD
 
@@ -60,16 +71,25 @@ func WrapUnaryClientInterceptor(delegateInterceptor grpc.UnaryClientInterceptor,
 				setAttributesFromRequestOutgoingMetadata(ctx, span)
 			}
 
-			err = invoker(ctx, method, req, reply, cc, opts...)
-			if err != nil {
-				return err
+			if options != nil && options.Filter != nil {
+				ctx, err = evaluateClientFilter(ctx, span, options.Filter)
+				if err != nil {
+					return err
+				}
 			}
 
+			err = invoker(ctx, method, req, reply, cc, opts...)
 			if dataCaptureConfig.RpcMetadata.Response.Value {
 				setAttributesFromMetadata("response", header, span)
 				setAttributesFromMetadata("response", trailer, span)
 			}
 
+			s, _ := status.FromError(err)
+			setStatusAttributes(s, span)
+			if err != nil {
+				return err
+			}
+
 			resBody, err := marshalMessageableJSON(reply)
 			if dataCaptureConfig.RpcBody.Response.Value && len(resBody) > 0 && err == nil {
 				setTruncatedBodyAttribute("response", resBody, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span)
@@ -85,3 +105,138 @@ func WrapUnaryClientInterceptor(delegateInterceptor grpc.UnaryClientInterceptor,
 		return delegateInterceptor(ctx, method, req, reply, cc, wrappedInvoker, opts...)
 	}
 }
+
+// evaluateClientFilter returns the error to be returned to the caller if the request is
+// blocked, otherwise the decorations are appended to the outgoing metadata.
+func evaluateClientFilter(ctx context.Context, span sdk.Span, f filter.Filter) (context.Context, error) {
+	filterResult := f.Evaluate(span)
+	if filterResult.Block {
+		return ctx, status.Error(StatusCode(int(filterResult.ResponseStatusCode)), StatusText(int(filterResult.ResponseStatusCode)))
+	} else if filterResult.Decorations != nil {
+		for _, header := range filterResult.Decorations.RequestHeaderInjections {
+			ctx = metadata.AppendToOutgoingContext(ctx, header.Key, header.Value)
+			span.SetAttribute("rpc.request.metadata."+header.Key, header.Value)
+		}
+	}
+	return ctx, nil
+}
+
+// taggedRPCKey marks the context of an RPC already tagged by a client filter interceptor
+// so the stats handler does not start a second span when the RPC is invoked.
+type taggedRPCKey struct{}
+
+// FilterUnaryClientInterceptor returns an interceptor that evaluates the filter on the span
+// of the outgoing RPC. Blocked calls never reach the server.
+//
+// The client span is only started once the RPC is invoked, hence the interceptor tags the RPC
+// itself through the statsHandler. The statsHandler must be the one returned by WrapStatsHandler
+// and set on the same client through grpc.WithStatsHandler: that handler doesn't tag the RPCs
+// already tagged by the interceptor, any other one starts a second span per RPC.
+func FilterUnaryClientInterceptor(statsHandler stats.Handler, spanFromContext sdk.SpanFromContext, options *Options) grpc.UnaryClientInterceptor {
+	if options == nil || options.Filter == nil {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+	}
+
+	tagger := newClientRPCTagger(statsHandler, spanFromContext)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := tagger.tag(ctx, method)
+		if span.IsNoop() {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		dataCaptureConfig := internalconfig.GetConfig().GetDataCapture()
+		reqBody, err := marshalMessageableJSON(req)
+		if dataCaptureConfig.RpcBody.Request.Value && len(reqBody) > 0 && err == nil {
+			setTruncatedBodyAttribute("request", reqBody, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span)
+		}
+
+		ctx, err = evaluateClientFilter(ctx, span, options.Filter)
+		if err != nil {
+			tagger.end(ctx, err)
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// FilterStreamClientInterceptor returns an interceptor that evaluates the filter on the span
+// of the outgoing RPC, see FilterUnaryClientInterceptor for the statsHandler it must be
+// given. As messages are sent once the stream
+// is open only the metadata is available to the filter.
+func FilterStreamClientInterceptor(statsHandler stats.Handler, spanFromContext sdk.SpanFromContext, options *Options) grpc.StreamClientInterceptor {
+	if options == nil || options.Filter == nil {
+		return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+	}
+
+	tagger := newClientRPCTagger(statsHandler, spanFromContext)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := tagger.tag(ctx, method)
+		if span.IsNoop() {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		ctx, err := evaluateClientFilter(ctx, span, options.Filter)
+		if err != nil {
+			tagger.end(ctx, err)
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// clientRPCTagger starts the client span of an RPC ahead of its invocation so the filter
+// can be evaluated on it.
+type clientRPCTagger struct {
+	statsHandler      stats.Handler
+	spanFromContext   sdk.SpanFromContext
+	defaultAttributes map[string]string
+}
+
+func newClientRPCTagger(statsHandler stats.Handler, spanFromContext sdk.SpanFromContext) *clientRPCTagger {
+	defaultAttributes := map[string]string{
+		"rpc.system": "grpc",
+	}
+	if containerID, err := container.GetID(); err == nil {
+		defaultAttributes["container_id"] = containerID
+	}
+
+	return &clientRPCTagger{
+		statsHandler:      statsHandler,
+		spanFromContext:   spanFromContext,
+		defaultAttributes: defaultAttributes,
+	}
+}
+
+// tag starts the client span and records the attributes known before the RPC is invoked.
+func (t *clientRPCTagger) tag(ctx context.Context, method string) (context.Context, sdk.Span) {
+	ctx = t.statsHandler.TagRPC(ctx, &stats.RPCTagInfo{FullMethodName: method})
+	ctx = context.WithValue(ctx, taggedRPCKey{}, time.Now())
+
+	span := t.spanFromContext(ctx)
+	if span.IsNoop() {
+		return ctx, span
+	}
+
+	for key, value := range t.defaultAttributes {
+		span.SetAttribute(key, value)
+	}
+	if internalconfig.GetConfig().GetDataCapture().RpcMetadata.Request.Value {
+		setAttributesFromRequestOutgoingMetadata(ctx, span)
+	}
+	return ctx, span
+}
+
+// end finishes the RPC that is not going to be invoked because of err.
+func (t *clientRPCTagger) end(ctx context.Context, err error) {
+	beginTime, _ := ctx.Value(taggedRPCKey{}).(time.Time)
+	t.statsHandler.HandleRPC(ctx, &stats.End{
+		Client:    true,
+		BeginTime: beginTime,
+		EndTime:   time.Now(),
+		Error:     err,
+	})
+}
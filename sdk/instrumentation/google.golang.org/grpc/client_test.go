@@ -6,12 +6,16 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter/result"
 	"github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc/internal/helloworld"
 	"github.com/hypertrace/goagent/sdk/internal/mock"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func makeMockUnaryClientInterceptor(mockSpans *[]*mock.Span) grpc.UnaryClientInterceptor {
@@ -97,6 +101,8 @@ func TestUnaryClientHelloWorldSuccess(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
+	assert.Equal(t, 0, span.ReadAttribute("rpc.grpc.status_code"))
+
 	_ = span.ReadAttribute("container_id") // needed in containarized envs
 	assert.Zero(t, span.RemainingAttributes(), "unexpected remaining attribute: %v", span.Attributes)
 }
@@ -241,6 +247,152 @@ func TestBodyTruncation(t *testing.T) {
 	// direct comparison of the body since it will be truncated
 	assert.Equal(t, expectedBody, actualBody)
 
+	assert.Equal(t, 0, span.ReadAttribute("rpc.grpc.status_code"))
+
 	_ = span.ReadAttribute("container_id") // needed in containarized envs
 	assert.Zero(t, span.RemainingAttributes(), "unexpected remaining attribute: %v", span.Attributes)
 }
+
+func TestUnaryClientInterceptorFilter(t *testing.T) {
+	spans := []*mock.Span{}
+
+	s := grpc.NewServer()
+	defer s.Stop()
+
+	mockServer := &server{}
+	helloworld.RegisterGreeterServer(s, mockServer)
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(
+			WrapUnaryClientInterceptorWithOptions(
+				makeMockUnaryClientInterceptor(&spans),
+				mock.SpanFromContext,
+				&Options{Filter: mock.Filter{
+					Evaluator: func(span sdk.Span) result.FilterResult {
+						if span.GetAttributes().GetValue("rpc.request.metadata.tenant") == "blocked" {
+							return result.FilterResult{Block: true, ResponseStatusCode: 403}
+						}
+						return result.FilterResult{Decorations: &result.Decorations{
+							RequestHeaderInjections: []result.KeyValueString{{Key: "injected-header", Value: "injected-value"}},
+						}}
+					},
+				}},
+				nil,
+			),
+		),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufnet: %v", err)
+	}
+	defer conn.Close()
+
+	client := helloworld.NewGreeterClient(conn)
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("tenant", "allowed"))
+	_, err = client.SayHello(ctx, &helloworld.HelloRequest{Name: "Pupo"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"injected-value"}, mockServer.requestHeader.Get("injected-header"))
+	assert.Equal(t, []string{"allowed"}, mockServer.requestHeader.Get("tenant"))
+	assert.Equal(t, "injected-value", spans[0].ReadAttribute("rpc.request.metadata.injected-header"))
+
+	mockServer.requestHeader = nil
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("tenant", "blocked"))
+	_, err = client.SayHello(ctx, &helloworld.HelloRequest{Name: "Pupo"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Nil(t, mockServer.requestHeader, "blocked call should not reach the server")
+	assert.Equal(t, 2, len(spans))
+}
+
+func TestFilterUnaryClientInterceptorWithStatsHandler(t *testing.T) {
+	s := grpc.NewServer()
+	defer s.Stop()
+
+	mockServer := &server{}
+	helloworld.RegisterGreeterServer(s, mockServer)
+
+	mockHandler := &mockHandler{}
+	statsHandler := WrapStatsHandler(mockHandler, mock.SpanFromContext)
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(statsHandler),
+		grpc.WithUnaryInterceptor(FilterUnaryClientInterceptor(statsHandler, mock.SpanFromContext, &Options{Filter: mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				// the filter is evaluated on the client span before the call is sent
+				assert.Equal(t, "helloworld.Greeter", span.GetAttributes().GetValue("rpc.service"))
+				assert.Equal(t, "SayHello", span.GetAttributes().GetValue("rpc.method"))
+				if span.GetAttributes().GetValue("rpc.request.body") == `{"name":"Blocked"}` {
+					return result.FilterResult{Block: true, ResponseStatusCode: 429}
+				}
+				return result.FilterResult{Decorations: &result.Decorations{
+					RequestHeaderInjections: []result.KeyValueString{{Key: "tenant", Value: "acme"}},
+				}}
+			},
+		}})),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufnet: %v", err)
+	}
+	defer conn.Close()
+
+	client := helloworld.NewGreeterClient(conn)
+
+	_, err = client.SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme"}, mockServer.requestHeader.Get("tenant"))
+
+	// the stats handler does not start a second span for the tagged RPC
+	assert.Equal(t, 1, len(mockHandler.Spans))
+	span := mockHandler.Spans[0]
+	assert.Equal(t, "acme", span.ReadAttribute("rpc.request.metadata.tenant"))
+	assert.Equal(t, "grpc", span.ReadAttribute("rpc.system"))
+	assert.NotNil(t, span.ReadAttribute("rpc.response.body"))
+
+	mockServer.requestHeader = nil
+	_, err = client.SayHello(context.Background(), &helloworld.HelloRequest{Name: "Blocked"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Nil(t, mockServer.requestHeader, "blocked call should not reach the server")
+
+	assert.Equal(t, 2, len(mockHandler.Spans))
+	span = mockHandler.Spans[1]
+	assert.Equal(t, sdk.StatusCodeError, span.Status.Code)
+	assert.Nil(t, span.ReadAttribute("rpc.response.body"))
+}
+
+func TestFilterStreamClientInterceptor(t *testing.T) {
+	mockHandler := &mockHandler{}
+	statsHandler := WrapStatsHandler(mockHandler, mock.SpanFromContext)
+	interceptor := FilterStreamClientInterceptor(statsHandler, mock.SpanFromContext, &Options{Filter: mock.Filter{
+		Evaluator: func(span sdk.Span) result.FilterResult {
+			if span.GetAttributes().GetValue("rpc.method") == "Blocked" {
+				return result.FilterResult{Block: true, ResponseStatusCode: 403}
+			}
+			return result.FilterResult{Decorations: &result.Decorations{
+				RequestHeaderInjections: []result.KeyValueString{{Key: "tenant", Value: "acme"}},
+			}}
+		},
+	}})
+
+	var streamerMD metadata.MD
+	streamer := func(ctx context.Context, _ *grpc.StreamDesc, _ *grpc.ClientConn, _ string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+		streamerMD, _ = metadata.FromOutgoingContext(ctx)
+		return nil, nil
+	}
+
+	_, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/helloworld.Greeter/SayHello", streamer)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme"}, streamerMD.Get("tenant"))
+	assert.Equal(t, "acme", mockHandler.Spans[0].ReadAttribute("rpc.request.metadata.tenant"))
+
+	streamerMD = nil
+	_, err = interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/helloworld.Greeter/Blocked", streamer)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Nil(t, streamerMD)
+	assert.Equal(t, sdk.StatusCodeError, mockHandler.Spans[1].Status.Code)
+}
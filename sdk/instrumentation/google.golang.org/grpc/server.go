@@ -107,24 +107,32 @@ func wrapHandler(
 
 		// TODO: decide what should be passed as URL in GRPC
 		// single evaluation call to filter after capturing the configured parameters
-		filterResult := filter.Evaluate(span)
-		if filterResult.Block {
-			return nil, status.Error(StatusCode(int(filterResult.ResponseStatusCode)), StatusText(int(filterResult.ResponseStatusCode)))
-		} else if filterResult.Decorations != nil {
-			if md, ok := metadata.FromIncomingContext(ctx); ok {
-				for _, header := range filterResult.Decorations.RequestHeaderInjections {
-					md.Append(header.Key, header.Value)
-					span.SetAttribute("rpc.request.metadata."+header.Key, header.Value)
-				}
-				ctx = metadata.NewIncomingContext(ctx, md)
+		ctx, err = evaluateFilter(ctx, span, filter)
+		if err != nil {
+			setStatusAttributes(status.Convert(err), span)
+			return nil, err
+		}
+
+		var sts *serverTransportStream
+		if dataCaptureConfig.RpcMetadata.Response.Value {
+			if delegate := grpc.ServerTransportStreamFromContext(ctx); delegate != nil {
+				sts = &serverTransportStream{ServerTransportStream: delegate}
+				ctx = grpc.NewContextWithServerTransportStream(ctx, sts)
 			}
 		}
 
 		res, err := delegateHandler(ctx, req)
+		if sts != nil {
+			// metadata is recorded no matter the outcome as it is usually
+			// meaningful when the call fails.
+			setAttributesFromMetadata("response", sts.header, span)
+			setAttributesFromMetadata("response", sts.trailer, span)
+		}
+
+		s, _ := status.FromError(err)
+		setStatusAttributes(s, span)
 		if err != nil {
-			s, _ := status.FromError(err)
 			span.SetStatus(codes.StatusCodeError, s.Message())
-			span.SetAttribute("rpc.grpc.status_code", s.Code())
 			return res, err
 		}
 
@@ -138,13 +146,121 @@ func wrapHandler(
 	}
 }
 
+// evaluateFilter returns the error to be returned by the handler if the request is
+// blocked, otherwise the decorations are appended to the incoming metadata.
+func evaluateFilter(ctx context.Context, span sdk.Span, f filter.Filter) (context.Context, error) {
+	filterResult := f.Evaluate(span)
+	if filterResult.Block {
+		return ctx, status.Error(StatusCode(int(filterResult.ResponseStatusCode)), StatusText(int(filterResult.ResponseStatusCode)))
+	} else if filterResult.Decorations != nil {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			md = md.Copy()
+			for _, header := range filterResult.Decorations.RequestHeaderInjections {
+				md.Append(header.Key, header.Value)
+				span.SetAttribute("rpc.request.metadata."+header.Key, header.Value)
+			}
+			ctx = metadata.NewIncomingContext(ctx, md)
+		}
+	}
+	return ctx, nil
+}
+
+// FilterUnaryServerInterceptor returns an interceptor that evaluates the filter on the span
+// of the RPC, it is meant to be used along with a stats handler returned by WrapStatsHandler
+// which records the request body and metadata before the interceptor is invoked.
+func FilterUnaryServerInterceptor(spanFromContext sdk.SpanFromContext, options *Options) grpc.UnaryServerInterceptor {
+	if options == nil || options.Filter == nil {
+		return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			return handler(ctx, req)
+		}
+	}
+
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		span := spanFromContext(ctx)
+		if span.IsNoop() {
+			return handler(ctx, req)
+		}
+
+		ctx, err := evaluateFilter(ctx, span, options.Filter)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// FilterStreamServerInterceptor returns an interceptor that evaluates the filter on the span
+// of the RPC. As messages are received once the stream is open only the metadata is
+// available to the filter.
+func FilterStreamServerInterceptor(spanFromContext sdk.SpanFromContext, options *Options) grpc.StreamServerInterceptor {
+	if options == nil || options.Filter == nil {
+		return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			return handler(srv, ss)
+		}
+	}
+
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		span := spanFromContext(ss.Context())
+		if span.IsNoop() {
+			return handler(srv, ss)
+		}
+
+		ctx, err := evaluateFilter(ss.Context(), span, options.Filter)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream overrides the context of the stream so the handler gets the decorated metadata.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// serverTransportStream keeps a copy of the metadata set by the handler so it can be
+// recorded once the handler returns.
+type serverTransportStream struct {
+	grpc.ServerTransportStream
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *serverTransportStream) SetHeader(md metadata.MD) error {
+	if err := s.ServerTransportStream.SetHeader(md); err != nil {
+		return err
+	}
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *serverTransportStream) SendHeader(md metadata.MD) error {
+	if err := s.ServerTransportStream.SendHeader(md); err != nil {
+		return err
+	}
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *serverTransportStream) SetTrailer(md metadata.MD) error {
+	if err := s.ServerTransportStream.SetTrailer(md); err != nil {
+		return err
+	}
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
 var _ stats.Handler = (*handler)(nil)
 
 type handler struct {
 	stats.Handler
 	spanFromContext   sdk.SpanFromContext
 	defaultAttributes map[string]string
-	dataCaptureConfig *config.DataCapture
 }
 
 // HandleRPC implements per-RPC tracing and stats instrumentation.
@@ -160,32 +276,38 @@ func (s *handler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
 		return
 	}
 
+	// the config is read on every event as it can be updated at runtime.
+	dataCaptureConfig := internalconfig.GetConfig().GetDataCapture()
 	switch rs := rs.(type) {
 	case *stats.Begin:
 		for key, value := range s.defaultAttributes {
 			span.SetAttribute(key, value)
 		}
+		if !rs.IsClient() {
+			span.SetAttribute("rpc.request.metadata.:method", http.MethodPost)
+			setSchemeAttributes(ctx, span)
+		}
 	case *stats.InPayload:
 		body, err := marshalMessageableJSON(rs.Payload)
 		if len(body) == 0 || err != nil {
 			return
 		}
 
-		if rs.IsClient() && s.dataCaptureConfig.RpcBody.Response.Value {
-			setTruncatedBodyAttribute("response", body, int(s.dataCaptureConfig.BodyMaxSizeBytes.Value), span)
-		} else if !rs.IsClient() && s.dataCaptureConfig.RpcBody.Request.Value {
-			setTruncatedBodyAttribute("request", body, int(s.dataCaptureConfig.BodyMaxSizeBytes.Value), span)
+		if rs.IsClient() && dataCaptureConfig.RpcBody.Response.Value {
+			setTruncatedBodyAttribute("response", body, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span)
+		} else if !rs.IsClient() && dataCaptureConfig.RpcBody.Request.Value {
+			setTruncatedBodyAttribute("request", body, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span)
 		}
 	case *stats.InHeader:
-		if rs.IsClient() && s.dataCaptureConfig.RpcMetadata.Response.Value {
+		if rs.IsClient() && dataCaptureConfig.RpcMetadata.Response.Value {
 			setAttributesFromMetadata("response", rs.Header, span)
-		} else if !rs.IsClient() && s.dataCaptureConfig.RpcMetadata.Request.Value {
+		} else if !rs.IsClient() && dataCaptureConfig.RpcMetadata.Request.Value {
 			setAttributesFromMetadata("request", rs.Header, span)
 		}
 	case *stats.InTrailer:
-		if rs.IsClient() && s.dataCaptureConfig.RpcMetadata.Response.Value {
+		if rs.IsClient() && dataCaptureConfig.RpcMetadata.Response.Value {
 			setAttributesFromMetadata("response", rs.Trailer, span)
-		} else if !rs.IsClient() && s.dataCaptureConfig.RpcMetadata.Request.Value {
+		} else if !rs.IsClient() && dataCaptureConfig.RpcMetadata.Request.Value {
 			setAttributesFromMetadata("request", rs.Trailer, span)
 		}
 	case *stats.OutPayload:
@@ -194,27 +316,40 @@ func (s *handler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
 			return
 		}
 
-		if rs.IsClient() && s.dataCaptureConfig.RpcBody.Request.Value {
-			setTruncatedBodyAttribute("request", body, int(s.dataCaptureConfig.BodyMaxSizeBytes.Value), span)
-		} else if !rs.IsClient() && s.dataCaptureConfig.RpcBody.Response.Value {
-			setTruncatedBodyAttribute("response", body, int(s.dataCaptureConfig.BodyMaxSizeBytes.Value), span)
+		if rs.IsClient() && dataCaptureConfig.RpcBody.Request.Value {
+			setTruncatedBodyAttribute("request", body, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span)
+		} else if !rs.IsClient() && dataCaptureConfig.RpcBody.Response.Value {
+			setTruncatedBodyAttribute("response", body, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span)
 		}
 	case *stats.OutHeader:
-		if rs.IsClient() && s.dataCaptureConfig.RpcMetadata.Request.Value {
+		if rs.IsClient() && dataCaptureConfig.RpcMetadata.Request.Value {
 			setAttributesFromMetadata("request", rs.Header, span)
-		} else if !rs.IsClient() && s.dataCaptureConfig.RpcMetadata.Response.Value {
+		} else if !rs.IsClient() && dataCaptureConfig.RpcMetadata.Response.Value {
 			setAttributesFromMetadata("response", rs.Header, span)
 		}
+	case *stats.End:
+		// any non OK code is an error, as with the interceptors, even if the
+		// delegate handler only considers server errors as such.
+		st, _ := status.FromError(rs.Error)
+		setStatusAttributes(st, span)
+		if rs.Error != nil {
+			span.SetStatus(codes.StatusCodeError, st.Message())
+		}
 	case *stats.OutTrailer:
-		if rs.IsClient() && s.dataCaptureConfig.RpcMetadata.Request.Value {
+		if rs.IsClient() && dataCaptureConfig.RpcMetadata.Request.Value {
 			setAttributesFromMetadata("request", rs.Trailer, span)
-		} else if !rs.IsClient() && s.dataCaptureConfig.RpcMetadata.Response.Value {
+		} else if !rs.IsClient() && dataCaptureConfig.RpcMetadata.Response.Value {
 			setAttributesFromMetadata("response", rs.Trailer, span)
 		}
 	}
 }
 
 func (s *handler) TagRPC(ctx context.Context, rti *stats.RPCTagInfo) context.Context {
+	if ctx.Value(taggedRPCKey{}) != nil {
+		// the RPC was already tagged by a client filter interceptor.
+		return ctx
+	}
+
 	ctx = s.Handler.TagRPC(ctx, rti)
 	span := s.spanFromContext(ctx)
 	if span.IsNoop() {
@@ -246,7 +381,6 @@ func WrapStatsHandler(delegate stats.Handler, spanFromContext sdk.SpanFromContex
 		Handler:           delegate,
 		spanFromContext:   spanFromContext,
 		defaultAttributes: defaultAttributes,
-		dataCaptureConfig: internalconfig.GetConfig().GetDataCapture(),
 	}
 }
 
@@ -13,6 +13,7 @@ import (
 	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
 	"github.com/hypertrace/goagent/sdk/internal/mock"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
@@ -423,6 +424,8 @@ func TestServerHandlerHelloWorldSuccess(t *testing.T) {
 	assert.Equal(t, "bufnet", span.ReadAttribute("rpc.request.metadata.:authority").(string))
 	assert.Equal(t, "application/grpc", span.ReadAttribute("rpc.request.metadata.content-type").(string))
 	assert.Contains(t, span.ReadAttribute("rpc.request.metadata.user-agent").(string), "test_agent")
+	assert.Equal(t, "POST", span.ReadAttribute("rpc.request.metadata.:method").(string))
+	assert.Equal(t, "http", span.ReadAttribute("rpc.request.metadata.:scheme").(string))
 
 	expectedBody := "{\"name\":\"Pupo\"}"
 	actualBody := span.ReadAttribute("rpc.request.body").(string)
@@ -440,6 +443,8 @@ func TestServerHandlerHelloWorldSuccess(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
+	assert.Equal(t, 0, span.ReadAttribute("rpc.grpc.status_code"))
+
 	_ = span.ReadAttribute("container_id") // needed in containarized envs
 	assert.Zero(t, span.RemainingAttributes(), "unexpected remaining attribute: %v", span.Attributes)
 }
@@ -481,3 +486,146 @@ func TestSetSchemeAttributes(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterUnaryServerInterceptorWithStatsHandler(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	mockHandler := &mockHandler{}
+	s := grpc.NewServer(
+		grpc.StatsHandler(WrapStatsHandler(mockHandler, mock.SpanFromContext)),
+		grpc.UnaryInterceptor(FilterUnaryServerInterceptor(mock.SpanFromContext, &Options{Filter: mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				// body and metadata are captured by the stats handler before the filter is evaluated
+				assert.Equal(t, "test_value", span.GetAttributes().GetValue("rpc.request.metadata.test_key"))
+				assert.Equal(t, `{"name":"Pupo"}`, span.GetAttributes().GetValue("rpc.request.body"))
+				return result.FilterResult{Block: true, ResponseStatusCode: 403}
+			},
+		}})),
+	)
+	defer s.Stop()
+
+	helloworld.RegisterGreeterServer(s, &server{})
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufnet: %v", err)
+	}
+	defer conn.Close()
+
+	client := helloworld.NewGreeterClient(conn)
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("test_key", "test_value"))
+	_, err = client.SayHello(ctx, &helloworld.HelloRequest{Name: "Pupo"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	assert.Equal(t, 1, len(mockHandler.Spans))
+	assert.Nil(t, mockHandler.Spans[0].ReadAttribute("rpc.response.body"))
+}
+
+type mockServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *mockServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestFilterStreamServerInterceptor(t *testing.T) {
+	span := mock.NewSpan()
+	ctx := mock.ContextWithSpan(context.Background(), span)
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("test_key", "test_value"))
+
+	interceptor := FilterStreamServerInterceptor(mock.SpanFromContext, &Options{Filter: mock.Filter{
+		Evaluator: func(span sdk.Span) result.FilterResult {
+			return result.FilterResult{Decorations: &result.Decorations{
+				RequestHeaderInjections: []result.KeyValueString{{Key: "injected_key", Value: "injected_value"}},
+			}}
+		},
+	}})
+
+	var handlerMD metadata.MD
+	err := interceptor(nil, &mockServerStream{ctx: ctx}, &grpc.StreamServerInfo{}, func(_ interface{}, ss grpc.ServerStream) error {
+		handlerMD, _ = metadata.FromIncomingContext(ss.Context())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"injected_value"}, handlerMD.Get("injected_key"))
+	assert.Equal(t, []string{"test_value"}, handlerMD.Get("test_key"))
+	assert.Equal(t, "injected_value", span.ReadAttribute("rpc.request.metadata.injected_key"))
+
+	interceptor = FilterStreamServerInterceptor(mock.SpanFromContext, &Options{Filter: mock.Filter{
+		Evaluator: func(span sdk.Span) result.FilterResult {
+			return result.FilterResult{Block: true, ResponseStatusCode: 429}
+		},
+	}})
+	err = interceptor(nil, &mockServerStream{ctx: ctx}, &grpc.StreamServerInfo{}, func(interface{}, grpc.ServerStream) error {
+		t.Fatal("handler should not be called")
+		return nil
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestServerInterceptorErrorIsRecorded(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	st, _ := status.New(codes.InvalidArgument, "invalid name").WithDetails(
+		&errdetails.ErrorInfo{Reason: "NAME_TOO_SHORT", Domain: "helloworld.example.com"},
+	)
+
+	for name, serverOption := range map[string]func(*[]*mock.Span, *mockHandler) grpc.ServerOption{
+		"interceptor": func(spans *[]*mock.Span, _ *mockHandler) grpc.ServerOption {
+			return grpc.UnaryInterceptor(
+				WrapUnaryServerInterceptor(makeMockUnaryServerInterceptor(spans), mock.SpanFromContext, &Options{}, nil),
+			)
+		},
+		"stats handler": func(_ *[]*mock.Span, h *mockHandler) grpc.ServerOption {
+			return grpc.StatsHandler(WrapStatsHandler(h, mock.SpanFromContext))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			spans := []*mock.Span{}
+			mockHandler := &mockHandler{}
+			s := grpc.NewServer(serverOption(&spans, mockHandler))
+			defer s.Stop()
+
+			helloworld.RegisterGreeterServer(s, &server{
+				err:          st.Err(),
+				replyHeader:  metadata.Pairs("test_header_key", "test_header_value"),
+				replyTrailer: metadata.Pairs("test_trailer_key", "test_trailer_value"),
+			})
+
+			conn, err := grpc.DialContext(
+				context.Background(),
+				"bufnet",
+				grpc.WithContextDialer(createDialer(s)),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			)
+			if err != nil {
+				t.Fatalf("failed to dial bufnet: %v", err)
+			}
+			defer conn.Close()
+
+			client := helloworld.NewGreeterClient(conn)
+
+			_, err = client.SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pu"})
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+			spans = append(spans, mockHandler.Spans...)
+			assert.Equal(t, 1, len(spans))
+
+			span := spans[0]
+			assert.Equal(t, sdk.StatusCodeError, span.Status.Code)
+			assert.Equal(t, "invalid name", span.Status.Message)
+			assert.Equal(t, int(codes.InvalidArgument), span.ReadAttribute("rpc.grpc.status_code"))
+			assert.Equal(t, "NAME_TOO_SHORT", span.ReadAttribute("rpc.grpc.status.error_info.reason"))
+			assert.Equal(t, "test_header_value", span.ReadAttribute("rpc.response.metadata.test_header_key"))
+			assert.Equal(t, "test_trailer_value", span.ReadAttribute("rpc.response.metadata.test_trailer_key"))
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/protobuf/proto"
+)
+
+// StatsHandlerUnaryServerInterceptor returns an interceptor reporting the unary RPCs to the
+// stats handler as the server would if the handler was set through grpc.StatsHandler. It
+// keeps the interceptor based setups working, the handler must not also be set on the server
+// as the RPCs would be reported twice.
+func StatsHandlerUnaryServerInterceptor(statsHandler stats.Handler) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = statsHandler.TagRPC(ctx, &stats.RPCTagInfo{FullMethodName: info.FullMethod})
+
+		beginTime := time.Now()
+		statsHandler.HandleRPC(ctx, &stats.Begin{BeginTime: beginTime})
+		md, _ := metadata.FromIncomingContext(ctx)
+		statsHandler.HandleRPC(ctx, &stats.InHeader{FullMethod: info.FullMethod, Header: md})
+		statsHandler.HandleRPC(ctx, &stats.InPayload{Payload: req, Length: messageSize(req), RecvTime: time.Now()})
+
+		// the metadata set by the handler is only known once it returns.
+		var sts *serverTransportStream
+		if delegate := grpc.ServerTransportStreamFromContext(ctx); delegate != nil {
+			sts = &serverTransportStream{ServerTransportStream: delegate}
+			ctx = grpc.NewContextWithServerTransportStream(ctx, sts)
+		}
+
+		res, err := handler(ctx, req)
+		if sts != nil {
+			statsHandler.HandleRPC(ctx, &stats.OutHeader{FullMethod: info.FullMethod, Header: sts.header})
+		}
+		if err == nil {
+			statsHandler.HandleRPC(ctx, &stats.OutPayload{Payload: res, Length: messageSize(res), SentTime: time.Now()})
+		}
+		if sts != nil {
+			statsHandler.HandleRPC(ctx, &stats.OutTrailer{Trailer: sts.trailer})
+		}
+		statsHandler.HandleRPC(ctx, &stats.End{BeginTime: beginTime, EndTime: time.Now(), Error: err})
+
+		return res, err
+	}
+}
+
+// StatsHandlerUnaryClientInterceptor returns an interceptor reporting the unary RPCs to the
+// stats handler as the client would if the handler was set through grpc.WithStatsHandler,
+// see StatsHandlerUnaryServerInterceptor.
+func StatsHandlerUnaryClientInterceptor(statsHandler stats.Handler) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = statsHandler.TagRPC(ctx, &stats.RPCTagInfo{FullMethodName: method})
+
+		beginTime := time.Now()
+		statsHandler.HandleRPC(ctx, &stats.Begin{Client: true, BeginTime: beginTime})
+		md, _ := metadata.FromOutgoingContext(ctx)
+		statsHandler.HandleRPC(ctx, &stats.OutHeader{Client: true, FullMethod: method, Header: md})
+		statsHandler.HandleRPC(ctx, &stats.OutPayload{Client: true, Payload: req, Length: messageSize(req), SentTime: time.Now()})
+
+		var header, trailer metadata.MD
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Header(&header), grpc.Trailer(&trailer))...)
+
+		statsHandler.HandleRPC(ctx, &stats.InHeader{Client: true, FullMethod: method, Header: header})
+		if err == nil {
+			statsHandler.HandleRPC(ctx, &stats.InPayload{Client: true, Payload: reply, Length: messageSize(reply), RecvTime: time.Now()})
+		}
+		statsHandler.HandleRPC(ctx, &stats.InTrailer{Client: true, Trailer: trailer})
+		statsHandler.HandleRPC(ctx, &stats.End{Client: true, BeginTime: beginTime, EndTime: time.Now(), Error: err})
+
+		return err
+	}
+}
+
+func messageSize(m interface{}) int {
+	if pm, ok := m.(proto.Message); ok {
+		return proto.Size(pm)
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc/internal/helloworld"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestStatsHandlerUnaryInterceptors(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	serverHandler := &mockHandler{}
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(StatsHandlerUnaryServerInterceptor(WrapStatsHandler(serverHandler, mock.SpanFromContext))),
+	)
+	defer s.Stop()
+
+	helloworld.RegisterGreeterServer(s, &server{
+		replyHeader:  metadata.Pairs("test_header_key", "test_header_value"),
+		replyTrailer: metadata.Pairs("test_trailer_key", "test_trailer_value"),
+	})
+
+	clientHandler := &mockHandler{}
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(StatsHandlerUnaryClientInterceptor(WrapStatsHandler(clientHandler, mock.SpanFromContext))),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("test_key", "test_value"))
+	_, err = helloworld.NewGreeterClient(conn).SayHello(ctx, &helloworld.HelloRequest{Name: "Pupo"})
+	require.NoError(t, err)
+
+	for name, spans := range map[string][]*mock.Span{"server": serverHandler.Spans, "client": clientHandler.Spans} {
+		require.Equal(t, 1, len(spans), name)
+		span := spans[0]
+
+		assert.Equal(t, "helloworld.Greeter", span.ReadAttribute("rpc.service"), name)
+		assert.Equal(t, "SayHello", span.ReadAttribute("rpc.method"), name)
+		assert.Equal(t, "test_value", span.ReadAttribute("rpc.request.metadata.test_key"), name)
+		assert.Equal(t, "test_header_value", span.ReadAttribute("rpc.response.metadata.test_header_key"), name)
+		assert.Equal(t, "test_trailer_value", span.ReadAttribute("rpc.response.metadata.test_trailer_key"), name)
+		assert.Equal(t, `{"name":"Pupo"}`, span.ReadAttribute("rpc.request.body"), name)
+		assert.Equal(t, `{"message":"Hello Pupo"}`, span.ReadAttribute("rpc.response.body"), name)
+		assert.Equal(t, 0, span.ReadAttribute("rpc.grpc.status_code"), name)
+	}
+}
+
+func TestStatsHandlerUnaryServerInterceptorRecordsError(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	serverHandler := &mockHandler{}
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(StatsHandlerUnaryServerInterceptor(WrapStatsHandler(serverHandler, mock.SpanFromContext))),
+	)
+	defer s.Stop()
+
+	helloworld.RegisterGreeterServer(s, &server{err: status.Error(codes.NotFound, "not found")})
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	require.Error(t, err)
+
+	require.Equal(t, 1, len(serverHandler.Spans))
+	span := serverHandler.Spans[0]
+	assert.Equal(t, int(codes.NotFound), span.ReadAttribute("rpc.grpc.status_code"))
+	assert.Nil(t, span.ReadAttribute("rpc.response.body"))
+}
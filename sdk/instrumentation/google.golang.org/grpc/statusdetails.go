@@ -0,0 +1,39 @@
+package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+
+import (
+	"fmt"
+
+	"github.com/hypertrace/goagent/sdk"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// setStatusAttributes records the status code of the call and, for failed calls, the
+// details of the google.rpc.Status understood by the agent.
+func setStatusAttributes(st *status.Status, span sdk.Span) {
+	span.SetAttribute("rpc.grpc.status_code", int(st.Code()))
+	if st.Code() == codes.OK {
+		return
+	}
+
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			span.SetAttribute("rpc.grpc.status.error_info.reason", d.GetReason())
+			span.SetAttribute("rpc.grpc.status.error_info.domain", d.GetDomain())
+			for key, value := range d.GetMetadata() {
+				span.SetAttribute("rpc.grpc.status.error_info.metadata."+key, value)
+			}
+		case *errdetails.BadRequest:
+			for index, violation := range d.GetFieldViolations() {
+				span.SetAttribute(fmt.Sprintf("rpc.grpc.status.bad_request.field_violations[%d].field", index), violation.GetField())
+				span.SetAttribute(fmt.Sprintf("rpc.grpc.status.bad_request.field_violations[%d].description", index), violation.GetDescription())
+			}
+		case *errdetails.RetryInfo:
+			if d.GetRetryDelay() != nil {
+				span.SetAttribute("rpc.grpc.status.retry_info.retry_delay_ms", d.GetRetryDelay().AsDuration().Milliseconds())
+			}
+		}
+	}
+}
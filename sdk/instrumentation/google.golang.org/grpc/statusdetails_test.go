@@ -0,0 +1,44 @@
+package grpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestSetStatusAttributes(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "invalid name").WithDetails(
+		&errdetails.ErrorInfo{Reason: "NAME_TOO_SHORT", Domain: "helloworld.example.com", Metadata: map[string]string{"min": "3"}},
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "name", Description: "must have at least 3 characters"},
+		}},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)},
+	)
+	assert.NoError(t, err)
+
+	span := mock.NewSpan()
+	setStatusAttributes(st, span)
+
+	assert.Equal(t, int(codes.InvalidArgument), span.ReadAttribute("rpc.grpc.status_code"))
+	assert.Equal(t, "NAME_TOO_SHORT", span.ReadAttribute("rpc.grpc.status.error_info.reason"))
+	assert.Equal(t, "helloworld.example.com", span.ReadAttribute("rpc.grpc.status.error_info.domain"))
+	assert.Equal(t, "3", span.ReadAttribute("rpc.grpc.status.error_info.metadata.min"))
+	assert.Equal(t, "name", span.ReadAttribute("rpc.grpc.status.bad_request.field_violations[0].field"))
+	assert.Equal(t, "must have at least 3 characters", span.ReadAttribute("rpc.grpc.status.bad_request.field_violations[0].description"))
+	assert.Equal(t, int64(1500), span.ReadAttribute("rpc.grpc.status.retry_info.retry_delay_ms"))
+	assert.Zero(t, span.RemainingAttributes(), "unexpected remaining attribute: %v", span.Attributes)
+}
+
+func TestSetStatusAttributesSuccess(t *testing.T) {
+	span := mock.NewSpan()
+	setStatusAttributes(status.New(codes.OK, ""), span)
+
+	assert.Equal(t, 0, span.ReadAttribute("rpc.grpc.status_code"))
+	assert.Zero(t, span.RemainingAttributes(), "unexpected remaining attribute: %v", span.Attributes)
+}
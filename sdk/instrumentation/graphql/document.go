@@ -0,0 +1,170 @@
+package graphql // import "github.com/hypertrace/goagent/sdk/instrumentation/graphql"
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	errEmptyDocument      = errors.New("graphql: empty document")
+	errNoOperation        = errors.New("graphql: no operation found in document")
+	errOperationNotFound  = errors.New("graphql: operation not found in document")
+	errAmbiguousOperation = errors.New("graphql: operation name required for documents with multiple operations")
+)
+
+// Operation describes the operation executed by a GraphQL request.
+type Operation struct {
+	// Type is either query, mutation or subscription.
+	Type string
+	// Name is the name of the operation, empty for anonymous operations.
+	Name string
+	// Document is the normalized document: comments are removed, whitespace
+	// is collapsed and literal values are replaced so it does not include
+	// any user data.
+	Document string
+}
+
+// SpanName returns the name to use for a span covering the operation,
+// e.g. "query GetUser".
+func (o Operation) SpanName() string {
+	if o.Name == "" {
+		return o.Type
+	}
+	return o.Type + " " + o.Name
+}
+
+// ParseOperation parses the document and returns the operation to be executed.
+// When the document declares more than one operation, operationName is used to
+// pick one as per https://spec.graphql.org/October2021/#GetOperation().
+func ParseOperation(document string, operationName string) (Operation, error) {
+	tokens, err := tokenize(document)
+	if err != nil {
+		return Operation{}, err
+	}
+
+	if len(tokens) == 0 {
+		return Operation{}, errEmptyDocument
+	}
+
+	ops := findOperations(tokens)
+	if len(ops) == 0 {
+		return Operation{}, errNoOperation
+	}
+
+	var op Operation
+	switch {
+	case operationName != "":
+		found := false
+		for _, candidate := range ops {
+			if candidate.Name == operationName {
+				op, found = candidate, true
+				break
+			}
+		}
+		if !found {
+			return Operation{}, errOperationNotFound
+		}
+	case len(ops) == 1:
+		op = ops[0]
+	default:
+		return Operation{}, errAmbiguousOperation
+	}
+
+	op.Document = normalize(tokens)
+	return op, nil
+}
+
+// findOperations returns the operations defined at the top level of the document.
+func findOperations(tokens []token) []Operation {
+	var ops []Operation
+	for i := 0; i < len(tokens); {
+		t := tokens[i]
+		switch {
+		case t.is(punctuator, "{"):
+			// query shorthand, e.g. `{ user { id } }`
+			ops = append(ops, Operation{Type: "query"})
+		case t.kind == name && isOperationType(t.value):
+			op := Operation{Type: t.value}
+			if i+1 < len(tokens) && tokens[i+1].kind == name {
+				op.Name = tokens[i+1].value
+			}
+			ops = append(ops, op)
+		}
+		i = skipDefinition(tokens, i)
+	}
+	return ops
+}
+
+// skipDefinition returns the position right after the definition starting at i,
+// that is after the closing brace of its selection set.
+func skipDefinition(tokens []token, i int) int {
+	// finds the selection set, braces within parentheses belong to
+	// object values in variable defaults or directive arguments.
+	parens := 0
+	for ; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.is(punctuator, "(") {
+			parens++
+		} else if t.is(punctuator, ")") {
+			parens--
+		} else if t.is(punctuator, "{") && parens == 0 {
+			break
+		}
+	}
+
+	braces := 0
+	for ; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.is(punctuator, "{") {
+			braces++
+		} else if t.is(punctuator, "}") {
+			braces--
+			if braces == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+func isOperationType(value string) bool {
+	return value == "query" || value == "mutation" || value == "subscription"
+}
+
+// normalize prints back the tokens separated by a single space, replacing
+// string and number literals.
+func normalize(tokens []token) string {
+	sb := strings.Builder{}
+	for i, t := range tokens {
+		if i > 0 && needsSpace(tokens[i-1], t) {
+			sb.WriteByte(' ')
+		}
+		switch t.kind {
+		case stringValue:
+			sb.WriteString(`""`)
+		case numberValue:
+			sb.WriteString("0")
+		default:
+			sb.WriteString(t.value)
+		}
+	}
+	return sb.String()
+}
+
+func needsSpace(prev, next token) bool {
+	if prev.kind == punctuator {
+		switch prev.value {
+		case "$", "@", "(", "[":
+			return false
+		}
+	}
+
+	if next.kind == punctuator {
+		switch next.value {
+		case ":", "!", "(", ")", "]":
+			return false
+		}
+	}
+
+	return true
+}
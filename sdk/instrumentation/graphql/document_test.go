@@ -0,0 +1,86 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOperation(t *testing.T) {
+	tCases := map[string]struct {
+		document         string
+		operationName    string
+		expectedType     string
+		expectedName     string
+		expectedDocument string
+	}{
+		"shorthand query": {
+			document:         "{ user { id } }",
+			expectedType:     "query",
+			expectedDocument: "{ user { id } }",
+		},
+		"named query with literals and comments": {
+			document: `# fetches the user
+				query GetUser($id: ID!, $limit: Int = 10) {
+					user(id: $id, name: "Jacinto") @include(if: true) {
+						posts(first: $limit, filter: {minScore: 1.5e3}) { title }
+					}
+				}`,
+			expectedType:     "query",
+			expectedName:     "GetUser",
+			expectedDocument: `query GetUser($id: ID! $limit: Int = 0) { user(id: $id name: "") @include(if: true) { posts(first: $limit filter: { minScore: 0 }) { title } } }`,
+		},
+		"operation picked by name": {
+			document: `fragment UserFields on User { id }
+				query A { user { ...UserFields } }
+				mutation B($in: Input = {a: {b: 1}}) { update(in: $in) { """block "string" """ } }`,
+			operationName:    "B",
+			expectedType:     "mutation",
+			expectedName:     "B",
+			expectedDocument: `fragment UserFields on User { id } query A { user { ... UserFields } } mutation B($in: Input = { a: { b: 0 } }) { update(in: $in) { "" } }`,
+		},
+		"subscription": {
+			document:         "subscription OnMessage { message { text } }",
+			expectedType:     "subscription",
+			expectedName:     "OnMessage",
+			expectedDocument: "subscription OnMessage { message { text } }",
+		},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			op, err := ParseOperation(tCase.document, tCase.operationName)
+			assert.NoError(t, err)
+			assert.Equal(t, tCase.expectedType, op.Type)
+			assert.Equal(t, tCase.expectedName, op.Name)
+			assert.Equal(t, tCase.expectedDocument, op.Document)
+		})
+	}
+}
+
+func TestParseOperationFails(t *testing.T) {
+	tCases := map[string]struct {
+		document      string
+		operationName string
+		expectedErr   error
+	}{
+		"empty":                 {document: "  # only a comment", expectedErr: errEmptyDocument},
+		"unterminated string":   {document: `{ user(name: "Jacinto) { id } }`, expectedErr: errUnterminatedString},
+		"no operation":          {document: "fragment F on User { id }", expectedErr: errNoOperation},
+		"ambiguous operation":   {document: "query A { a } query B { b }", expectedErr: errAmbiguousOperation},
+		"operation not found":   {document: "query A { a }", operationName: "B", expectedErr: errOperationNotFound},
+		"not a graphql request": {document: "SELECT * FROM users;", expectedErr: errUnexpectedChar},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseOperation(tCase.document, tCase.operationName)
+			assert.Equal(t, tCase.expectedErr, err)
+		})
+	}
+}
+
+func TestOperationSpanName(t *testing.T) {
+	assert.Equal(t, "query", Operation{Type: "query"}.SpanName())
+	assert.Equal(t, "mutation CreateUser", Operation{Type: "mutation", Name: "CreateUser"}.SpanName())
+}
@@ -0,0 +1,117 @@
+package graphql // import "github.com/hypertrace/goagent/sdk/instrumentation/graphql"
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	errUnterminatedString = errors.New("graphql: unterminated string")
+	errUnexpectedChar     = errors.New("graphql: unexpected character")
+)
+
+type tokenKind int
+
+const (
+	punctuator tokenKind = iota
+	name
+	numberValue
+	stringValue
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+func (t token) is(kind tokenKind, value string) bool {
+	return t.kind == kind && t.value == value
+}
+
+// tokenize splits the document into its lexical tokens as per
+// https://spec.graphql.org/October2021/#sec-Language.Source-Text, ignored
+// tokens like whitespace, commas and comments are dropped.
+func tokenize(document string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(document); {
+		c := document[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(document) && document[i] != '\n' && document[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(document[i:], "\xef\xbb\xbf"):
+			// unicode BOM
+			i += 3
+		case strings.HasPrefix(document[i:], "..."):
+			tokens = append(tokens, token{punctuator, "..."})
+			i += 3
+		case strings.IndexByte("!$&():=@[]{|}", c) >= 0:
+			tokens = append(tokens, token{punctuator, string(c)})
+			i++
+		case isNameStart(c):
+			start := i
+			for i < len(document) && isNameContinue(document[i]) {
+				i++
+			}
+			tokens = append(tokens, token{name, document[start:i]})
+		case c == '-' || isDigit(c):
+			start := i
+			i++
+			for i < len(document) && (isNameContinue(document[i]) || document[i] == '.' ||
+				((document[i] == '-' || document[i] == '+') && (document[i-1] == 'e' || document[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, token{numberValue, document[start:i]})
+		case strings.HasPrefix(document[i:], `"""`):
+			end := strings.Index(document[i+3:], `"""`)
+			for end >= 0 && document[i+3+end-1] == '\\' {
+				// escaped triple quote
+				next := strings.Index(document[i+3+end+3:], `"""`)
+				if next < 0 {
+					end = -1
+					break
+				}
+				end += 3 + next
+			}
+			if end < 0 {
+				return nil, errUnterminatedString
+			}
+			tokens = append(tokens, token{stringValue, document[i : i+3+end+3]})
+			i += 3 + end + 3
+		case c == '"':
+			start := i
+			i++
+			for i < len(document) && document[i] != '"' {
+				if document[i] == '\\' {
+					i++
+				} else if document[i] == '\n' || document[i] == '\r' {
+					return nil, errUnterminatedString
+				}
+				i++
+			}
+			if i >= len(document) {
+				return nil, errUnterminatedString
+			}
+			i++
+			tokens = append(tokens, token{stringValue, document[start:i]})
+		default:
+			return nil, errUnexpectedChar
+		}
+	}
+	return tokens, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameContinue(c byte) bool {
+	return isNameStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,77 @@
+package http // import "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/hypertrace/goagent/sdk"
+)
+
+type attemptsKey struct{}
+
+// attempts counts the round trips done for a logical request, that is the
+// original request plus its redirects and retries.
+type attempts struct {
+	mu             sync.Mutex
+	count          int
+	previousSpanID string
+}
+
+// next registers a new attempt and returns the number of previous attempts
+// along with the span ID of the last one.
+func (a *attempts) next(spanID string) (int, string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	resendCount, previousSpanID := a.count, a.previousSpanID
+	a.count++
+	a.previousSpanID = spanID
+	return resendCount, previousSpanID
+}
+
+// ContextWithAttemptTracking returns a context that allows the transport to
+// tell apart the attempts done for the same logical request. Retry middlewares
+// should call it once before the first attempt and reuse the returned context
+// in every attempt. Redirects followed by http.Client are tracked regardless.
+func ContextWithAttemptTracking(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(attemptsKey{}).(*attempts); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, attemptsKey{}, &attempts{})
+}
+
+// setAttemptAttributes sets `http.resend_count` in every attempt but the first
+// one and points to the span of the previous attempt. Every attempt
+// gets its own span as the transport is wrapped by an instrumented transport.
+func setAttemptAttributes(req *http.Request, span sdk.Span, spanFromContext sdk.SpanFromContext) {
+	if a, ok := req.Context().Value(attemptsKey{}).(*attempts); ok {
+		resendCount, previousSpanID := a.next(span.GetSpanId())
+		if resendCount > 0 {
+			span.SetAttribute("http.resend_count", resendCount)
+			span.SetAttribute("http.previous_attempt.span_id", previousSpanID)
+		}
+	} else if redirects := countRedirects(req); redirects > 0 {
+		span.SetAttribute("http.resend_count", redirects)
+	}
+
+	// req.Response is the redirect response which caused this request to be created
+	// by the http.Client, its request holds the context for the previous attempt.
+	if req.Response != nil && req.Response.Request != nil {
+		span.SetAttribute("http.redirect.status_code", req.Response.StatusCode)
+		span.SetAttribute("http.redirect.from_url", req.Response.Request.URL.String())
+		previousSpan := spanFromContext(req.Response.Request.Context())
+		if !previousSpan.IsNoop() {
+			span.SetAttribute("http.redirect.from_span_id", previousSpan.GetSpanId())
+		}
+	}
+}
+
+// countRedirects returns the number of redirects followed before this request.
+func countRedirects(req *http.Request) int {
+	count := 0
+	for res := req.Response; res != nil && res.Request != nil; res = res.Request.Response {
+		count++
+	}
+	return count
+}
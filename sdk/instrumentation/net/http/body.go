@@ -3,20 +3,31 @@ package http // import "github.com/hypertrace/goagent/sdk/instrumentation/net/ht
 import (
 	"fmt"
 
+	config "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/sdk"
 	"github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
 )
 
 // setTruncatedBodyAttribute truncates the body and sets the HTTP body as a span attribute.
 // When body is being truncated, we also add a second attribute suffixed by `.truncated` to
-// make it clear to the user, body has been modified. Also if base64Encode == true, we base64
-// encode the body and append the suffix ".base64" to the attribute name. We base64 encode in
-// in case there are non utf8 bytes in the body eg. for binary files in multipart/form-data
-// content-type.
-func setTruncatedBodyAttribute(_type string, body []byte, bodyMaxSize int, span sdk.Span, base64Encode bool) {
-	if base64Encode {
-		bodyattribute.SetTruncatedEncodedBodyAttribute(fmt.Sprintf("http.%s.body", _type), body, bodyMaxSize, span)
-	} else {
-		bodyattribute.SetTruncatedBodyAttribute(fmt.Sprintf("http.%s.body", _type), body, bodyMaxSize, span)
-	}
+// make it clear to the user, body has been modified. The body is encoded according to the
+// policy for its content type, by default binary bodies, as sniffed from their content, and
+// multipart/form-data ones are base64 encoded and the suffix ".base64" is appended to the
+// attribute name as non utf8 bytes would break the exporters.
+func setTruncatedBodyAttribute(_type string, body []byte, bodyMaxSize int, span sdk.Span, contentType string,
+	policy bodyattribute.Policy) {
+	bodyattribute.SetBodyAttributeWithPolicy(fmt.Sprintf("http.%s.body", _type), contentType, body, bodyMaxSize, policy, span)
+}
+
+// decodedBody returns the body to be recorded and its content type. The content encoding,
+// e.g. gzip, is decoded first and then the body is decoded by the decoder for its media
+// type if any.
+func decodedBody(h HeaderAccessor, body []byte, path string, response bool, cfg *config.DataCapture,
+	decoders bodyattribute.Decoders) ([]byte, string) {
+	return decoders.Decode(bodyattribute.Body{
+		ContentType: contentTypeOf(h),
+		Path:        path,
+		Response:    response,
+		Data:        decodeBody(h, body, maxDecodedBodySize(cfg)),
+	})
 }
@@ -10,7 +10,7 @@ import (
 
 func TestBodyTruncationSuccess(t *testing.T) {
 	s := mock.NewSpan()
-	setTruncatedBodyAttribute("request", []byte("text"), 2, s, false)
+	setTruncatedBodyAttribute("request", []byte("text"), 2, s, "text/plain", nil)
 	assert.Equal(t, "te", s.ReadAttribute("http.request.body"))
 	assert.True(t, (s.ReadAttribute("http.request.body.truncated")).(bool))
 	assert.Zero(t, s.RemainingAttributes())
@@ -18,14 +18,14 @@ func TestBodyTruncationSuccess(t *testing.T) {
 
 func TestBodyTruncationIsSkipped(t *testing.T) {
 	s := mock.NewSpan()
-	setTruncatedBodyAttribute("request", []byte("text"), 7, s, false)
+	setTruncatedBodyAttribute("request", []byte("text"), 7, s, "text/plain", nil)
 	assert.Equal(t, "text", s.ReadAttribute("http.request.body"))
 	assert.Zero(t, s.RemainingAttributes())
 }
 
 func TestSetTruncatedEncodedBodyAttribute(t *testing.T) {
 	s := mock.NewSpan()
-	setTruncatedBodyAttribute("request", []byte("text"), 2, s, true)
+	setTruncatedBodyAttribute("request", []byte("text"), 2, s, "multipart/form-data; boundary=xyz", nil)
 	assert.Equal(t, base64.RawStdEncoding.EncodeToString([]byte("te")), s.ReadAttribute("http.request.body.base64"))
 	assert.True(t, (s.ReadAttribute("http.request.body.truncated")).(bool))
 	assert.Zero(t, s.RemainingAttributes())
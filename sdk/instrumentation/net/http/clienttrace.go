@@ -0,0 +1,108 @@
+package http // import "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/hypertrace/goagent/sdk"
+)
+
+const connectionTimingsEventName = "http.client.connection"
+
+// connectionTimings collects the connection level timings of a round trip.
+// httptrace hooks might be called from different goroutines (e.g. dialing)
+// hence the access is guarded.
+type connectionTimings struct {
+	mu sync.Mutex
+
+	start             time.Time
+	dnsStart          time.Time
+	dnsDone           time.Time
+	connectStart      time.Time
+	connectDone       time.Time
+	tlsStart          time.Time
+	tlsDone           time.Time
+	firstResponseByte time.Time
+	reused            bool
+	gotConn           bool
+}
+
+func (t *connectionTimings) record(f func(t *connectionTimings)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f(t)
+}
+
+// withConnectionTimings returns a request whose context records connection timings.
+// Existing client traces in the context are still invoked.
+func withConnectionTimings(req *http.Request) (*http.Request, *connectionTimings) {
+	t := &connectionTimings{start: time.Now()}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.record(func(t *connectionTimings) { t.gotConn, t.reused = true, info.Reused })
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.record(func(t *connectionTimings) { t.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.record(func(t *connectionTimings) { t.dnsDone = time.Now() })
+		},
+		ConnectStart: func(_, _ string) {
+			t.record(func(t *connectionTimings) {
+				// happy eyeballs might dial more than once, we keep the first one.
+				if t.connectStart.IsZero() {
+					t.connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				t.record(func(t *connectionTimings) { t.connectDone = time.Now() })
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.record(func(t *connectionTimings) { t.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				t.record(func(t *connectionTimings) { t.tlsDone = time.Now() })
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.record(func(t *connectionTimings) { t.firstResponseByte = time.Now() })
+		},
+	}
+
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), t
+}
+
+// addEvent adds an event to the span including the timings in milliseconds
+// of the phases that happened during the round trip.
+func (t *connectionTimings) addEvent(span sdk.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.gotConn {
+		return
+	}
+
+	attrs := map[string]interface{}{
+		"http.connection.reused": t.reused,
+	}
+	setDuration(attrs, "http.dns.duration_ms", t.dnsStart, t.dnsDone)
+	setDuration(attrs, "http.connect.duration_ms", t.connectStart, t.connectDone)
+	setDuration(attrs, "http.tls_handshake.duration_ms", t.tlsStart, t.tlsDone)
+	setDuration(attrs, "http.time_to_first_byte_ms", t.start, t.firstResponseByte)
+
+	span.AddEvent(connectionTimingsEventName, t.start, attrs)
+}
+
+func setDuration(attrs map[string]interface{}, key string, start, end time.Time) {
+	if start.IsZero() || end.IsZero() {
+		return
+	}
+	attrs[key] = float64(end.Sub(start)) / float64(time.Millisecond)
+}
@@ -0,0 +1,113 @@
+package http // import "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/klauspost/compress/zstd"
+)
+
+const contentEncodingHeaderKey string = "Content-Encoding"
+
+// decodeBody decodes the captured body according to the Content-Encoding header values
+// so the recorded body is readable. The decoded body is limited to maxSize bytes as
+// compressed bodies can expand enormously. Bodies that are only a prefix of the encoded
+// stream are decoded as far as possible. The body is returned as is when it isn't encoded
+// or when the encoding is unknown or broken.
+func decodeBody(h HeaderAccessor, body []byte, maxSize int) []byte {
+	var encodings []string
+	for _, value := range h.Lookup(contentEncodingHeaderKey) {
+		for _, encoding := range strings.Split(value, ",") {
+			encoding = strings.ToLower(strings.TrimSpace(encoding))
+			if encoding != "" && encoding != "identity" {
+				encodings = append(encodings, encoding)
+			}
+		}
+	}
+
+	if len(encodings) == 0 || maxSize <= 0 {
+		return body
+	}
+
+	decoded := body
+	// encodings are listed in the order they were applied hence they are
+	// undone in the inverse order.
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var ok bool
+		decoded, ok = decode(encodings[i], decoded, maxSize)
+		if !ok {
+			return body
+		}
+	}
+
+	return decoded
+}
+
+// decode decodes the body encoded with the given encoding up to maxSize bytes.
+func decode(encoding string, body []byte, maxSize int) ([]byte, bool) {
+	var (
+		r   io.Reader
+		err error
+	)
+
+	switch encoding {
+	case "gzip", "x-gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		// deflate is meant to be zlib wrapped but some servers send raw
+		// deflate streams instead.
+		r, err = zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			r, err = flate.NewReader(bytes.NewReader(body)), nil
+		}
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		var zr *zstd.Decoder
+		zr, err = zstd.NewReader(bytes.NewReader(body), zstd.WithDecoderConcurrency(1))
+		if err == nil {
+			defer zr.Close()
+			r = zr
+		}
+	default:
+		return nil, false
+	}
+
+	if err != nil {
+		return nil, false
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(r, int64(maxSize)))
+	if err != nil && !isTruncatedStreamError(err) {
+		return nil, false
+	}
+
+	if len(decoded) == 0 {
+		return nil, false
+	}
+
+	return decoded, true
+}
+
+// isTruncatedStreamError tells whether the error was caused by a body cut by
+// the capture limit, in such case the data decoded so far is still valid.
+func isTruncatedStreamError(err error) bool {
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// maxDecodedBodySize returns the max number of decoded bytes processed for a body, it
+// is never less than the number of bytes recorded.
+func maxDecodedBodySize(cfg *config.DataCapture) int {
+	bodyMaxProcessingSize := int(cfg.GetBodyMaxProcessingSizeBytes().GetValue())
+	if bodyMaxSize := int(cfg.GetBodyMaxSizeBytes().GetValue()); bodyMaxSize > bodyMaxProcessingSize {
+		return bodyMaxSize
+	}
+	return bodyMaxProcessingSize
+}
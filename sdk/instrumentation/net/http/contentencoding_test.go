@@ -0,0 +1,144 @@
+package http
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+const plainBody = `{"name":"Jacinto","last_name":"Dos Santos","address":"Rua Augusta 1, Lisboa"}`
+
+func encode(t *testing.T, encoding string, body []byte) []byte {
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(buf)
+	case "deflate":
+		w = zlib.NewWriter(buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(buf)
+	case "zstd":
+		var err error
+		w, err = zstd.NewWriter(buf)
+		assert.NoError(t, err)
+	}
+	_, err := w.Write(body)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// prefix returns the first half of the body as if the rest was cut by the capture limit.
+func prefix(body []byte) []byte {
+	return body[:len(body)/2]
+}
+
+func TestDecodeBody(t *testing.T) {
+	tCases := map[string]struct {
+		contentEncoding []string
+		body            []byte
+		maxSize         int
+		expectedBody    string
+	}{
+		"no encoding": {
+			body:         []byte(plainBody),
+			maxSize:      1000,
+			expectedBody: plainBody,
+		},
+		"identity": {
+			contentEncoding: []string{"identity"},
+			body:            []byte(plainBody),
+			maxSize:         1000,
+			expectedBody:    plainBody,
+		},
+		"gzip": {
+			contentEncoding: []string{"gzip"},
+			body:            encode(t, "gzip", []byte(plainBody)),
+			maxSize:         1000,
+			expectedBody:    plainBody,
+		},
+		"deflate": {
+			contentEncoding: []string{"Deflate"},
+			body:            encode(t, "deflate", []byte(plainBody)),
+			maxSize:         1000,
+			expectedBody:    plainBody,
+		},
+		"raw deflate": {
+			contentEncoding: []string{"deflate"},
+			body:            encode(t, "raw-deflate", []byte(plainBody)),
+			maxSize:         1000,
+			expectedBody:    plainBody,
+		},
+		"brotli": {
+			contentEncoding: []string{"br"},
+			body:            encode(t, "br", []byte(plainBody)),
+			maxSize:         1000,
+			expectedBody:    plainBody,
+		},
+		"zstd": {
+			contentEncoding: []string{"zstd"},
+			body:            encode(t, "zstd", []byte(plainBody)),
+			maxSize:         1000,
+			expectedBody:    plainBody,
+		},
+		"multiple encodings are undone in the inverse order": {
+			contentEncoding: []string{"gzip, br"},
+			body:            encode(t, "br", encode(t, "gzip", []byte(plainBody))),
+			maxSize:         1000,
+			expectedBody:    plainBody,
+		},
+		"decoded body is limited": {
+			contentEncoding: []string{"gzip"},
+			body:            encode(t, "gzip", []byte(plainBody)),
+			maxSize:         10,
+			expectedBody:    plainBody[:10],
+		},
+		"captured prefix is decoded": {
+			contentEncoding: []string{"gzip"},
+			body:            prefix(encode(t, "gzip", []byte(strings.Repeat(plainBody, 100)))),
+			maxSize:         100000,
+		},
+		"unknown encoding": {
+			contentEncoding: []string{"compress"},
+			body:            []byte("\x1f\x9d\x90"),
+			maxSize:         1000,
+			expectedBody:    "\x1f\x9d\x90",
+		},
+		"broken body": {
+			contentEncoding: []string{"gzip"},
+			body:            []byte(plainBody),
+			maxSize:         1000,
+			expectedBody:    plainBody,
+		},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			h := http.Header{}
+			for _, value := range tCase.contentEncoding {
+				h.Add("Content-Encoding", value)
+			}
+
+			decoded := decodeBody(NewHeaderMapAccessor(h), tCase.body, tCase.maxSize)
+			if tCase.expectedBody == "" {
+				// only a prefix of the body can be decoded
+				assert.NotEmpty(t, decoded)
+				assert.True(t, strings.HasPrefix(strings.Repeat(plainBody, 100), string(decoded)))
+				return
+			}
+			assert.Equal(t, tCase.expectedBody, string(decoded))
+		})
+	}
+}
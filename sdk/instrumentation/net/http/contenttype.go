@@ -57,3 +57,15 @@ func HasMultiPartFormDataContentTypeHeader(h HeaderAccessor) bool {
 	}
 	return false
 }
+
+// contentTypeOf returns the value of the Content-Type header declaring the media type,
+// empty if none.
+func contentTypeOf(h HeaderAccessor) string {
+	for _, contentTypeValue := range h.Lookup(contentTypeHeaderKey) {
+		// values may be added separately, e.g. "application/json" and "charset=utf-8"
+		if strings.Contains(contentTypeValue, "/") {
+			return contentTypeValue
+		}
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package http // import "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/instrumentation/graphql"
+)
+
+// graphQLRequest is a GraphQL over HTTP request as per
+// https://graphql.github.io/graphql-over-http/draft/#sec-Request-Parameters
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// spanNamer is implemented by spans that can be renamed after being started.
+type spanNamer interface {
+	SetName(name string)
+}
+
+// isGraphQLContentType returns true for the content types a GraphQL request body can have.
+func isGraphQLContentType(h HeaderAccessor) bool {
+	for _, contentTypeValue := range h.Lookup(contentTypeHeaderKey) {
+		contentTypeValue = strings.ToLower(contentTypeValue)
+		if strings.Contains(contentTypeValue, "application/json") ||
+			strings.Contains(contentTypeValue, "application/graphql") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseGraphQLRequest returns the GraphQL request carried by either the query
+// parameters (GET) or the body (POST).
+func parseGraphQLRequest(r *http.Request, h HeaderAccessor, body []byte) (graphQLRequest, bool) {
+	var req graphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		req.Query = params.Get("query")
+		req.OperationName = params.Get("operationName")
+		if variables := params.Get("variables"); variables != "" {
+			_ = json.Unmarshal([]byte(variables), &req.Variables)
+		}
+	case http.MethodPost:
+		if len(body) == 0 {
+			return req, false
+		}
+		for _, contentTypeValue := range h.Lookup(contentTypeHeaderKey) {
+			if strings.Contains(strings.ToLower(contentTypeValue), "application/graphql") &&
+				!strings.Contains(strings.ToLower(contentTypeValue), "application/graphql-response") {
+				req.Query = string(body)
+				return req, true
+			}
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return req, false
+		}
+	}
+
+	return req, req.Query != ""
+}
+
+// setGraphQLAttributes sets the operation attributes, only the names of the variables
+// are recorded as their values are only captured along with the request body.
+func setGraphQLAttributes(req graphQLRequest, span sdk.Span, renameSpan bool) bool {
+	op, err := graphql.ParseOperation(req.Query, req.OperationName)
+	if err != nil {
+		return false
+	}
+
+	span.SetAttribute("graphql.operation.type", op.Type)
+	if op.Name != "" {
+		span.SetAttribute("graphql.operation.name", op.Name)
+	}
+	span.SetAttribute("graphql.document", op.Document)
+
+	if len(req.Variables) > 0 {
+		names := make([]string, 0, len(req.Variables))
+		for name := range req.Variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		span.SetAttribute("graphql.variables", names)
+	}
+
+	if renameSpan {
+		if namer, ok := span.(spanNamer); ok {
+			namer.SetName(op.SpanName())
+		}
+	}
+
+	return true
+}
@@ -2,13 +2,16 @@ package http // import "github.com/hypertrace/goagent/sdk/instrumentation/net/ht
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"net/http"
+	"runtime/debug"
 	"strings"
+	"time"
 
-	config "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/sdk"
 	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
 	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
 	"github.com/hypertrace/goagent/sdk/internal/container"
 )
@@ -17,14 +20,39 @@ type handler struct {
 	delegate                 http.Handler
 	defaultAttributes        map[string]string
 	spanFromContextRetriever sdk.SpanFromContext
-	dataCaptureConfig        *config.DataCapture
 	filter                   filter.Filter
 	mh                       sdk.HttpOperationMetricsHandler
+	streamingEvents          bool
+	maxStreamingEvents       int
+	graphQL                  bool
+	graphQLSpanName          bool
+	bodyPolicy               bodyattribute.Policy
+	bodyDecoders             bodyattribute.Decoders
 }
 
-// Options for HTTP handler instrumentation
+// Options for HTTP handler instrumentation, only the Filter, the BodyPolicy and the
+// BodyDecoders apply to the transport instrumentation.
 type Options struct {
 	Filter filter.Filter
+	// StreamingEvents records streamed responses as span events, one per
+	// Server-Sent Event or one per flushed chunk for any other response.
+	StreamingEvents bool
+	// MaxStreamingEvents caps the number of events recorded per response,
+	// defaults to 100.
+	MaxStreamingEvents int
+	// GraphQL detects GraphQL requests and records the operation name, type
+	// and normalized document.
+	GraphQL bool
+	// GraphQLSpanName renames the span after the GraphQL operation, e.g.
+	// "query GetUser".
+	GraphQLSpanName bool
+	// BodyPolicy sets how the bodies are recorded per media type, e.g. only
+	// the size of "image/*" bodies.
+	BodyPolicy bodyattribute.Policy
+	// BodyDecoders turns the bodies of the given media types into the form that
+	// gets recorded, e.g. protobuf into JSON. Bodies with a decoder are captured
+	// even if their content type isn't allowed.
+	BodyDecoders bodyattribute.Decoders
 }
 
 // WrapHandler wraps an uninstrumented handler (e.g. a handleFunc) and returns a new one
@@ -43,13 +71,31 @@ func WrapHandler(delegate http.Handler, spanFromContext sdk.SpanFromContext, opt
 		f = options.Filter
 	}
 
-	return &handler{delegate, defaultAttributes, spanFromContext, internalconfig.GetConfig().GetDataCapture(), f, mh}
+	h := &handler{
+		delegate:                 delegate,
+		defaultAttributes:        defaultAttributes,
+		spanFromContextRetriever: spanFromContext,
+		filter:                   f,
+		mh:                       mh,
+	}
+	if options != nil {
+		h.streamingEvents = options.StreamingEvents
+		h.maxStreamingEvents = options.MaxStreamingEvents
+		h.graphQL = options.GraphQL
+		h.graphQLSpanName = options.GraphQLSpanName
+		h.bodyPolicy = options.BodyPolicy
+		h.bodyDecoders = options.BodyDecoders
+	}
+
+	return h
 }
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	span := h.spanFromContextRetriever(ctx)
 	headersAccessor := NewHeaderMapAccessor(r.Header)
+	// the config is read on every request as it can be updated at runtime.
+	dataCaptureConfig := internalconfig.GetConfig().GetDataCapture()
 
 	h.mh.AddToRequestCount(1, r)
 
@@ -76,32 +122,61 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	host := r.Host
 	span.SetAttribute("http.request.header.host", host)
 
+	upgradeProtocol, isUpgrade := UpgradeProtocol(headersAccessor)
+	if isUpgrade {
+		span.SetAttribute("http.upgrade", upgradeProtocol)
+	}
+
 	// Sets an attribute per each request header.
-	if h.dataCaptureConfig.HttpHeaders.Request.Value {
+	if dataCaptureConfig.HttpHeaders.Request.Value {
 		SetAttributesFromHeaders("request", headersAccessor, span)
 	}
 
 	// nil check for body is important as this block turns the body into another
 	// object that isn't nil and that will leverage the "Observer effect".
-	if r.Body != nil && h.dataCaptureConfig.HttpBody.Request.Value && ShouldRecordBodyOfContentType(headersAccessor) {
-		body, err := io.ReadAll(r.Body)
+	var body []byte
+	if r.Body != nil && !isUpgrade && dataCaptureConfig.HttpBody.Request.Value && h.shouldRecordBody(headersAccessor) {
+		var err error
+		body, err = io.ReadAll(r.Body)
 		if err != nil {
 			return
 		}
 		defer r.Body.Close()
 
-		isMultipartFormDataBody := HasMultiPartFormDataContentTypeHeader(headersAccessor)
-
 		// Only records the body if it is not empty and the content type
 		// header is not streamable
 		if len(body) > 0 {
-			setTruncatedBodyAttribute("request", body, int(h.dataCaptureConfig.BodyMaxSizeBytes.Value), span,
-				isMultipartFormDataBody)
+			// only the recorded copy is decoded, the delegate gets the original body.
+			recordedBody, contentType := decodedBody(headersAccessor, body, r.URL.Path, false, dataCaptureConfig, h.bodyDecoders)
+			setTruncatedBodyAttribute("request", recordedBody, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span,
+				contentType, h.bodyPolicy)
 		}
 
 		r.Body = io.NopCloser(bytes.NewBuffer(body))
 	}
 
+	if h.graphQL {
+		gqlBody := body
+		// the body is needed to find out the GraphQL operation even if it isn't captured,
+		// only its first bytes are read so large bodies aren't buffered.
+		if body == nil && r.Body != nil && r.Method == http.MethodPost && isGraphQLContentType(headersAccessor) {
+			var truncated bool
+			var err error
+			gqlBody, truncated, err = peekBody(r, int64(dataCaptureConfig.BodyMaxProcessingSizeBytes.Value))
+			if err != nil {
+				return
+			}
+			if truncated {
+				// the operation can't be told from part of the body.
+				gqlBody = nil
+			}
+		}
+
+		if gqlReq, ok := parseGraphQLRequest(r, headersAccessor, gqlBody); ok {
+			setGraphQLAttributes(gqlReq, span, h.graphQLSpanName)
+		}
+	}
+
 	// single evaluation call to filter after capturing the configured parameters
 	filterResult := h.filter.Evaluate(span)
 	if filterResult.Block {
@@ -115,25 +190,90 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// create http.ResponseWriter interceptor for tracking status code
-	wi := &rwInterceptor{w: w, statusCode: 200}
+	wi := &rwInterceptor{w: w, statusCode: 200, captureBody: dataCaptureConfig.HttpBody.Response.Value}
+	if h.streamingEvents {
+		wi.stream = newStreamRecorder(span, h.maxStreamingEvents, dataCaptureConfig.HttpBody.Response.Value,
+			int(dataCaptureConfig.BodyMaxSizeBytes.Value))
+	}
 
 	// tag found status code on exit
 	defer func() {
+		if wi.hijacked {
+			// the response is written by the handler straight into the connection
+			// hence there is nothing else we can tell about it.
+			if isUpgrade {
+				span.SetAttribute("http.response.status_code", http.StatusSwitchingProtocols)
+			}
+			return
+		}
+
+		statusCode := wi.getStatusCode()
+		span.SetAttribute("http.response.status_code", statusCode)
+		if statusCode >= 500 {
+			span.SetStatus(sdk.StatusCodeError, http.StatusText(statusCode))
+		}
+
+		if wi.streaming {
+			span.SetAttribute("http.response.streaming", true)
+		}
+		if wi.stream != nil {
+			if wi.flushed {
+				// records the last chunk written after the last flush
+				wi.stream.flush()
+			}
+			if dropped := wi.stream.events - wi.stream.maxEvents; dropped > 0 {
+				span.SetAttribute("http.response.streaming.dropped_events", dropped)
+			}
+		}
+
 		responseHeadersAccessor := NewHeaderMapAccessor(wi.Header())
-		if h.dataCaptureConfig.HttpBody.Response.Value &&
+		if dataCaptureConfig.HttpBody.Response.Value &&
 			len(wi.body) > 0 &&
-			ShouldRecordBodyOfContentType(responseHeadersAccessor) {
-			setTruncatedBodyAttribute("response", wi.body, int(h.dataCaptureConfig.BodyMaxSizeBytes.Value), span,
-				HasMultiPartFormDataContentTypeHeader(responseHeadersAccessor))
+			h.shouldRecordBody(responseHeadersAccessor) {
+			recordedBody, contentType := decodedBody(responseHeadersAccessor, wi.body, r.URL.Path, true, dataCaptureConfig, h.bodyDecoders)
+			setTruncatedBodyAttribute("response", recordedBody, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span,
+				contentType, h.bodyPolicy)
 		}
+		span.SetAttribute("http.response.body.size", wi.size)
 
-		if h.dataCaptureConfig.HttpHeaders.Response.Value {
+		if dataCaptureConfig.HttpHeaders.Response.Value {
 			// Sets an attribute per each response header.
 			SetAttributesFromHeaders("response", responseHeadersAccessor, span)
 		}
 	}()
 
-	h.delegate.ServeHTTP(wi, r)
+	// records the panic and lets it continue so the server handles it as usual.
+	defer func() {
+		if rec := recover(); rec != nil {
+			if rec != http.ErrAbortHandler {
+				recordPanic(span, rec, debug.Stack())
+				if !wi.wroteHeader {
+					wi.statusCode = http.StatusInternalServerError
+				}
+			}
+			panic(rec)
+		}
+	}()
+
+	h.delegate.ServeHTTP(wi.wrap(), r)
+}
+
+// recordPanic records the recovered value as an exception event along
+// with the stack trace.
+func recordPanic(span sdk.Span, rec interface{}, stack []byte) {
+	err, ok := rec.(error)
+	if !ok {
+		err = fmt.Errorf("%v", rec)
+	}
+
+	span.SetError(err)
+	span.SetStatus(sdk.StatusCodeError, "panic: "+err.Error())
+	span.AddEvent("exception", time.Now(), map[string]interface{}{
+		"exception.type":       fmt.Sprintf("%T", rec),
+		"exception.message":    err.Error(),
+		"exception.stacktrace": string(stack),
+		"exception.escaped":    true,
+	})
 }
 
 // Copied from Zipkin Go
@@ -141,9 +281,16 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 //
 // rwInterceptor intercepts the ResponseWriter so it can track returned status code.
 type rwInterceptor struct {
-	w          http.ResponseWriter
-	body       []byte
-	statusCode int
+	w           http.ResponseWriter
+	body        []byte
+	captureBody bool
+	size        int64
+	statusCode  int
+	wroteHeader bool
+	hijacked    bool
+	streaming   bool
+	flushed     bool
+	stream      *streamRecorder
 }
 
 func (r *rwInterceptor) Header() http.Header {
@@ -151,16 +298,81 @@ func (r *rwInterceptor) Header() http.Header {
 }
 
 func (r *rwInterceptor) Write(b []byte) (n int, err error) {
+	r.onWriteHeader()
 	n, err = r.w.Write(b)
-	r.body = append(r.body, b...)
+	r.size += int64(n)
+	if r.captureBody {
+		r.body = append(r.body, b...)
+	}
+	if r.stream != nil {
+		r.stream.write(b[:n])
+	}
 	return
 }
 
 func (r *rwInterceptor) WriteHeader(i int) {
-	r.statusCode = i
+	// informational responses (1xx) other than switching protocols can be
+	// sent multiple times before the final status code.
+	if !r.wroteHeader && (i >= 200 || i == http.StatusSwitchingProtocols) {
+		r.statusCode = i
+		r.onWriteHeader()
+	}
 	r.w.WriteHeader(i)
 }
 
+// onWriteHeader inspects the response headers once they are final to find
+// out whether the response is streamed.
+func (r *rwInterceptor) onWriteHeader() {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+
+	headers := NewHeaderMapAccessor(r.w.Header())
+	if IsStreamingContentType(headers) {
+		// streamed responses are long lived hence we don't buffer them
+		r.streaming = true
+		r.captureBody = false
+		r.body = nil
+	}
+
+	if r.stream != nil {
+		r.stream.isEventStream = isEventStream(headers)
+	}
+}
+
+func (r *rwInterceptor) onFlush() {
+	r.onWriteHeader()
+	r.flushed = true
+	// a flushed response is sent in chunks whatever its content type, it can be
+	// long lived too hence we stop buffering it.
+	r.streaming = true
+	r.captureBody = false
+	r.body = nil
+	if r.stream != nil {
+		r.stream.flush()
+	}
+}
+
+// readerFrom keeps the io.ReaderFrom optimization of the underlying writer
+// while tracking the size. When the body is captured or streamed the content
+// is copied through Write instead.
+type readerFrom struct {
+	r  *rwInterceptor
+	rf io.ReaderFrom
+}
+
+func (rf *readerFrom) ReadFrom(src io.Reader) (int64, error) {
+	rf.r.onWriteHeader()
+	if rf.r.captureBody || rf.r.stream != nil {
+		return io.Copy(struct{ io.Writer }{rf.r}, src)
+	}
+
+	n, err := rf.rf.ReadFrom(src)
+	rf.r.size += n
+	return n, err
+}
+
 func (r *rwInterceptor) getStatusCode() int {
 	return r.statusCode
 }
@@ -174,6 +386,18 @@ func (r *rwInterceptor) wrap() http.ResponseWriter {
 		rf, i4 = r.w.(io.ReaderFrom)
 	)
 
+	if i0 {
+		hj = &hijacker{r, hj}
+	}
+
+	if i3 {
+		fl = &flusher{r, fl}
+	}
+
+	if i4 {
+		rf = &readerFrom{r, rf}
+	}
+
 	switch {
 	case !i0 && !i1 && !i2 && !i3 && !i4:
 		return struct {
@@ -389,3 +613,30 @@ func (r *rwInterceptor) wrap() http.ResponseWriter {
 		}{r}
 	}
 }
+
+// shouldRecordBody tells whether the body is meant to be recorded based on its content
+// type, either allowed by the config or with a decoder.
+func (h *handler) shouldRecordBody(headersAccessor HeaderAccessor) bool {
+	return ShouldRecordBodyOfContentType(headersAccessor) || h.bodyDecoders.Supports(contentTypeOf(headersAccessor))
+}
+
+// peekedBody is a request body whose first bytes were already read.
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// peekBody reads up to limit bytes of the request body, telling whether the body is longer.
+// The request body is replaced so the delegate still reads it whole.
+func peekBody(r *http.Request, limit int64) ([]byte, bool, error) {
+	prefix, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	r.Body = peekedBody{Reader: io.MultiReader(bytes.NewReader(prefix), r.Body), Closer: r.Body}
+	if int64(len(prefix)) > limit {
+		return prefix[:limit], true, nil
+	}
+	return prefix, false, nil
+}
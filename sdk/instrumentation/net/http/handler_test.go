@@ -1,8 +1,10 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -11,9 +13,12 @@ import (
 	config "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/sdk"
 	"github.com/hypertrace/goagent/sdk/filter/result"
+	"github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
 	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
 	"github.com/hypertrace/goagent/sdk/internal/mock"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 // A no-op metrics handler
@@ -24,19 +29,27 @@ func (mh *metricsHandler) AddToRequestCount(int64, *http.Request) {
 
 }
 
-var emptyTestConfig = &config.DataCapture{
-	HttpHeaders: &config.Message{
-		Request:  config.Bool(false),
-		Response: config.Bool(false),
-	},
-	HttpBody: &config.Message{
-		Request:  config.Bool(false),
-		Response: config.Bool(false),
-	},
-	BodyMaxSizeBytes:           config.Int32(1000),
-	BodyMaxProcessingSizeBytes: config.Int32(1000),
+// emptyTestConfig returns a data capture config capturing nothing, tests change it
+// through the live config.
+func emptyTestConfig() *config.DataCapture {
+	return &config.DataCapture{
+		HttpHeaders: &config.Message{
+			Request:  config.Bool(false),
+			Response: config.Bool(false),
+		},
+		HttpBody: &config.Message{
+			Request:  config.Bool(false),
+			Response: config.Bool(false),
+		},
+		BodyMaxSizeBytes:           config.Int32(1000),
+		BodyMaxProcessingSizeBytes: config.Int32(1000),
+		AllowedContentTypes:        testAllowedContentTypes,
+	}
 }
 
+// testAllowedContentTypes are the default allowed content types.
+var testAllowedContentTypes = []*wrapperspb.StringValue{config.String("json"), config.String("x-www-form-urlencoded")}
+
 var _ http.Handler = &mockHandler{}
 
 type mockHandler struct {
@@ -59,7 +72,7 @@ func TestServerRequestWithNilBodyIsntChanged(t *testing.T) {
 	})
 
 	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, &metricsHandler{}).(*handler)
-	wh.dataCaptureConfig = emptyTestConfig
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
 
 	ih := &mockHandler{baseHandler: wh}
 
@@ -83,7 +96,7 @@ func TestServerRequestIsSuccessfullyTraced(t *testing.T) {
 	})
 
 	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{"foo": "bar"}, &metricsHandler{}).(*handler)
-	wh.dataCaptureConfig = emptyTestConfig
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
 	ih := &mockHandler{baseHandler: wh}
 
 	r, _ := http.NewRequest("GET", "http://traceable.ai/foo?user_id=1", strings.NewReader("test_request_body"))
@@ -99,11 +112,122 @@ func TestServerRequestIsSuccessfullyTraced(t *testing.T) {
 	assert.Equal(t, "http://traceable.ai/foo?user_id=1", span.ReadAttribute("http.url").(string))
 	assert.Equal(t, "traceable.ai", span.ReadAttribute("http.request.header.host"))
 	assert.Equal(t, "bar", span.ReadAttribute("foo"))
+	assert.Equal(t, 202, span.ReadAttribute("http.response.status_code"))
+	assert.Equal(t, int64(18), span.ReadAttribute("http.response.body.size"))
+	assert.Equal(t, sdk.StatusCodeUnset, span.Status.Code)
 
 	_ = span.ReadAttribute("container_id") // needed in containarized envs
 	assert.Zero(t, span.RemainingAttributes(), "unexpected remaining attribute: %v", span.Attributes)
 }
 
+func TestServerErrorStatusCodeIsRecorded(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusEarlyHints)
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/foo", nil)
+	ih.ServeHTTP(httptest.NewRecorder(), r)
+
+	span := ih.spans[0]
+	assert.Equal(t, 503, span.ReadAttribute("http.response.status_code"))
+	assert.Equal(t, int64(0), span.ReadAttribute("http.response.body.size"))
+	assert.Equal(t, sdk.StatusCodeError, span.Status.Code)
+	assert.Equal(t, "Service Unavailable", span.Status.Message)
+}
+
+func TestServerPanicIsRecorded(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic("something went wrong")
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/foo", nil)
+	assert.PanicsWithValue(t, "something went wrong", func() {
+		ih.ServeHTTP(httptest.NewRecorder(), r)
+	})
+
+	span := ih.spans[0]
+	assert.Equal(t, 500, span.ReadAttribute("http.response.status_code"))
+	assert.Equal(t, "something went wrong", span.Err.Error())
+	assert.Equal(t, sdk.StatusCodeError, span.Status.Code)
+
+	events := span.Events()
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "exception", events[0].Name)
+	assert.Equal(t, "string", events[0].Attributes["exception.type"])
+	assert.Contains(t, events[0].Attributes["exception.stacktrace"], "TestServerPanicIsRecorded")
+}
+
+func TestServerResponseWriterKeepsFlusher(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		f, ok := rw.(http.Flusher)
+		assert.True(t, ok)
+		rw.Write([]byte("data: a\n\n"))
+		f.Flush()
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/events", nil)
+	w := httptest.NewRecorder()
+	ih.ServeHTTP(w, r)
+
+	assert.True(t, w.Flushed)
+	assert.Equal(t, int64(9), ih.spans[0].ReadAttribute("http.response.body.size"))
+}
+
+func TestServerFlushedResponseIsNotBuffered(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"id":1}`))
+		rw.(http.Flusher).Flush()
+		rw.Write([]byte(`{"id":2}`))
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	internalconfig.GetConfig().DataCapture.HttpBody.Response = config.Bool(true)
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/items", nil)
+	w := httptest.NewRecorder()
+	ih.ServeHTTP(w, r)
+
+	assert.True(t, w.Flushed)
+	assert.Equal(t, `{"id":1}{"id":2}`, w.Body.String())
+
+	span := ih.spans[0]
+	assert.Equal(t, true, span.ReadAttribute("http.response.streaming"))
+	assert.Nil(t, span.ReadAttribute("http.response.body"))
+	assert.Equal(t, int64(16), span.ReadAttribute("http.response.body.size"))
+
+	// the chunks written after the flush aren't buffered
+	wi := &rwInterceptor{w: httptest.NewRecorder(), statusCode: 200, captureBody: true}
+	rw := wi.wrap()
+	rw.Write([]byte(`{"id":1}`))
+	rw.(http.Flusher).Flush()
+	rw.Write([]byte(`{"id":2}`))
+	assert.Nil(t, wi.body)
+}
+
 func TestHostIsSuccessfullyRecorded(t *testing.T) {
 	defer internalconfig.ResetConfig()
 
@@ -112,7 +236,7 @@ func TestHostIsSuccessfullyRecorded(t *testing.T) {
 	})
 
 	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, &metricsHandler{}).(*handler)
-	wh.dataCaptureConfig = emptyTestConfig
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
 
 	ih := &mockHandler{baseHandler: wh}
 
@@ -149,8 +273,8 @@ func TestServerRequestHeadersAreSuccessfullyRecorded(t *testing.T) {
 
 		wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, &metricsHandler{}).(*handler)
 		ih := &mockHandler{baseHandler: wh}
-		wh.dataCaptureConfig = emptyTestConfig
-		wh.dataCaptureConfig.HttpHeaders = &config.Message{
+		internalconfig.GetConfig().DataCapture = emptyTestConfig()
+		internalconfig.GetConfig().DataCapture.HttpHeaders = &config.Message{
 			Request:  config.Bool(tCase.captureHTTPHeadersRequestConfig),
 			Response: config.Bool(tCase.captureHTTPHeadersResponseConfig),
 		}
@@ -179,6 +303,30 @@ func TestServerRequestHeadersAreSuccessfullyRecorded(t *testing.T) {
 	}
 }
 
+func TestServerAppliesConfigUpdates(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})
+	wh := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, &metricsHandler{})
+	ih := &mockHandler{baseHandler: wh}
+
+	cfg := &config.AgentConfig{DataCapture: emptyTestConfig()}
+	cfg.DataCapture.HttpHeaders.Request = config.Bool(true)
+	internalconfig.UpdateConfig(cfg)
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/foo", nil)
+	r.Header.Add("api_key", "xyz123abc")
+	ih.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "xyz123abc", ih.spans[0].ReadAttribute("http.request.header.api_key"))
+
+	// the handler isn't wrapped again
+	cfg.DataCapture.HttpHeaders.Request = config.Bool(false)
+	internalconfig.UpdateConfig(cfg)
+
+	ih.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Nil(t, ih.spans[1].ReadAttribute("http.request.header.api_key"))
+}
+
 func TestServerRecordsRequestAndResponseBodyAccordingly(t *testing.T) {
 	tCases := map[string]struct {
 		captureHTTPBodyConfig          bool
@@ -294,8 +442,8 @@ func TestServerRecordsRequestAndResponseBodyAccordingly(t *testing.T) {
 			})
 
 			wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, &metricsHandler{}).(*handler)
-			wh.dataCaptureConfig = emptyTestConfig
-			wh.dataCaptureConfig.HttpBody = &config.Message{
+			internalconfig.GetConfig().DataCapture = emptyTestConfig()
+			internalconfig.GetConfig().DataCapture.HttpBody = &config.Message{
 				Request:  config.Bool(tCase.captureHTTPBodyConfig),
 				Response: config.Bool(tCase.captureHTTPBodyConfig),
 			}
@@ -349,6 +497,139 @@ func TestServerRecordsRequestAndResponseBodyAccordingly(t *testing.T) {
 	}
 }
 
+func TestServerRecordsBodyAccordingToPolicy(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	binaryBody := []byte("\x00\x01\xfe\xffbinary")
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(binaryBody)
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{
+		BodyPolicy: bodyattribute.Policy{"application/x-www-form-urlencoded": bodyattribute.EncodingSize},
+	}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	internalconfig.GetConfig().DataCapture.HttpBody = &config.Message{
+		Request:  config.Bool(true),
+		Response: config.Bool(true),
+	}
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("POST", "http://traceable.ai/foo", strings.NewReader("name=Jacinto"))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	ih.ServeHTTP(httptest.NewRecorder(), r)
+
+	span := ih.spans[0]
+	assert.Equal(t, int64(len("name=Jacinto")), span.ReadAttribute("http.request.body.captured_size"))
+	assert.Nil(t, span.ReadAttribute("http.request.body"))
+	// binary bodies are base64 encoded even if the content type is allowed
+	assert.Equal(t, base64.RawStdEncoding.EncodeToString(binaryBody), span.ReadAttribute("http.response.body.base64"))
+	assert.Nil(t, span.ReadAttribute("http.response.body"))
+	assert.Equal(t, int64(len(binaryBody)), span.ReadAttribute("http.response.body.size"))
+}
+
+func TestServerRecordsCapturedAndTotalResponseSize(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	encodedResponseBody := encode(t, "gzip", []byte(plainBody))
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Content-Encoding", "gzip")
+		rw.Write(encodedResponseBody)
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{
+		BodyPolicy: bodyattribute.Policy{"application/json": bodyattribute.EncodingSize},
+	}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	internalconfig.GetConfig().DataCapture.HttpBody = &config.Message{
+		Request:  config.Bool(false),
+		Response: config.Bool(true),
+	}
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/foo", nil)
+	ih.ServeHTTP(httptest.NewRecorder(), r)
+
+	span := ih.spans[0]
+	// the policy records the size of the decoded body while the total is the size of the response sent
+	assert.Equal(t, int64(len(plainBody)), span.ReadAttribute("http.response.body.captured_size"))
+	assert.Equal(t, int64(len(encodedResponseBody)), span.ReadAttribute("http.response.body.size"))
+}
+
+func TestServerRecordsDecodedBody(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	encodedRequestBody := encode(t, "gzip", []byte(plainBody))
+	encodedResponseBody := encode(t, "br", []byte(plainBody))
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		// the handler gets the body as it was sent
+		assert.Equal(t, encodedRequestBody, body)
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Content-Encoding", "br")
+		rw.Write(encodedResponseBody)
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	internalconfig.GetConfig().DataCapture.HttpBody = &config.Message{
+		Request:  config.Bool(true),
+		Response: config.Bool(true),
+	}
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("POST", "http://traceable.ai/foo", bytes.NewReader(encodedRequestBody))
+	r.Header.Add("Content-Type", "application/json")
+	r.Header.Add("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	ih.ServeHTTP(w, r)
+
+	assert.Equal(t, encodedResponseBody, w.Body.Bytes())
+
+	span := ih.spans[0]
+	assert.Equal(t, plainBody, span.ReadAttribute("http.request.body"))
+	assert.Equal(t, plainBody, span.ReadAttribute("http.response.body"))
+	// the size is the one of the response sent
+	assert.Equal(t, int64(len(encodedResponseBody)), span.ReadAttribute("http.response.body.size"))
+}
+
+func TestServerRecordsBodyWithDecoder(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	protobufBody, err := proto.Marshal(wrapperspb.String("Hello Jacinto"))
+	assert.NoError(t, err)
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/x-protobuf; messageType=google.protobuf.StringValue")
+		rw.Write(protobufBody)
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{
+		BodyDecoders: bodyattribute.DefaultDecoders(),
+	}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	internalconfig.GetConfig().DataCapture.HttpBody = &config.Message{
+		Request:  config.Bool(true),
+		Response: config.Bool(true),
+	}
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("POST", "http://traceable.ai/foo", strings.NewReader("name=Jacinto&role=admin"))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	ih.ServeHTTP(w, r)
+
+	assert.Equal(t, protobufBody, w.Body.Bytes())
+
+	span := ih.spans[0]
+	assert.Equal(t, `{"name":["Jacinto"],"role":["admin"]}`, span.ReadAttribute("http.request.body"))
+	// protobuf isn't an allowed content type but it has a decoder
+	assert.Equal(t, `"Hello Jacinto"`, span.ReadAttribute("http.response.body"))
+}
+
 func TestServerRequestFilter(t *testing.T) {
 	tCases := map[string]struct {
 		url                    string
@@ -502,10 +783,10 @@ func TestProcessingBodyIsTrimmed(t *testing.T) {
 			},
 		},
 	}, map[string]string{}, &metricsHandler{}).(*handler)
-	wh.dataCaptureConfig = emptyTestConfig
-	wh.dataCaptureConfig.HttpBody.Request = config.Bool(true)
-	wh.dataCaptureConfig.BodyMaxProcessingSizeBytes = config.Int32(int32(bodyMaxProcessingSizeBytes))
-	wh.dataCaptureConfig.BodyMaxSizeBytes = config.Int32(int32(bodyMaxProcessingSizeBytes))
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	internalconfig.GetConfig().DataCapture.HttpBody.Request = config.Bool(true)
+	internalconfig.GetConfig().DataCapture.BodyMaxProcessingSizeBytes = config.Int32(int32(bodyMaxProcessingSizeBytes))
+	internalconfig.GetConfig().DataCapture.BodyMaxSizeBytes = config.Int32(int32(bodyMaxProcessingSizeBytes))
 
 	ih := &mockHandler{baseHandler: wh}
 
@@ -538,7 +819,7 @@ func TestFilterResultDecorations(t *testing.T) {
 			},
 		},
 	}, map[string]string{}, &metricsHandler{}).(*handler)
-	wh.dataCaptureConfig = emptyTestConfig
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
 
 	ih := &mockHandler{baseHandler: wh}
 
@@ -579,7 +860,7 @@ func TestFilterResultEmptyDecorations(t *testing.T) {
 			},
 		},
 	}, map[string]string{}, &metricsHandler{}).(*handler)
-	wh.dataCaptureConfig = emptyTestConfig
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
 
 	ih := &mockHandler{baseHandler: wh}
 
@@ -604,7 +885,7 @@ func TestUrlAttribute(t *testing.T) {
 	})
 
 	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, &metricsHandler{}).(*handler)
-	wh.dataCaptureConfig = emptyTestConfig
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
 	ih := &mockHandler{baseHandler: wh}
 
 	// http.url
@@ -625,3 +906,230 @@ func TestUrlAttribute(t *testing.T) {
 	assert.Nil(t, span.ReadAttribute("http.url"))
 
 }
+
+func TestServerUpgradeRequestIsRecorded(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		conn, bufrw, err := rw.(http.Hijacker).Hijack()
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		bufrw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		bufrw.Flush()
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	ih := &mockHandler{baseHandler: wh}
+
+	srv := httptest.NewServer(ih)
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/ws", nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 101, res.StatusCode)
+	res.Body.Close()
+
+	span := ih.spans[0]
+	assert.Equal(t, "websocket", span.ReadAttribute("http.upgrade"))
+	assert.Equal(t, 101, span.ReadAttribute("http.response.status_code"))
+	assert.Nil(t, span.ReadAttribute("http.response.body.size"))
+}
+
+func TestUpgradeProtocol(t *testing.T) {
+	h := http.Header{}
+	_, ok := UpgradeProtocol(NewHeaderMapAccessor(h))
+	assert.False(t, ok)
+
+	h.Set("Upgrade", "WebSocket")
+	_, ok = UpgradeProtocol(NewHeaderMapAccessor(h))
+	assert.False(t, ok)
+
+	h.Set("Connection", "Upgrade")
+	protocol, ok := UpgradeProtocol(NewHeaderMapAccessor(h))
+	assert.True(t, ok)
+	assert.Equal(t, "websocket", protocol)
+}
+
+func TestServerSentEventsAreRecorded(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Write([]byte(": keep alive\n\nevent: update\nid: 1\ndata: hello\n"))
+		rw.Write([]byte("data: world\n\n"))
+		rw.(http.Flusher).Flush()
+		rw.Write([]byte("data: a long message\r\n\r\ndata: dropped\n\n"))
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{StreamingEvents: true, MaxStreamingEvents: 2}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = &config.DataCapture{
+		HttpHeaders: &config.Message{
+			Request:  config.Bool(false),
+			Response: config.Bool(false),
+		},
+		HttpBody: &config.Message{
+			Request:  config.Bool(false),
+			Response: config.Bool(true),
+		},
+		BodyMaxSizeBytes:    config.Int32(6),
+		AllowedContentTypes: testAllowedContentTypes,
+	}
+	internalconfig.GetConfig().DataCapture.AllowedContentTypes = append(internalconfig.GetConfig().DataCapture.AllowedContentTypes,
+		config.String("text/event-stream"))
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/events", nil)
+	w := httptest.NewRecorder()
+	ih.ServeHTTP(w, r)
+
+	assert.True(t, w.Flushed)
+
+	span := ih.spans[0]
+	assert.Equal(t, true, span.ReadAttribute("http.response.streaming"))
+	assert.Equal(t, 1, span.ReadAttribute("http.response.streaming.dropped_events"))
+	// whole body capture is skipped for streaming content types
+	assert.Nil(t, span.ReadAttribute("http.response.body"))
+
+	events := span.Events()
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "sse.event", events[0].Name)
+	assert.Equal(t, map[string]interface{}{
+		"sse.event":          "update",
+		"sse.id":             "1",
+		"sse.data":           "hello\n",
+		"sse.data.size":      11,
+		"sse.data.truncated": true,
+	}, events[0].Attributes)
+	assert.Equal(t, map[string]interface{}{
+		"sse.event":          "message",
+		"sse.data":           "a long",
+		"sse.data.size":      14,
+		"sse.data.truncated": true,
+	}, events[1].Attributes)
+}
+
+func TestServerChunksAreRecorded(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("chunk1"))
+		rw.(http.Flusher).Flush()
+		rw.Write([]byte("chunk_2"))
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{StreamingEvents: true}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/chunks", nil)
+	ih.ServeHTTP(httptest.NewRecorder(), r)
+
+	events := ih.spans[0].Events()
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "http.response.chunk", events[0].Name)
+	assert.Equal(t, 6, events[0].Attributes["http.response.chunk.size"])
+	assert.Equal(t, 7, events[1].Attributes["http.response.chunk.size"])
+}
+
+func TestServerGraphQLRequestIsRecorded(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		// the body is still readable by the handler even if it isn't captured
+		assert.Contains(t, string(body), "GetUser")
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{GraphQL: true, GraphQLSpanName: true}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	ih := &mockHandler{baseHandler: wh}
+
+	body := `{
+		"query": "query GetUser($id: ID!) { user(id: $id, name: \"john\") { id } } mutation DeleteUser { deleteUser(id: 1) }",
+		"operationName": "GetUser",
+		"variables": {"id": "secret", "admin": true}
+	}`
+	r, _ := http.NewRequest("POST", "http://traceable.ai/graphql", strings.NewReader(body))
+	r.Header.Add("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ih.ServeHTTP(w, r)
+
+	span := ih.spans[0]
+	assert.Equal(t, "query GetUser", span.Name)
+	assert.Equal(t, "query", span.ReadAttribute("graphql.operation.type"))
+	assert.Equal(t, "GetUser", span.ReadAttribute("graphql.operation.name"))
+	assert.Equal(t, `query GetUser($id: ID!) { user(id: $id name: "") { id } } mutation DeleteUser { deleteUser(id: 0) }`,
+		span.ReadAttribute("graphql.document"))
+	assert.Equal(t, []string{"admin", "id"}, span.ReadAttribute("graphql.variables"))
+}
+
+func TestServerGraphQLRequestLargerThanProcessingSizeIsNotParsed(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	body := `{"query": "query GetUser { user { id } }", "variables": {"payload": "` + strings.Repeat("a", 2000) + `"}}`
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		readBody, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		// the delegate reads the whole body even though only its first bytes were peeked at
+		assert.Equal(t, body, string(readBody))
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{GraphQL: true, GraphQLSpanName: true}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("POST", "http://traceable.ai/graphql", strings.NewReader(body))
+	r.Header.Add("Content-Type", "application/json")
+	ih.ServeHTTP(httptest.NewRecorder(), r)
+
+	span := ih.spans[0]
+	assert.Equal(t, "", span.Name)
+	assert.Nil(t, span.ReadAttribute("graphql.operation.type"))
+}
+
+func TestServerGraphQLGetRequestIsRecorded(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{GraphQL: true}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/graphql?query=%7B%20users%20%7B%20id%20%7D%20%7D", nil)
+	w := httptest.NewRecorder()
+	ih.ServeHTTP(w, r)
+
+	span := ih.spans[0]
+	// the span isn't renamed unless requested
+	assert.Equal(t, "", span.Name)
+	assert.Equal(t, "query", span.ReadAttribute("graphql.operation.type"))
+	assert.Nil(t, span.ReadAttribute("graphql.operation.name"))
+	assert.Equal(t, "{ users { id } }", span.ReadAttribute("graphql.document"))
+}
+
+func TestServerNonGraphQLRequestIsNotRecorded(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{GraphQL: true, GraphQLSpanName: true}, map[string]string{}, &metricsHandler{}).(*handler)
+	internalconfig.GetConfig().DataCapture = emptyTestConfig()
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("POST", "http://traceable.ai/users", strings.NewReader(`{"name": "john"}`))
+	r.Header.Add("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ih.ServeHTTP(w, r)
+
+	span := ih.spans[0]
+	assert.Equal(t, "", span.Name)
+	assert.Nil(t, span.ReadAttribute("graphql.operation.type"))
+	assert.Nil(t, span.ReadAttribute("graphql.document"))
+}
@@ -0,0 +1,213 @@
+package http // import "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
+)
+
+const (
+	sseEventName   = "sse.event"
+	chunkEventName = "http.response.chunk"
+
+	defaultMaxStreamingEvents = 100
+
+	// maxSSELineSize bounds the memory used for a single SSE line so a
+	// misbehaving stream can't make us buffer indefinitely.
+	maxSSELineSize = 64 * 1024
+)
+
+// streamingContentTypes are the content types whose body is not captured
+// as a whole as they are meant to be long lived.
+var streamingContentTypes = []string{
+	"text/event-stream",
+	"application/x-ndjson",
+	"application/stream+json",
+}
+
+// IsStreamingContentType returns true if the Content-Type header is a streaming one
+// (e.g. text/event-stream).
+func IsStreamingContentType(h HeaderAccessor) bool {
+	for _, contentTypeValue := range h.Lookup(contentTypeHeaderKey) {
+		for _, streamingContentType := range streamingContentTypes {
+			if strings.Contains(strings.ToLower(contentTypeValue), streamingContentType) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isEventStream(h HeaderAccessor) bool {
+	for _, contentTypeValue := range h.Lookup(contentTypeHeaderKey) {
+		if strings.Contains(strings.ToLower(contentTypeValue), "text/event-stream") {
+			return true
+		}
+	}
+	return false
+}
+
+// streamRecorder records a streamed response as span events. Server-Sent Events
+// are recorded one event per SSE event, any other response is recorded one event
+// per flushed chunk.
+type streamRecorder struct {
+	span           sdk.Span
+	maxEvents      int
+	events         int
+	capturePayload bool
+	payloadMaxSize int
+
+	isEventStream bool
+	// pending holds the incomplete line of the event stream.
+	pending []byte
+	// sseEvent holds the fields of the SSE event being parsed.
+	sseEvent sseEvent
+	// chunkSize holds the bytes written since the last flush.
+	chunkSize int
+}
+
+type sseEvent struct {
+	eventType string
+	id        string
+	data      []byte
+	dataSize  int
+	hasData   bool
+}
+
+func newStreamRecorder(span sdk.Span, maxEvents int, capturePayload bool, payloadMaxSize int) *streamRecorder {
+	if maxEvents <= 0 {
+		maxEvents = defaultMaxStreamingEvents
+	}
+	return &streamRecorder{
+		span:           span,
+		maxEvents:      maxEvents,
+		capturePayload: capturePayload,
+		payloadMaxSize: payloadMaxSize,
+	}
+}
+
+func (s *streamRecorder) write(b []byte) {
+	if !s.isEventStream {
+		s.chunkSize += len(b)
+		return
+	}
+
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			if len(s.pending)+len(b) <= maxSSELineSize {
+				s.pending = append(s.pending, b...)
+			}
+			return
+		}
+
+		line := b[:i]
+		if len(s.pending) > 0 {
+			line = append(s.pending, line...)
+			s.pending = s.pending[:0]
+		}
+		s.processLine(bytes.TrimSuffix(line, []byte{'\r'}))
+		b = b[i+1:]
+	}
+}
+
+// processLine follows https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
+func (s *streamRecorder) processLine(line []byte) {
+	if len(line) == 0 {
+		s.dispatchSSEEvent()
+		return
+	}
+
+	if line[0] == ':' {
+		// comment
+		return
+	}
+
+	field, value := line, []byte{}
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		field, value = line[:i], bytes.TrimPrefix(line[i+1:], []byte{' '})
+	}
+
+	switch string(field) {
+	case "event":
+		s.sseEvent.eventType = string(value)
+	case "id":
+		s.sseEvent.id = string(value)
+	case "data":
+		if s.sseEvent.hasData {
+			s.sseEvent.dataSize++
+			if s.capturePayload && len(s.sseEvent.data) < s.payloadMaxSize {
+				s.sseEvent.data = append(s.sseEvent.data, '\n')
+			}
+		}
+		s.sseEvent.hasData = true
+		s.sseEvent.dataSize += len(value)
+		if s.capturePayload && len(s.sseEvent.data) < s.payloadMaxSize {
+			s.sseEvent.data = append(s.sseEvent.data, value...)
+		}
+	}
+}
+
+func (s *streamRecorder) dispatchSSEEvent() {
+	e := s.sseEvent
+	s.sseEvent = sseEvent{}
+	if !e.hasData {
+		return
+	}
+
+	eventType := e.eventType
+	if eventType == "" {
+		eventType = "message"
+	}
+
+	attrs := map[string]interface{}{
+		"sse.event":     eventType,
+		"sse.data.size": e.dataSize,
+	}
+	if e.id != "" {
+		attrs["sse.id"] = e.id
+	}
+	if s.capturePayload {
+		data, truncated := bodyattribute.TruncateBody(e.data, s.payloadMaxSize)
+		attrs["sse.data"] = string(data)
+		if truncated || len(e.data) < e.dataSize {
+			attrs["sse.data.truncated"] = true
+		}
+	}
+
+	s.addEvent(sseEventName, attrs)
+}
+
+func (s *streamRecorder) flush() {
+	if s.isEventStream || s.chunkSize == 0 {
+		return
+	}
+
+	s.addEvent(chunkEventName, map[string]interface{}{
+		"http.response.chunk.size": s.chunkSize,
+	})
+	s.chunkSize = 0
+}
+
+func (s *streamRecorder) addEvent(name string, attrs map[string]interface{}) {
+	s.events++
+	if s.events > s.maxEvents {
+		return
+	}
+	s.span.AddEvent(name, time.Now(), attrs)
+}
+
+// flusher lets the interceptor know when the handler flushes a chunk.
+type flusher struct {
+	r  *rwInterceptor
+	fl http.Flusher
+}
+
+func (f *flusher) Flush() {
+	f.r.onFlush()
+	f.fl.Flush()
+}
@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
-	config "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	"github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
 	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
 	"github.com/hypertrace/goagent/sdk/internal/container"
 )
@@ -17,7 +21,9 @@ type roundTripper struct {
 	delegate                 http.RoundTripper
 	defaultAttributes        map[string]string
 	spanFromContextRetriever sdk.SpanFromContext
-	dataCaptureConfig        *config.DataCapture
+	filter                   filter.Filter
+	bodyPolicy               bodyattribute.Policy
+	bodyDecoders             bodyattribute.Decoders
 }
 
 func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -30,12 +36,16 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 		return rt.delegate.RoundTrip(req)
 	}
 	reqHeadersAccessor := NewHeaderMapAccessor(req.Header)
+	// the config is read on every request as it can be updated at runtime.
+	dataCaptureConfig := internalconfig.GetConfig().GetDataCapture()
 
 	for key, value := range rt.defaultAttributes {
 		span.SetAttribute(key, value)
 	}
 
-	if rt.dataCaptureConfig.HttpHeaders.Request.Value {
+	setAttemptAttributes(req, span, rt.spanFromContextRetriever)
+
+	if dataCaptureConfig.HttpHeaders.Request.Value {
 		SetAttributesFromHeaders("request", reqHeadersAccessor, span)
 	}
 
@@ -43,7 +53,7 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	// is in the recording accept list. Notice in here we rely on the fact that
 	// the content type is not streamable, otherwise we could end up in a very
 	// expensive parsing of a big body in memory.
-	if req.Body != nil && rt.dataCaptureConfig.HttpBody.Request.Value && ShouldRecordBodyOfContentType(reqHeadersAccessor) {
+	if req.Body != nil && dataCaptureConfig.HttpBody.Request.Value && rt.shouldRecordBody(reqHeadersAccessor) {
 		body, err := io.ReadAll(req.Body)
 		if err != nil {
 			return rt.delegate.RoundTrip(req)
@@ -51,21 +61,44 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 		defer req.Body.Close()
 
 		if len(body) > 0 {
-			setTruncatedBodyAttribute("request", body, int(rt.dataCaptureConfig.BodyMaxSizeBytes.Value), span,
-				HasMultiPartFormDataContentTypeHeader(reqHeadersAccessor))
+			recordedBody, contentType := decodedBody(reqHeadersAccessor, body, req.URL.Path, false, dataCaptureConfig, rt.bodyDecoders)
+			setTruncatedBodyAttribute("request", recordedBody, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span,
+				contentType, rt.bodyPolicy)
 		}
 
 		req.Body = io.NopCloser(bytes.NewBuffer(body))
 	}
 
+	if rt.filter != nil {
+		// single evaluation call to filter after capturing the configured parameters
+		filterResult := rt.filter.Evaluate(span)
+		span.SetAttribute("http.request.blocked", filterResult.Block)
+		if filterResult.Block {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return newBlockedResponse(req, filterResult), nil
+		} else if filterResult.Decorations != nil {
+			// the request must not be modified by a RoundTripper, hence the headers
+			// are injected in a copy.
+			req = req.Clone(req.Context())
+			for _, header := range filterResult.Decorations.RequestHeaderInjections {
+				req.Header.Add(header.Key, header.Value)
+				span.SetAttribute("http.request.header."+strings.ToLower(header.Key), header.Value)
+			}
+		}
+	}
+
+	req, timings := withConnectionTimings(req)
 	res, err := rt.delegate.RoundTrip(req)
+	timings.addEvent(span)
 	if err != nil {
 		return res, err
 	}
 	resHeadersAccessor := NewHeaderMapAccessor(res.Header)
 
 	// Notice, parsing a streamed content in memory can be expensive.
-	if rt.dataCaptureConfig.HttpBody.Response.Value && ShouldRecordBodyOfContentType(resHeadersAccessor) {
+	if dataCaptureConfig.HttpBody.Response.Value && rt.shouldRecordBody(resHeadersAccessor) {
 		body, err := io.ReadAll(res.Body)
 		if err != nil {
 			return res, nil
@@ -73,14 +106,15 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 		defer res.Body.Close()
 
 		if len(body) > 0 {
-			setTruncatedBodyAttribute("response", body, int(rt.dataCaptureConfig.BodyMaxSizeBytes.Value), span,
-				HasMultiPartFormDataContentTypeHeader(resHeadersAccessor))
+			recordedBody, contentType := decodedBody(resHeadersAccessor, body, req.URL.Path, true, dataCaptureConfig, rt.bodyDecoders)
+			setTruncatedBodyAttribute("response", recordedBody, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span,
+				contentType, rt.bodyPolicy)
 		}
 
 		res.Body = io.NopCloser(bytes.NewBuffer(body))
 	}
 
-	if rt.dataCaptureConfig.HttpHeaders.Response.Value {
+	if dataCaptureConfig.HttpHeaders.Response.Value {
 		// Sets an attribute per each response header.
 		SetAttributesFromHeaders("response", resHeadersAccessor, span)
 	}
@@ -88,9 +122,38 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	return res, err
 }
 
+// newBlockedResponse returns the response for a request blocked by the filter, it is
+// never sent to the destination.
+func newBlockedResponse(req *http.Request, filterResult result.FilterResult) *http.Response {
+	statusCode := int(filterResult.ResponseStatusCode)
+	if statusCode == 0 {
+		statusCode = http.StatusForbidden
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+		Body:          io.NopCloser(strings.NewReader(filterResult.ResponseMessage)),
+		ContentLength: int64(len(filterResult.ResponseMessage)),
+		Request:       req,
+	}
+}
+
 // WrapTransport returns a new http.RoundTripper that should be wrapped
 // by an instrumented http.RoundTripper
 func WrapTransport(delegate http.RoundTripper, spanFromContextRetriever sdk.SpanFromContext, spanAttributes map[string]string) http.RoundTripper {
+	return WrapTransportWithOptions(delegate, spanFromContextRetriever, nil, spanAttributes)
+}
+
+// WrapTransportWithOptions is like WrapTransport but it also accepts instrumentation options.
+// The filter in the options is evaluated on the client span before the request is sent, a
+// blocked request gets a synthetic response with the status code set by the filter.
+func WrapTransportWithOptions(delegate http.RoundTripper, spanFromContextRetriever sdk.SpanFromContext, options *Options,
+	spanAttributes map[string]string) http.RoundTripper {
 	defaultAttributes := make(map[string]string)
 	for k, v := range spanAttributes {
 		defaultAttributes[k] = v
@@ -99,5 +162,22 @@ func WrapTransport(delegate http.RoundTripper, spanFromContextRetriever sdk.Span
 		defaultAttributes["container_id"] = containerID
 	}
 
-	return &roundTripper{delegate, defaultAttributes, spanFromContextRetriever, internalconfig.GetConfig().GetDataCapture()}
+	rt := &roundTripper{
+		delegate:                 delegate,
+		defaultAttributes:        defaultAttributes,
+		spanFromContextRetriever: spanFromContextRetriever,
+	}
+	if options != nil {
+		rt.filter = options.Filter
+		rt.bodyPolicy = options.BodyPolicy
+		rt.bodyDecoders = options.BodyDecoders
+	}
+
+	return rt
+}
+
+// shouldRecordBody tells whether the body is meant to be recorded based on its content
+// type, either allowed by the config or with a decoder.
+func (rt *roundTripper) shouldRecordBody(headersAccessor HeaderAccessor) bool {
+	return ShouldRecordBodyOfContentType(headersAccessor) || rt.bodyDecoders.Supports(contentTypeOf(headersAccessor))
 }
@@ -12,6 +12,8 @@ import (
 	"testing"
 
 	config "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter/result"
 	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
 	"github.com/hypertrace/goagent/sdk/internal/mock"
 	"github.com/stretchr/testify/assert"
@@ -30,6 +32,8 @@ func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 }
 
 func TestClientRequestIsSuccessfullyTraced(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
 	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		rw.WriteHeader(202)
 		rw.Write([]byte(`{"id":123}`))
@@ -37,7 +41,7 @@ func TestClientRequestIsSuccessfullyTraced(t *testing.T) {
 	defer srv.Close()
 
 	rt := WrapTransport(http.DefaultTransport, mock.SpanFromContext, map[string]string{"foo": "bar"}).(*roundTripper)
-	rt.dataCaptureConfig = &config.DataCapture{
+	internalconfig.GetConfig().DataCapture = &config.DataCapture{
 		HttpHeaders: &config.Message{
 			Request:  config.Bool(false),
 			Response: config.Bool(false),
@@ -46,7 +50,8 @@ func TestClientRequestIsSuccessfullyTraced(t *testing.T) {
 			Request:  config.Bool(false),
 			Response: config.Bool(false),
 		},
-		BodyMaxSizeBytes: config.Int32(1000),
+		BodyMaxSizeBytes:    config.Int32(1000),
+		AllowedContentTypes: testAllowedContentTypes,
 	}
 
 	tr := &mockTransport{
@@ -81,6 +86,8 @@ func TestClientRequestIsSuccessfullyTraced(t *testing.T) {
 }
 
 func TestClientRequestHeadersAreCapturedAccordingly(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
 	tCases := []struct {
 		captureHTTPHeadersRequestConfig  bool
 		captureHTTPHeadersResponseConfig bool
@@ -101,7 +108,7 @@ func TestClientRequestHeadersAreCapturedAccordingly(t *testing.T) {
 		defer srv.Close()
 
 		rt := WrapTransport(http.DefaultTransport, mock.SpanFromContext, map[string]string{"foo": "bar"}).(*roundTripper)
-		rt.dataCaptureConfig = &config.DataCapture{
+		internalconfig.GetConfig().DataCapture = &config.DataCapture{
 			HttpHeaders: &config.Message{
 				Request:  config.Bool(tCase.captureHTTPHeadersRequestConfig),
 				Response: config.Bool(tCase.captureHTTPHeadersResponseConfig),
@@ -110,7 +117,8 @@ func TestClientRequestHeadersAreCapturedAccordingly(t *testing.T) {
 				Request:  config.Bool(false),
 				Response: config.Bool(false),
 			},
-			BodyMaxSizeBytes: config.Int32(1000),
+			BodyMaxSizeBytes:    config.Int32(1000),
+			AllowedContentTypes: testAllowedContentTypes,
 		}
 
 		tr := &mockTransport{
@@ -180,6 +188,8 @@ func TestClientFailureRequestIsSuccessfullyTraced(t *testing.T) {
 }
 
 func TestClientRecordsRequestAndResponseBodyAccordingly(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
 	tCases := map[string]struct {
 		captureHTTPBodyConfig          bool
 		requestBody                    interface{}
@@ -298,7 +308,7 @@ func TestClientRecordsRequestAndResponseBodyAccordingly(t *testing.T) {
 			defer srv.Close()
 
 			rt := WrapTransport(http.DefaultTransport, mock.SpanFromContext, map[string]string{}).(*roundTripper)
-			rt.dataCaptureConfig = &config.DataCapture{
+			internalconfig.GetConfig().DataCapture = &config.DataCapture{
 				HttpBody: &config.Message{
 					Request:  config.Bool(tCase.captureHTTPBodyConfig),
 					Response: config.Bool(tCase.captureHTTPBodyConfig),
@@ -307,7 +317,8 @@ func TestClientRecordsRequestAndResponseBodyAccordingly(t *testing.T) {
 					Request:  config.Bool(false),
 					Response: config.Bool(false),
 				},
-				BodyMaxSizeBytes: config.Int32(1000),
+				BodyMaxSizeBytes:    config.Int32(1000),
+				AllowedContentTypes: testAllowedContentTypes,
 			}
 			defaultAllowedContentTypes := internalconfig.GetConfig().DataCapture.AllowedContentTypes
 			// add multipart/form-data to allowed content-types
@@ -377,3 +388,182 @@ func TestClientRecordsRequestAndResponseBodyAccordingly(t *testing.T) {
 		})
 	}
 }
+
+func TestClientRecordsDecodedBody(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	encodedRequestBody := encode(t, "zstd", []byte(plainBody))
+	encodedResponseBody := encode(t, "br", []byte(plainBody))
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		// the server gets the body as it was sent
+		assert.Equal(t, encodedRequestBody, body)
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Content-Encoding", "br")
+		rw.Write(encodedResponseBody)
+	}))
+	defer srv.Close()
+
+	rt := WrapTransport(http.DefaultTransport, mock.SpanFromContext, map[string]string{}).(*roundTripper)
+	internalconfig.GetConfig().DataCapture = &config.DataCapture{
+		HttpBody: &config.Message{
+			Request:  config.Bool(true),
+			Response: config.Bool(true),
+		},
+		HttpHeaders: &config.Message{
+			Request:  config.Bool(false),
+			Response: config.Bool(false),
+		},
+		BodyMaxSizeBytes:           config.Int32(1000),
+		BodyMaxProcessingSizeBytes: config.Int32(1000),
+		AllowedContentTypes:        testAllowedContentTypes,
+	}
+	tr := &mockTransport{baseRoundTripper: rt}
+	client := &http.Client{Transport: tr}
+
+	req, _ := http.NewRequest("POST", srv.URL, bytes.NewReader(encodedRequestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "zstd")
+	req.Header.Set("Accept-Encoding", "br")
+	res, err := client.Do(req)
+	assert.NoError(t, err)
+
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	// the client gets the body as it was received
+	assert.Equal(t, encodedResponseBody, body)
+
+	span := tr.spans[0]
+	assert.Equal(t, plainBody, span.ReadAttribute("http.request.body"))
+	assert.Equal(t, plainBody, span.ReadAttribute("http.response.body"))
+}
+
+// attemptTransport is like mockTransport but it keeps the request context.
+type attemptTransport struct {
+	baseRoundTripper http.RoundTripper
+	spans            []*mock.Span
+}
+
+func (t *attemptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span := mock.NewSpan()
+	t.spans = append(t.spans, span)
+	return t.baseRoundTripper.RoundTrip(req.WithContext(mock.ContextWithSpan(req.Context(), span)))
+}
+
+func TestClientRedirectsAreRecordedAsResends(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/old" {
+			http.Redirect(rw, req, "/new", http.StatusMovedPermanently)
+			return
+		}
+		rw.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	tr := &attemptTransport{
+		baseRoundTripper: WrapTransport(http.DefaultTransport, mock.SpanFromContext, map[string]string{}),
+	}
+	client := &http.Client{Transport: tr}
+
+	res, err := client.Get(srv.URL + "/old")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+
+	assert.Equal(t, 2, len(tr.spans))
+	assert.Nil(t, tr.spans[0].ReadAttribute("http.resend_count"))
+
+	span := tr.spans[1]
+	assert.Equal(t, 1, span.ReadAttribute("http.resend_count"))
+	assert.Equal(t, 301, span.ReadAttribute("http.redirect.status_code"))
+	assert.Equal(t, srv.URL+"/old", span.ReadAttribute("http.redirect.from_url"))
+	assert.NotNil(t, span.ReadAttribute("http.redirect.from_span_id"))
+
+	events := tr.spans[0].Events()
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "http.client.connection", events[0].Name)
+	assert.Equal(t, false, events[0].Attributes["http.connection.reused"])
+	assert.Contains(t, events[0].Attributes, "http.connect.duration_ms")
+	assert.Contains(t, events[0].Attributes, "http.time_to_first_byte_ms")
+}
+
+func TestClientRetriesAreRecordedAsResends(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(503)
+	}))
+	defer srv.Close()
+
+	tr := &attemptTransport{
+		baseRoundTripper: WrapTransport(http.DefaultTransport, mock.SpanFromContext, map[string]string{}),
+	}
+
+	ctx := ContextWithAttemptTracking(context.Background())
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+		res, err := tr.RoundTrip(req)
+		assert.NoError(t, err)
+		res.Body.Close()
+	}
+
+	assert.Equal(t, 3, len(tr.spans))
+	assert.Nil(t, tr.spans[0].ReadAttribute("http.resend_count"))
+	assert.Equal(t, 1, tr.spans[1].ReadAttribute("http.resend_count"))
+	assert.Equal(t, 2, tr.spans[2].ReadAttribute("http.resend_count"))
+
+	assert.Equal(t, true, tr.spans[2].Events()[0].Attributes["http.connection.reused"])
+}
+
+func TestClientRequestFilter(t *testing.T) {
+	var serverHeaders http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		serverHeaders = req.Header
+		rw.WriteHeader(202)
+	}))
+	defer srv.Close()
+
+	tr := &mockTransport{
+		baseRoundTripper: WrapTransportWithOptions(http.DefaultTransport, mock.SpanFromContext, &Options{Filter: mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				if span.GetAttributes().GetValue("http.request.header.x-environment") == "sandbox" {
+					return result.FilterResult{Block: true, ResponseStatusCode: 403, ResponseMessage: "egress not allowed"}
+				}
+				return result.FilterResult{Decorations: &result.Decorations{
+					RequestHeaderInjections: []result.KeyValueString{{Key: "X-Tenant", Value: "acme"}},
+				}}
+			},
+		}}, map[string]string{}),
+	}
+	client := &http.Client{
+		Transport: tr,
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("X-Environment", "production")
+	res, err := client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, res.StatusCode)
+	assert.Equal(t, "acme", serverHeaders.Get("X-Tenant"))
+	// the caller's request is left untouched
+	assert.Empty(t, req.Header.Get("X-Tenant"))
+
+	span := tr.spans[0]
+	assert.Equal(t, false, span.ReadAttribute("http.request.blocked"))
+	assert.Equal(t, "acme", span.ReadAttribute("http.request.header.x-tenant"))
+
+	serverHeaders = nil
+	req, _ = http.NewRequest("POST", srv.URL, bytes.NewBufferString(`{"name":"Jacinto"}`))
+	req.Header.Set("X-Environment", "sandbox")
+	res, err = client.Do(req)
+	assert.NoError(t, err)
+	assert.Nil(t, serverHeaders, "blocked request should not reach the server")
+	assert.Equal(t, 403, res.StatusCode)
+	assert.Equal(t, "403 Forbidden", res.Status)
+
+	resBody, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "egress not allowed", string(resBody))
+
+	span = tr.spans[1]
+	assert.Equal(t, true, span.ReadAttribute("http.request.blocked"))
+}
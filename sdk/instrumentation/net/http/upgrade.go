@@ -0,0 +1,43 @@
+package http // import "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// UpgradeProtocol returns the protocol requested by an HTTP/1.1 upgrade request
+// (e.g. "websocket") and whether the request is an upgrade request at all.
+func UpgradeProtocol(h HeaderAccessor) (string, bool) {
+	isUpgrade := false
+	for _, value := range h.Lookup("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				isUpgrade = true
+			}
+		}
+	}
+
+	upgrade := h.Lookup("Upgrade")
+	if !isUpgrade || len(upgrade) == 0 {
+		return "", false
+	}
+
+	return strings.ToLower(strings.TrimSpace(upgrade[0])), true
+}
+
+// hijacker tracks whether the connection was taken over by the handler, which
+// is how upgrades like WebSocket are done.
+type hijacker struct {
+	r  *rwInterceptor
+	hj http.Hijacker
+}
+
+func (h *hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := h.hj.Hijack()
+	if err == nil {
+		h.r.hijacked = true
+	}
+	return conn, rw, err
+}
@@ -0,0 +1,130 @@
+package websocket // import "github.com/hypertrace/goagent/sdk/instrumentation/websocket"
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+)
+
+const (
+	messageEventName = "websocket.message"
+
+	defaultMaxMessageEvents = 100
+
+	// OpcodeText and OpcodeBinary are the data frame opcodes as defined in
+	// https://datatracker.ietf.org/doc/html/rfc6455#section-11.8
+	OpcodeText   = 1
+	OpcodeBinary = 2
+)
+
+// Direction tells whether a message was received or sent by the instrumented side.
+type Direction string
+
+const (
+	DirectionReceived Direction = "received"
+	DirectionSent     Direction = "sent"
+)
+
+// Options for WebSocket instrumentation
+type Options struct {
+	// CaptureMessages records a span event per message.
+	CaptureMessages bool
+	// MaxMessageEvents caps the number of message events recorded per connection,
+	// defaults to 100.
+	MaxMessageEvents int
+}
+
+// StartHandshake starts a span covering the WebSocket handshake of the request. The returned
+// function has to be called once the handshake is done, along with its error if any.
+func StartHandshake(r *http.Request, startSpan sdk.StartSpan) (context.Context, sdk.Span, func(err error)) {
+	ctx, span, end := startSpan(r.Context(), "websocket.handshake", &sdk.SpanOptions{})
+
+	span.SetAttribute("http.target", r.URL.String())
+	if protocols := r.Header.Get("Sec-WebSocket-Protocol"); protocols != "" {
+		span.SetAttribute("websocket.requested_subprotocols", protocols)
+	}
+	if version := r.Header.Get("Sec-WebSocket-Version"); version != "" {
+		span.SetAttribute("websocket.version", version)
+	}
+
+	return ctx, span, func(err error) {
+		if err != nil {
+			span.SetError(err)
+			span.SetStatus(sdk.StatusCodeError, err.Error())
+		} else {
+			span.SetStatus(sdk.StatusCodeOk, "")
+		}
+		end()
+	}
+}
+
+// MessageRecorder records WebSocket messages as span events.
+type MessageRecorder struct {
+	span              sdk.Span
+	enabled           bool
+	maxEvents         int64
+	events            atomic.Int64
+	dataCaptureConfig *config.DataCapture
+}
+
+// NewMessageRecorder returns a recorder adding the message events to the given span,
+// usually the span of the request that was upgraded.
+func NewMessageRecorder(span sdk.Span, options *Options) *MessageRecorder {
+	if options == nil {
+		options = &Options{}
+	}
+
+	maxEvents := options.MaxMessageEvents
+	if maxEvents <= 0 {
+		maxEvents = defaultMaxMessageEvents
+	}
+
+	return &MessageRecorder{
+		span:              span,
+		enabled:           options.CaptureMessages && !span.IsNoop(),
+		maxEvents:         int64(maxEvents),
+		dataCaptureConfig: internalconfig.GetConfig().GetDataCapture(),
+	}
+}
+
+// Record adds an event for the message including its direction, opcode and size. The
+// payload of text messages is included, truncated, if the body capture is enabled for
+// that direction. Binary payloads are never included.
+func (r *MessageRecorder) Record(direction Direction, opcode int, payload []byte) {
+	if r == nil || !r.enabled {
+		return
+	}
+
+	if r.events.Add(1) > r.maxEvents {
+		return
+	}
+
+	attrs := map[string]interface{}{
+		"websocket.direction":    string(direction),
+		"websocket.opcode":       opcode,
+		"websocket.message.size": len(payload),
+	}
+
+	if opcode == OpcodeText && r.shouldCapturePayload(direction) {
+		body, truncated := bodyattribute.TruncateBody(payload, int(r.dataCaptureConfig.BodyMaxSizeBytes.Value))
+		attrs["websocket.message.payload"] = string(body)
+		if truncated {
+			attrs["websocket.message.payload.truncated"] = true
+		}
+	}
+
+	r.span.AddEvent(messageEventName, time.Now(), attrs)
+}
+
+func (r *MessageRecorder) shouldCapturePayload(direction Direction) bool {
+	if direction == DirectionReceived {
+		return r.dataCaptureConfig.HttpBody.Request.Value
+	}
+	return r.dataCaptureConfig.HttpBody.Response.Value
+}
@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartHandshake(t *testing.T) {
+	var span *mock.Span
+	startSpan := func(ctx context.Context, name string, opts *sdk.SpanOptions) (context.Context, sdk.Span, func()) {
+		span = mock.NewSpan()
+		span.Name = name
+		return mock.ContextWithSpan(ctx, span), span, func() {}
+	}
+
+	r, _ := http.NewRequest("GET", "/ws", nil)
+	r.Header.Set("Sec-WebSocket-Protocol", "chat, superchat")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+
+	_, _, end := StartHandshake(r, startSpan)
+	end(errors.New("bad handshake"))
+
+	assert.Equal(t, "websocket.handshake", span.Name)
+	assert.Equal(t, "/ws", span.ReadAttribute("http.target"))
+	assert.Equal(t, "chat, superchat", span.ReadAttribute("websocket.requested_subprotocols"))
+	assert.Equal(t, "13", span.ReadAttribute("websocket.version"))
+	assert.Equal(t, sdk.StatusCodeError, span.Status.Code)
+	assert.Equal(t, "bad handshake", span.Err.Error())
+}
+
+func TestMessageRecorder(t *testing.T) {
+	span := mock.NewSpan()
+	r := NewMessageRecorder(span, &Options{CaptureMessages: true, MaxMessageEvents: 2})
+	r.dataCaptureConfig = &config.DataCapture{
+		HttpBody: &config.Message{
+			Request:  config.Bool(true),
+			Response: config.Bool(false),
+		},
+		BodyMaxSizeBytes: config.Int32(5),
+	}
+
+	r.Record(DirectionReceived, OpcodeText, []byte("hello world"))
+	r.Record(DirectionSent, OpcodeText, []byte("hi"))
+	r.Record(DirectionSent, OpcodeBinary, []byte{0xff})
+
+	events := span.Events()
+	assert.Equal(t, 2, len(events))
+
+	assert.Equal(t, "websocket.message", events[0].Name)
+	assert.Equal(t, map[string]interface{}{
+		"websocket.direction":                 "received",
+		"websocket.opcode":                    1,
+		"websocket.message.size":              11,
+		"websocket.message.payload":           "hello",
+		"websocket.message.payload.truncated": true,
+	}, events[0].Attributes)
+
+	// response body capture is disabled hence no payload
+	assert.Equal(t, map[string]interface{}{
+		"websocket.direction":    "sent",
+		"websocket.opcode":       1,
+		"websocket.message.size": 2,
+	}, events[1].Attributes)
+}
+
+func TestMessageRecorderIsDisabledByDefault(t *testing.T) {
+	span := mock.NewSpan()
+	r := NewMessageRecorder(span, nil)
+	r.Record(DirectionReceived, OpcodeText, []byte("hello"))
+
+	assert.Empty(t, span.Events())
+}
@@ -3,46 +3,97 @@ package config
 import (
 	"log"
 	"sync"
+	"sync/atomic"
 
 	agentconfig "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/config"
 	"google.golang.org/protobuf/proto"
 )
 
-var cfg *agentconfig.AgentConfig
+var cfg atomic.Pointer[agentconfig.AgentConfig]
 var cfgMux = &sync.Mutex{}
 
+// notifyMux serializes the updates so the subscribers are notified in the order the
+// config is stored and the last notification is always the stored config.
+var notifyMux = &sync.Mutex{}
+
+var subscribers = map[int]func(*agentconfig.AgentConfig){}
+var lastSubscriberID int
+
 // InitConfig initializes the config with default values
 func InitConfig(c *agentconfig.AgentConfig) {
 	cfgMux.Lock()
 	defer cfgMux.Unlock()
 
-	if cfg != nil {
+	if cfg.Load() != nil {
 		log.Println("config already initialized, ignoring new config.")
 		return
 	}
 
-	// The reason why we clone the message instead of reusing the one passed by the user
-	// is because user might decide to change values in runtime and that is undesirable
-	// without a proper API.
-	var ok bool
-	cfg, ok = proto.Clone(c).(*agentconfig.AgentConfig)
-	if !ok {
-		log.Fatal("failed to initialize config.")
+	cfg.Store(clone(c))
+}
+
+// UpdateConfig replaces the config and notifies the subscribers. Instrumentations read
+// the config on every request hence the new values apply from the next request on.
+// Subscribers must not update the config from their callback.
+func UpdateConfig(c *agentconfig.AgentConfig) {
+	notifyMux.Lock()
+	defer notifyMux.Unlock()
+
+	cfgMux.Lock()
+	newCfg := clone(c)
+	cfg.Store(newCfg)
+	callbacks := make([]func(*agentconfig.AgentConfig), 0, len(subscribers))
+	for _, callback := range subscribers {
+		callbacks = append(callbacks, callback)
+	}
+	cfgMux.Unlock()
+
+	// callbacks are called outside of cfgMux so they can read the config and (un)subscribe
+	for _, callback := range callbacks {
+		callback(newCfg)
+	}
+}
+
+// Subscribe registers a callback called with the new config every time it is
+// updated. It returns a function to unsubscribe.
+func Subscribe(callback func(*agentconfig.AgentConfig)) func() {
+	cfgMux.Lock()
+	defer cfgMux.Unlock()
+
+	lastSubscriberID++
+	id := lastSubscriberID
+	subscribers[id] = callback
+	return func() {
+		cfgMux.Lock()
+		defer cfgMux.Unlock()
+		delete(subscribers, id)
 	}
 }
 
 // GetConfig returns the config value
 func GetConfig() *agentconfig.AgentConfig {
-	if cfg == nil {
-		InitConfig(config.Load())
+	if c := cfg.Load(); c != nil {
+		return c
 	}
 
-	return cfg
+	InitConfig(config.Load())
+	return cfg.Load()
 }
 
 func ResetConfig() {
 	cfgMux.Lock()
 	defer cfgMux.Unlock()
-	cfg = nil
+	cfg.Store(nil)
+}
+
+// clone returns a copy of the config. The reason why we clone the message instead of
+// reusing the one passed by the user is because user might decide to change values in
+// runtime and that is undesirable without a proper API.
+func clone(c *agentconfig.AgentConfig) *agentconfig.AgentConfig {
+	cloned, ok := proto.Clone(c).(*agentconfig.AgentConfig)
+	if !ok {
+		log.Fatal("failed to initialize config.")
+	}
+	return cloned
 }
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	config "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/stretchr/testify/assert"
@@ -15,3 +18,60 @@ func TestConfig(t *testing.T) {
 
 	assert.Equal(t, "my_service", GetConfig().ServiceName.Value)
 }
+
+func TestUpdateConfigNotifiesSubscribers(t *testing.T) {
+	InitConfig(&config.AgentConfig{
+		ServiceName: config.String("my_service"),
+	})
+	defer ResetConfig()
+
+	var notified []string
+	unsubscribe := Subscribe(func(c *config.AgentConfig) {
+		notified = append(notified, c.ServiceName.Value)
+	})
+
+	newCfg := &config.AgentConfig{ServiceName: config.String("my_new_service")}
+	UpdateConfig(newCfg)
+	assert.Equal(t, "my_new_service", GetConfig().ServiceName.Value)
+	assert.Equal(t, []string{"my_new_service"}, notified)
+
+	// the config is cloned hence changes in the passed value don't apply
+	newCfg.ServiceName = config.String("changed")
+	assert.Equal(t, "my_new_service", GetConfig().ServiceName.Value)
+
+	unsubscribe()
+	UpdateConfig(&config.AgentConfig{ServiceName: config.String("my_last_service")})
+	assert.Equal(t, []string{"my_new_service"}, notified)
+}
+
+func TestConcurrentUpdatesNotifyInStoreOrder(t *testing.T) {
+	InitConfig(&config.AgentConfig{})
+	defer ResetConfig()
+
+	var mu sync.Mutex
+	var last string
+	unsubscribe := Subscribe(func(c *config.AgentConfig) {
+		// gives the other updates a chance to store their config meanwhile
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		// every notification carries the config stored at that time
+		assert.Equal(t, GetConfig().ServiceName.Value, c.ServiceName.Value)
+		last = c.ServiceName.Value
+	})
+	defer unsubscribe()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			UpdateConfig(&config.AgentConfig{ServiceName: config.String(fmt.Sprintf("service_%d", i))})
+		}(i)
+	}
+	wg.Wait()
+
+	// the last notification is the stored config
+	assert.Equal(t, GetConfig().ServiceName.Value, last)
+}
@@ -8,10 +8,10 @@ import (
 	"github.com/hypertrace/goagent/sdk"
 )
 
-type spanEvent struct {
-	name       string
-	ts         time.Time
-	attributes map[string]interface{}
+type SpanEvent struct {
+	Name       string
+	Timestamp  time.Time
+	Attributes map[string]interface{}
 }
 
 type Status struct {
@@ -50,7 +50,7 @@ type Span struct {
 	Err        error
 	Noop       bool
 	Status     Status
-	spanEvents []spanEvent
+	spanEvents []SpanEvent
 	mux        *sync.Mutex
 }
 
@@ -110,7 +110,23 @@ func (s *Span) AddEvent(name string, ts time.Time, attributes map[string]interfa
 	s.mux.Lock() // avoids race conditions
 	defer s.mux.Unlock()
 
-	s.spanEvents = append(s.spanEvents, spanEvent{name, ts, attributes})
+	s.spanEvents = append(s.spanEvents, SpanEvent{name, ts, attributes})
+}
+
+// Events returns a copy of the events added to the span so far.
+func (s *Span) Events() []SpanEvent {
+	s.mux.Lock() // avoids race conditions
+	defer s.mux.Unlock()
+
+	return append([]SpanEvent(nil), s.spanEvents...)
+}
+
+// SetName renames the span, as spans created by the opentelemetry tracer allow.
+func (s *Span) SetName(name string) {
+	s.mux.Lock() // avoids race conditions
+	defer s.mux.Unlock()
+
+	s.Name = name
 }
 
 // This function has no use, it has been added just so that the interface in sdk/span.go remains implemented